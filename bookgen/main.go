@@ -0,0 +1,31 @@
+// Command bookgen writes the opening book of the Connect Four solver, which the server loads at
+// startup. Books grow about fourfold with every disc of depth, and take longer to make:
+//
+//	go run ./bookgen -depth 8 -out connect4.book
+package main
+
+import (
+	"connectx/src/engine"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+func main() {
+	depth := flag.Int("depth", 8, "solves the positions with up to this many discs")
+	out := flag.String("out", "connect4.book", "path of the book file")
+	flag.Parse()
+
+	start := time.Now()
+	book, err := engine.GenerateBook(*depth, func(depth, positions int) {
+		fmt.Printf("solved %d positions with %d discs, at %v\n", positions, depth, time.Since(start).Round(time.Second))
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := book.Save(*out); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %d positions to %s\n", book.Len(), *out)
+}
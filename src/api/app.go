@@ -2,9 +2,11 @@ package api
 
 import (
 	"connectx/src/api/hub"
+	"connectx/src/engine"
 	"connectx/src/models"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -14,10 +16,25 @@ type App struct {
 	Hub *hub.Hub
 }
 
+// defaultBookPath is where the opening book of the solver is loaded from, unless CONNECTX_BOOK
+// names another file. Books are written by the bookgen command
+const defaultBookPath = "connect4.book"
+
 func NewApp() *App {
 	userModel := &models.User{}
+	h := hub.NewHub(userModel)
+	path := os.Getenv("CONNECTX_BOOK")
+	if path == "" {
+		path = defaultBookPath
+	}
+	book, err := engine.LoadBook(path)
+	if err != nil {
+		fmt.Println("solver runs without an opening book: ", err)
+	} else {
+		h.Solver.Book = book
+	}
 	return &App{
-		Hub: hub.NewHub(userModel),
+		Hub: h,
 	}
 }
 
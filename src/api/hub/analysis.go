@@ -0,0 +1,122 @@
+package hub
+
+import (
+	"connectx/src/core"
+	"connectx/src/engine"
+	"connectx/src/errs"
+	"connectx/src/types"
+	"connectx/utils"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The solver backs hints during matches against bots, and the analysis of finished matches, on
+// standard 7x6 boards. Solving takes a while, so the answers are written once it is done
+
+var (
+	// hintBudget is how long the solver works on a hint
+	hintBudget = 2 * time.Second
+	// analysisBudget is how long the solver works on the analysis of a match
+	analysisBudget = 10 * time.Second
+)
+
+// HandleHint2D answers the player to move in a match against bots with the solution each
+// column leaves them
+func (h *Hub) HandleHint2D(userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.HintPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var board *core.Match2D
+	var reason string
+	err := h.MatchController2D.View(pl.MatchID, func(m *core.Match2D) {
+		switch {
+		case m.SeatOf(userID) < 0:
+			reason = "user is not a player of this match"
+		case m.Gameover:
+			reason = "game is over"
+		case !m.Started:
+			reason = "match has not started yet"
+		case m.Players[m.Turn()].ID != userID:
+			reason = "not your turn"
+		case !engine.Solvable(m.Opts):
+			reason = "hints are only given on 7x6 boards with 4 in a row and classic rules"
+		default:
+			for _, id := range m.OpponentIDs(userID) {
+				if h.bot(id) == nil {
+					reason = "hints are only given in matches against bots"
+					return
+				}
+			}
+			board = m.Copy()
+		}
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Match not found")
+		return
+	}
+	if board == nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, reason)
+		return
+	}
+	go func() {
+		hints, err := h.Solver.Hints(board, hintBudget)
+		if err != nil {
+			writeSolverError(conn, req.ID, err)
+			return
+		}
+		writeMessage(conn, WS_STATUS_OK, req.ID, utils.Object{"hints": hints})
+	}()
+}
+
+// HandleAnalyze2D answers a player of a finished match with the analysis of its drops
+func (h *Hub) HandleAnalyze2D(userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.AnalyzePL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var board *core.Match2D
+	var reason string
+	err := h.MatchController2D.View(pl.MatchID, func(m *core.Match2D) {
+		switch {
+		case m.SeatOf(userID) < 0:
+			reason = "user is not a player of this match"
+		case !m.Gameover:
+			reason = "game is not over"
+		case !engine.Solvable(m.Opts):
+			reason = "analyses are only made of 7x6 boards with 4 in a row and classic rules"
+		default:
+			board = m.Copy()
+		}
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Match not found")
+		return
+	}
+	if board == nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, reason)
+		return
+	}
+	go func() {
+		moves, err := h.Solver.Analyze(board, analysisBudget)
+		if err != nil {
+			writeSolverError(conn, req.ID, err)
+			return
+		}
+		writeMessage(conn, WS_STATUS_OK, req.ID, utils.Object{"moves": moves})
+	}()
+}
+
+func writeSolverError(conn *websocket.Conn, reqID string, err error) {
+	if err == errs.ErrTimeout {
+		writeError(conn, WS_STATUS_SERVER_ERROR, reqID, "could not solve the position in time")
+		return
+	}
+	fmt.Println("err solving a position: ", err)
+	writeError(conn, WS_STATUS_SERVER_ERROR, reqID, err.Error())
+}
@@ -0,0 +1,177 @@
+package hub
+
+import (
+	"connectx/src/core"
+	"connectx/src/engine"
+	"connectx/src/types"
+	"connectx/utils"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Bots are virtual users: they have no connection, and send their messages through
+// ProcessMessage like clients do, so their moves take the same paths as a human's, clocks
+// and pushes included. What the server writes to them is dropped
+
+// botUser is a virtual user played by a bot
+type botUser struct {
+	*engine.Bot
+	// thinking is set while the bot searches for a move, so that it never searches twice at once
+	thinking atomic.Bool
+}
+
+// boardMessages holds the message types that bots send besides moves, for a board configuration
+type boardMessages struct {
+	join, declineDraw, denyTakeback MessageType
+}
+
+var (
+	messages2D = boardMessages{MESSAGE_TYPE_JOIN_MATCH_2D, MESSAGE_TYPE_DECLINE_DRAW_2D, MESSAGE_TYPE_DENY_TAKEBACK_2D}
+	messages3D = boardMessages{MESSAGE_TYPE_JOIN_MATCH_3D, MESSAGE_TYPE_DECLINE_DRAW_3D, MESSAGE_TYPE_DENY_TAKEBACK_3D}
+)
+
+func messagesOf[M core.EngineMatch]() boardMessages {
+	var m M
+	if _, ok := any(m).(*core.Match3D); ok {
+		return messages3D
+	}
+	return messages2D
+}
+
+// GetUserDTO returns the DTO of a user, bots included
+func (h *Hub) GetUserDTO(userID string) (*core.PlayerDTO, error) {
+	if bot := h.bot(userID); bot != nil {
+		return &core.PlayerDTO{ID: userID, Nick: bot.Nick(), Bot: &core.BotDTO{Level: bot.Level, Name: bot.Name()}}, nil
+	}
+	return h.UserModel.GetUserDTO(userID)
+}
+
+func (h *Hub) bot(userID string) *botUser {
+	h.BotsMutex.Lock()
+	defer h.BotsMutex.Unlock()
+	return h.Bots[userID]
+}
+
+// releaseBots forgets the bots among userIDs, once they are out of their match. A bot keeps its
+// search state, a transposition table in 2D, until then, and the state is freed once its last
+// search returns
+func (h *Hub) releaseBots(userIDs ...string) {
+	h.BotsMutex.Lock()
+	defer h.BotsMutex.Unlock()
+	for _, id := range userIDs {
+		delete(h.Bots, id)
+	}
+}
+
+// sendAs processes a message of userID, a bot, as if it came from a client
+func (h *Hub) sendAs(userID string, mt MessageType, body any) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		fmt.Println("err marshaling bot message: ", err)
+		return
+	}
+	msg, _ := json.Marshal(WsRequest{Type: mt, Body: b})
+	h.ProcessMessage(userID, nil, msg, websocket.BinaryMessage)
+}
+
+// seatBots registers a bot per empty seat of a match just created, and has them join it
+func seatBots[M core.EngineMatch](h *Hub, c *core.MatchController[M], matchID string, opts core.BotOpts) {
+	seats := 0
+	c.View(matchID, func(m M) {
+		for _, p := range m.Engine().Players {
+			if p.ID == "" {
+				seats++
+			}
+		}
+	})
+	for range seats {
+		id := "bot-" + uuid.NewString()
+		h.BotsMutex.Lock()
+		h.Bots[id] = &botUser{Bot: engine.NewBot(opts.Level, h.Solver)}
+		h.BotsMutex.Unlock()
+		h.sendAs(id, messagesOf[M]().join, types.JoinMatchPL{MatchID: matchID})
+	}
+	playBots(h, c, matchID)
+}
+
+// playBots lets the bot to move in the match, if any, think on a copy of it, and then send its
+// move. It doesn't wait for the move. A bot that fails to find a move abandons the match, rather
+// than holding it up
+func playBots[M core.EngineMatch](h *Hub, c *core.MatchController[M], matchID string) {
+	var botID string
+	var bot *botUser
+	var think func() (MessageType, any, error)
+	var abandon MessageType
+	c.View(matchID, func(match M) {
+		m := match.Engine()
+		if m.Gameover || !m.Started {
+			return
+		}
+		botID = m.Players[m.Turn()].ID
+		if bot = h.bot(botID); bot == nil || !bot.thinking.CompareAndSwap(false, true) {
+			bot = nil
+			return
+		}
+		budget := bot.Budget(m, time.Now())
+		switch match := any(match).(type) {
+		case *core.Match2D:
+			board := match.Copy()
+			abandon = MESSAGE_TYPE_ABANDON_MATCH_2D
+			think = func() (MessageType, any, error) {
+				move, err := bot.Move2D(board, budget)
+				if move.Kind == core.MOVE_KIND_SWAP {
+					return MESSAGE_TYPE_SWAP_2D, types.SwapPL{MatchID: matchID}, err
+				}
+				return MESSAGE_TYPE_REGISTER_MOVE_2D, types.RegisterMovePL{MatchID: matchID, Col: move.Col, Row: move.Row, Kind: int(move.Kind)}, err
+			}
+		case *core.Match3D:
+			board := match.Copy()
+			abandon = MESSAGE_TYPE_ABANDON_MATCH_3D
+			think = func() (MessageType, any, error) {
+				move, err := bot.Move3D(board, budget)
+				if move.Kind == core.MOVE_KIND_SWAP {
+					return MESSAGE_TYPE_SWAP_3D, types.SwapPL{MatchID: matchID}, err
+				}
+				return MESSAGE_TYPE_REGISTER_MOVE_3D, types.RegisterMove3DPL{MatchID: matchID, Col: move.Col, Row: move.Row, H: move.H}, err
+			}
+		}
+	})
+	if bot == nil {
+		return
+	}
+	go func() {
+		mt, body, err := safeThink(think)
+		bot.thinking.Store(false)
+		if err != nil {
+			fmt.Println("err searching a bot move: ", err)
+			h.sendAs(botID, abandon, types.AbandonMatchPL{MatchID: matchID})
+			return
+		}
+		h.sendAs(botID, mt, body)
+	}()
+}
+
+// safeThink runs think, turning its panics into errors
+func safeThink(think func() (MessageType, any, error)) (mt MessageType, body any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return think()
+}
+
+// answerBots has the bots among userIDs turn down a draw offer or a takeback request, with a
+// message of type mt
+func (h *Hub) answerBots(mt MessageType, matchID string, userIDs ...string) {
+	for _, id := range userIDs {
+		if h.bot(id) != nil {
+			go h.sendAs(id, mt, utils.Object{"match_id": matchID})
+		}
+	}
+}
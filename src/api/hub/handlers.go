@@ -0,0 +1,476 @@
+package hub
+
+import (
+	"connectx/src/core"
+	"connectx/src/errs"
+	"connectx/src/types"
+	"connectx/utils"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// The handlers below are shared by every board configuration. Only creating a match and
+// registering a move depend on it, since their payloads do
+
+// HandleCreateMatch2D creates a match. With bot options, bots take the other seats once the
+// creator has the match ID
+func (h *Hub) HandleCreateMatch2D(userID string, conn *websocket.Conn, req WsRequest) {
+	var bot *core.BotOpts
+	id := handleCreateMatch(conn, req, func(opts core.MatchOpts) (string, error) {
+		bot = opts.Bot
+		return h.MatchController2D.CreateMatch(userID, opts)
+	})
+	if id != "" && bot != nil {
+		seatBots(h, &h.MatchController2D.MatchController, id, *bot)
+	}
+}
+
+// HandleCreateMatch3D creates a match. With bot options, bots take the other seats once the
+// creator has the match ID
+func (h *Hub) HandleCreateMatch3D(userID string, conn *websocket.Conn, req WsRequest) {
+	var bot *core.BotOpts
+	id := handleCreateMatch(conn, req, func(opts core.MatchOpts3D) (string, error) {
+		bot = opts.Bot
+		return h.MatchController3D.CreateMatch(userID, opts)
+	})
+	if id != "" && bot != nil {
+		seatBots(h, &h.MatchController3D.MatchController, id, *bot)
+	}
+}
+
+// handleCreateMatch answers with the ID of the match, which it returns. It returns "" if the
+// match could not be created
+func handleCreateMatch[O any](conn *websocket.Conn, req WsRequest, create func(opts O) (string, error)) string {
+	var opts O
+	err := json.Unmarshal(req.Body, &opts)
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return ""
+	}
+	id, err := create(opts)
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return ""
+	}
+	resp := struct {
+		ID string `json:"id"`
+	}{
+		ID: id,
+	}
+	writeMessage(conn, WS_STATUS_OK, req.ID, resp)
+	return id
+}
+
+func (h *Hub) HandleRegisterMove2D(userID string, conn *websocket.Conn, req WsRequest) {
+	var body types.RegisterMovePL
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "invalid move payload")
+		return
+	}
+	var state matchState
+	move := utils.Object{"col": body.Col, "kind": body.Kind}
+	_, res, err := h.MatchController2D.RegisterMove(userID, body, func(m *core.Match2D) {
+		state = readState(userID, m.Engine())
+		if m.Opts.NoGravity {
+			move["row"] = body.Row
+		}
+		if m.Opts.Scoring {
+			move["completed"] = m.LastCompleted()
+		}
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	h.writeMoveResult(userID, conn, req, state, res, move)
+	playBots(h, &h.MatchController2D.MatchController, body.MatchID)
+}
+
+func (h *Hub) HandleRegisterMove3D(userID string, conn *websocket.Conn, req WsRequest) {
+	var body types.RegisterMove3DPL
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "invalid move payload")
+		return
+	}
+	var state matchState
+	move := utils.Object{"col": body.Col, "row": body.Row}
+	_, res, err := h.MatchController3D.RegisterMove(userID, body, func(m *core.Match3D) {
+		state = readState(userID, m.Engine())
+		if m.Opts.Gravity != core.GRAVITY_3D_H {
+			move["h"] = body.H
+		}
+		if m.Opts.Scoring {
+			move["completed"] = m.LastCompleted()
+		}
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	h.writeMoveResult(userID, conn, req, state, res, move)
+	playBots(h, &h.MatchController3D.MatchController, body.MatchID)
+}
+
+// matchState is what the handlers tell the players of a match after an action on it. It is read
+// while the match is still locked by the action, since the flag timer, the bots and the other
+// players can change the match as soon as it is released
+type matchState struct {
+	// clocks holds the clock of every seat, as time_left_p1, time_left_p2 and so on
+	clocks utils.Object
+	// seat is the seat of the player who acted
+	seat int
+	// scores holds the score of each seat, in scoring matches
+	scores   []int
+	gameover bool
+	// opponentIDs holds the IDs of the other seated players, and playerIDs those of every one
+	opponentIDs, playerIDs []string
+}
+
+// readState reads the state of m after an action of userID. The caller holds the lock of m
+func readState(userID string, m *core.MatchND) matchState {
+	s := matchState{
+		clocks:      utils.Object{},
+		seat:        m.SeatOf(userID),
+		gameover:    m.Gameover,
+		opponentIDs: m.OpponentIDs(userID),
+		playerIDs:   m.PlayerIDs(),
+	}
+	for i, p := range m.Players {
+		s.clocks[fmt.Sprintf("time_left_p%d", i+1)] = p.TimeLeft
+	}
+	if m.Opts.Scoring {
+		s.scores = slices.Clone(m.Scores)
+	}
+	return s
+}
+
+// withClocks adds the clock of every seat to b
+func (s matchState) withClocks(b utils.Object) utils.Object {
+	maps.Copy(b, s.clocks)
+	return b
+}
+
+// outIDs returns the IDs of the players who are out of the match after res: every one once the
+// match is over, and otherwise the loser of res, if any
+func (s matchState) outIDs(res core.GameoverResult) []string {
+	if s.gameover {
+		return s.playerIDs
+	}
+	if id, ok := res["loserID"].(string); ok {
+		return []string{id}
+	}
+	return nil
+}
+
+// writeMoveResult answers the mover and notifies the other seats of a registered move. move
+// holds the fields that describe the move on the board
+func (h *Hub) writeMoveResult(userID string, conn *websocket.Conn, req WsRequest, state matchState, res core.GameoverResult, move utils.Object) {
+	opponentIDs := state.opponentIDs
+	h.releaseBots(state.outIDs(res)...)
+
+	b := state.withClocks(maps.Clone(move))
+	b["seat"] = state.seat
+	if state.scores != nil {
+		b["scores"] = state.scores
+	}
+
+	switch {
+	case res == nil:
+		//normal move
+		go writeMessage(conn, WS_STATUS_OK, req.ID, nil)
+		h.pushToUsers(WS_STATUS_ENEMY_SENT_MOVE, b, opponentIDs...)
+	case res["resType"] == core.RESULT_TYPE_WON:
+		//winning move. in PopOut, a pop can complete a line for the opponent only
+
+		b["lines"] = res["lines"]
+		winnerID := userID
+		if id, ok := res["winnerID"].(string); ok {
+			winnerID = id
+		}
+		h.writeWinner(userID, conn, req.ID, state, winnerID, b)
+	case res["resType"] == core.RESULT_TYPE_DRAW:
+		//drawing move
+
+		b["reason"] = res["reason"]
+		go writeMessage(conn, WS_STATUS_GAMEOVER_DRAW, req.ID, b)
+		h.pushToUsers(WS_STATUS_GAMEOVER_DRAW, b, opponentIDs...)
+	case res["resType"] == core.RESULT_TYPE_TIMEOUT:
+		//move arrived after the mover's clock ran out. the move is not registered
+
+		b := state.withClocks(utils.Object{"resType": res["resType"], "loser_id": res["loserID"]})
+		if !state.gameover {
+			h.writeEliminated(conn, req.ID, state, b)
+			return
+		}
+		b["winner_id"] = res["winnerID"]
+		go writeMessage(conn, WS_STATUS_GAMEOVER_TIMEOUT, req.ID, b)
+		h.pushToUsers(WS_STATUS_GAMEOVER_TIMEOUT, b, opponentIDs...)
+	default:
+		fmt.Printf("unexpected scenario in handleRegisterMove.. \n\tres is: %+v\n\tand match is: %+v\n", res, state)
+		writeError(conn, WS_STATUS_SERVER_ERROR, req.ID, "unexpected scenario in HandleRegisterMove")
+	}
+}
+
+// writeWinner tells the winner of a match that they won, and every other seat that they lost.
+// userID is answered on conn, the other seats are pushed to
+func (h *Hub) writeWinner(userID string, conn *websocket.Conn, reqID string, state matchState, winnerID string, b any) {
+	for _, id := range state.playerIDs {
+		status := WS_STATUS_GAMEOVER_LOST
+		if id == winnerID {
+			status = WS_STATUS_GAMEOVER_WON
+		}
+		if id == userID {
+			go writeMessage(conn, status, reqID, b)
+		} else {
+			h.pushToUsers(status, b, id)
+		}
+	}
+}
+
+// writeEliminated tells every seat that userID was eliminated from a match that goes on
+func (h *Hub) writeEliminated(conn *websocket.Conn, reqID string, state matchState, b any) {
+	go writeMessage(conn, WS_STATUS_PLAYER_ELIMINATED, reqID, b)
+	h.pushToUsers(WS_STATUS_PLAYER_ELIMINATED, b, state.opponentIDs...)
+}
+
+func handleJoinMatch[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.JoinMatchPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var matchDTO any
+	var dtoErr error
+	var opponentIDs []string
+	_, isFirstTimeJoiner, err := c.JoinMatch(userID, pl.MatchID, func(m M) {
+		matchDTO, dtoErr = m.DTO(h)
+		opponentIDs = m.Engine().OpponentIDs(userID)
+	})
+	if err != nil {
+		switch err {
+		case errs.ErrNotFound:
+			writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Match not found")
+		case errs.ErrUnjoinable:
+			writeError(conn, WS_STATUS_UNJOINABLE, req.ID, "Match unjoinable")
+		default:
+			writeError(conn, WS_STATUS_SERVER_ERROR, req.ID, "Server error")
+		}
+		return
+	}
+
+	if isFirstTimeJoiner {
+		playerData, err := h.GetUserDTO(userID)
+		if err != nil {
+			writeError(conn, WS_STATUS_SERVER_ERROR, req.ID, "Could not retrieve joining player's data")
+			return
+		}
+		h.pushToUsers(WS_STATUS_ENEMY_JOINED, playerData, opponentIDs...)
+	}
+
+	if dtoErr != nil {
+		writeError(conn, WS_STATUS_SERVER_ERROR, req.ID, "could not create match DTO")
+		return
+	}
+
+	writeMessage(conn, WS_STATUS_OK, req.ID, matchDTO)
+}
+
+func handleAbandonMatch[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.AbandonMatchPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var state matchState
+	_, res, err := c.Abandon(userID, pl, func(m M) {
+		state = readState(userID, m.Engine())
+	})
+	if err != nil {
+		if err == errs.ErrNotFound {
+			writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Match not found")
+			return
+		}
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	h.releaseBots(state.outIDs(res)...)
+	b := state.withClocks(utils.Object{"resType": res["resType"], "loser_id": userID})
+	if !state.gameover {
+		h.writeEliminated(conn, req.ID, state, b)
+		playBots(h, c, pl.MatchID)
+		return
+	}
+	b["winner_id"] = res["winnerID"]
+	h.writeWinner(userID, conn, req.ID, state, res["winnerID"].(string), b)
+}
+
+// handleSwap registers a pie rule swap. The opponent is told like of any other move, with the
+// swap kind
+func handleSwap[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.SwapPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var state matchState
+	_, res, err := c.Swap(userID, pl, func(m M) {
+		state = readState(userID, m.Engine())
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	h.writeMoveResult(userID, conn, req, state, res, utils.Object{"kind": core.MOVE_KIND_SWAP})
+	playBots(h, c, pl.MatchID)
+}
+
+func handleOfferDraw[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.DrawPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var opponentIDs []string
+	_, err := c.OfferDraw(userID, pl, func(m M) {
+		opponentIDs = m.Engine().OpponentIDs(userID)
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	go writeMessage(conn, WS_STATUS_OK, req.ID, nil)
+	h.pushToUsers(WS_STATUS_ENEMY_OFFERED_DRAW, utils.Object{"match_id": pl.MatchID}, opponentIDs...)
+	h.answerBots(messagesOf[M]().declineDraw, pl.MatchID, opponentIDs...)
+}
+
+func handleAcceptDraw[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.DrawPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var state matchState
+	_, res, err := c.AcceptDraw(userID, pl, func(m M) {
+		state = readState(userID, m.Engine())
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	h.releaseBots(state.playerIDs...)
+	b := state.withClocks(utils.Object{"resType": res["resType"], "reason": res["reason"]})
+	go writeMessage(conn, WS_STATUS_GAMEOVER_DRAW, req.ID, b)
+	h.pushToUsers(WS_STATUS_GAMEOVER_DRAW, b, state.opponentIDs...)
+}
+
+func handleDeclineDraw[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.DrawPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var opponentIDs []string
+	_, err := c.DeclineDraw(userID, pl, func(m M) {
+		opponentIDs = m.Engine().OpponentIDs(userID)
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	go writeMessage(conn, WS_STATUS_OK, req.ID, nil)
+	h.pushToUsers(WS_STATUS_ENEMY_DECLINED_DRAW, utils.Object{"match_id": pl.MatchID}, opponentIDs...)
+}
+
+func handleRequestTakeback[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.TakebackPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var opponentIDs []string
+	_, err := c.RequestTakeback(userID, pl, func(m M) {
+		opponentIDs = m.Engine().OpponentIDs(userID)
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	go writeMessage(conn, WS_STATUS_OK, req.ID, nil)
+	h.pushToUsers(WS_STATUS_ENEMY_ASKED_TAKEBACK, utils.Object{"match_id": pl.MatchID}, opponentIDs...)
+	h.answerBots(messagesOf[M]().denyTakeback, pl.MatchID, opponentIDs...)
+}
+
+func handleApproveTakeback[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.TakebackPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var matchDTO any
+	var dtoErr error
+	var opponentIDs []string
+	_, err := c.ApproveTakeback(userID, pl, func(m M) {
+		matchDTO, dtoErr = m.DTO(h)
+		opponentIDs = m.Engine().OpponentIDs(userID)
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	if dtoErr != nil {
+		writeError(conn, WS_STATUS_SERVER_ERROR, req.ID, "could not create match DTO")
+		return
+	}
+	go writeMessage(conn, WS_STATUS_TAKEBACK_DONE, req.ID, matchDTO)
+	h.pushToUsers(WS_STATUS_TAKEBACK_DONE, matchDTO, opponentIDs...)
+	playBots(h, c, pl.MatchID)
+}
+
+func handleDenyTakeback[M core.EngineMatch](h *Hub, c *core.MatchController[M], userID string, conn *websocket.Conn, req WsRequest) {
+	var pl types.TakebackPL
+	if err := json.Unmarshal(req.Body, &pl); err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, "Invalid Request Body")
+		return
+	}
+	var opponentIDs []string
+	_, err := c.DenyTakeback(userID, pl, func(m M) {
+		opponentIDs = m.Engine().OpponentIDs(userID)
+	})
+	if err != nil {
+		writeError(conn, WS_STATUS_BAD_REQUEST, req.ID, err.Error())
+		return
+	}
+	go writeMessage(conn, WS_STATUS_OK, req.ID, nil)
+	h.pushToUsers(WS_STATUS_ENEMY_DENIED_TAKEBACK, utils.Object{"match_id": pl.MatchID}, opponentIDs...)
+}
+
+// handleFlagFall notifies every seat that the player to move ran out of time. That ends the
+// match, unless more than one player is left. It reads the match under the lock the flag timer
+// holds, and notifies the seats once the timer released it
+func handleFlagFall[M core.EngineMatch](h *Hub, c *core.MatchController[M]) func(matchID string, match M, res core.GameoverResult) {
+	return func(matchID string, match M, res core.GameoverResult) {
+		state := readState("", match.Engine())
+		b := state.withClocks(utils.Object{
+			"match_id": matchID,
+			"resType":  res["resType"],
+			"loser_id": res["loserID"],
+		})
+		if !state.gameover {
+			go func() {
+				h.releaseBots(state.outIDs(res)...)
+				h.pushToUsers(WS_STATUS_PLAYER_ELIMINATED, b, state.playerIDs...)
+				playBots(h, c, matchID)
+			}()
+			return
+		}
+		b["winner_id"] = res["winnerID"]
+		go func() {
+			h.releaseBots(state.playerIDs...)
+			h.pushToUsers(WS_STATUS_GAMEOVER_TIMEOUT, b, state.playerIDs...)
+		}()
+	}
+}
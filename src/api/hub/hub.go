@@ -3,6 +3,7 @@ package hub
 import (
 	"bytes"
 	"connectx/src/core"
+	"connectx/src/engine"
 	"connectx/utils"
 	"encoding/json"
 	"fmt"
@@ -17,21 +18,47 @@ var (
 	space   = []byte{' '}
 )
 
+// connWriteMus holds a *sync.Mutex per connection. gorilla/websocket supports a single
+// concurrent writer, and a conn is written to by its own handlers as well as by pushes
+// triggered by the opponent or by match timers
+var connWriteMus sync.Map
+
+func writeRaw(conn *websocket.Conn, mt int, data []byte) error {
+	if conn == nil {
+		//virtual users, such as bots, have no connection
+		return nil
+	}
+	mu, _ := connWriteMus.LoadOrStore(conn, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	return conn.WriteMessage(mt, data)
+}
+
 type Hub struct {
 	UserConns         map[string]*websocket.Conn
 	UserConnsMutex    sync.Mutex
 	UserModel         core.DTOGetter
 	MatchController2D *core.MatchController2D
 	MatchController3D *core.MatchController3D
+	// Bots holds the virtual users played by server-side bots, by user ID
+	Bots      map[string]*botUser
+	BotsMutex sync.Mutex
+	// Solver solves standard Connect Four for the bots, the hints and the analyses
+	Solver *engine.Solver
 }
 
 func NewHub(userModel core.DTOGetter) *Hub {
-	return &Hub{
+	h := &Hub{
 		UserConns:         make(map[string]*websocket.Conn),
 		MatchController2D: core.NewMatchController2D(),
 		MatchController3D: core.NewMatchController3D(),
 		UserModel:         userModel,
+		Bots:              make(map[string]*botUser),
+		Solver:            &engine.Solver{},
 	}
+	h.MatchController2D.OnTimeout = handleFlagFall(h, &h.MatchController2D.MatchController)
+	h.MatchController3D.OnTimeout = handleFlagFall(h, &h.MatchController3D.MatchController)
+	return h
 }
 
 func (h *Hub) ProcessMessage(userID string, conn *websocket.Conn, msg []byte, mt int) {
@@ -40,26 +67,64 @@ func (h *Hub) ProcessMessage(userID string, conn *websocket.Conn, msg []byte, mt
 		var req WsRequest
 		if err := json.Unmarshal(msg, &req); err != nil {
 			fmt.Println("err unmarshaling json: ", err)
-			conn.WriteMessage(websocket.TextMessage, []byte("err unmarshaling json: "+err.Error()))
+			writeRaw(conn, websocket.TextMessage, []byte("err unmarshaling json: "+err.Error()))
 			return
 		}
+		c2D := &h.MatchController2D.MatchController
+		c3D := &h.MatchController3D.MatchController
 		switch req.Type {
 		case MESSAGE_TYPE_CREATE_MATCH_2D:
 			h.HandleCreateMatch2D(userID, conn, req)
 		case MESSAGE_TYPE_JOIN_MATCH_2D:
-			h.HandleJoinMatch2D(userID, conn, req)
+			handleJoinMatch(h, c2D, userID, conn, req)
 		case MESSAGE_TYPE_REGISTER_MOVE_2D:
 			h.HandleRegisterMove2D(userID, conn, req)
+		case MESSAGE_TYPE_ABANDON_MATCH_2D:
+			handleAbandonMatch(h, c2D, userID, conn, req)
+		case MESSAGE_TYPE_ASK_DRAW_2D:
+			handleOfferDraw(h, c2D, userID, conn, req)
+		case MESSAGE_TYPE_ACCEPT_DRAW_2D:
+			handleAcceptDraw(h, c2D, userID, conn, req)
+		case MESSAGE_TYPE_DECLINE_DRAW_2D:
+			handleDeclineDraw(h, c2D, userID, conn, req)
+		case MESSAGE_TYPE_ASK_TAKEBACK_2D:
+			handleRequestTakeback(h, c2D, userID, conn, req)
+		case MESSAGE_TYPE_APPROVE_TAKEBACK_2D:
+			handleApproveTakeback(h, c2D, userID, conn, req)
+		case MESSAGE_TYPE_DENY_TAKEBACK_2D:
+			handleDenyTakeback(h, c2D, userID, conn, req)
+		case MESSAGE_TYPE_SWAP_2D:
+			handleSwap(h, c2D, userID, conn, req)
+		case MESSAGE_TYPE_HINT_2D:
+			h.HandleHint2D(userID, conn, req)
+		case MESSAGE_TYPE_ANALYZE_2D:
+			h.HandleAnalyze2D(userID, conn, req)
 		case MESSAGE_TYPE_CREATE_MATCH_3D:
 			h.HandleCreateMatch3D(userID, conn, req)
 		case MESSAGE_TYPE_JOIN_MATCH_3D:
-			h.HandleJoinMatch3D(userID, conn, req)
+			handleJoinMatch(h, c3D, userID, conn, req)
 		case MESSAGE_TYPE_REGISTER_MOVE_3D:
 			h.HandleRegisterMove3D(userID, conn, req)
+		case MESSAGE_TYPE_ABANDON_MATCH_3D:
+			handleAbandonMatch(h, c3D, userID, conn, req)
+		case MESSAGE_TYPE_ASK_DRAW_3D:
+			handleOfferDraw(h, c3D, userID, conn, req)
+		case MESSAGE_TYPE_ACCEPT_DRAW_3D:
+			handleAcceptDraw(h, c3D, userID, conn, req)
+		case MESSAGE_TYPE_DECLINE_DRAW_3D:
+			handleDeclineDraw(h, c3D, userID, conn, req)
+		case MESSAGE_TYPE_ASK_TAKEBACK_3D:
+			handleRequestTakeback(h, c3D, userID, conn, req)
+		case MESSAGE_TYPE_APPROVE_TAKEBACK_3D:
+			handleApproveTakeback(h, c3D, userID, conn, req)
+		case MESSAGE_TYPE_DENY_TAKEBACK_3D:
+			handleDenyTakeback(h, c3D, userID, conn, req)
+		case MESSAGE_TYPE_SWAP_3D:
+			handleSwap(h, c3D, userID, conn, req)
 		}
 	default:
 		fmt.Println("expected binary, got msg type: ", mt)
-		conn.WriteMessage(websocket.TextMessage, []byte("invalid msg type. expected Binary"))
+		writeRaw(conn, websocket.TextMessage, []byte("invalid msg type. expected Binary"))
 	}
 }
 
@@ -76,6 +141,7 @@ func (hub *Hub) ListenFromUser(userID string, conn *websocket.Conn) error {
 			hub.UserConnsMutex.Lock()
 			delete(hub.UserConns, userID)
 			hub.UserConnsMutex.Unlock()
+			connWriteMus.Delete(conn)
 			return err
 		}
 
@@ -95,9 +161,22 @@ func writeMessage(conn *websocket.Conn, status WsStatus, id string, body any) {
 	bs, err := json.Marshal(resp)
 	if err != nil {
 		fmt.Println("err marshaling response: ", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("SERVER ERROR"))
+		writeRaw(conn, websocket.TextMessage, []byte("SERVER ERROR"))
+		return
+	}
+	writeRaw(conn, websocket.BinaryMessage, bs)
+}
+
+// pushToUsers sends a server-pushed event to each of the given users that is currently connected
+func (h *Hub) pushToUsers(status WsStatus, body any, userIDs ...string) {
+	for _, userID := range userIDs {
+		h.UserConnsMutex.Lock()
+		conn, ok := h.UserConns[userID]
+		h.UserConnsMutex.Unlock()
+		if ok {
+			writeMessage(conn, status, "-1", body)
+		}
 	}
-	conn.WriteMessage(websocket.BinaryMessage, bs)
 }
 
 func writeError(conn *websocket.Conn, status WsStatus, id string, msg string) {
@@ -2,6 +2,7 @@ package hub
 
 import (
 	"connectx/src/core"
+	"connectx/src/engine"
 	"connectx/src/types"
 	"encoding/json"
 	"net/http"
@@ -188,7 +189,7 @@ func TestHub_HandleRegisterMove2D(t *testing.T) {
 
 	opts := core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
 	matchID, _ := hub.MatchController2D.CreateMatch(p1ID, opts)
-	hub.MatchController2D.JoinMatch(p2ID, matchID)
+	hub.MatchController2D.JoinMatch(p2ID, matchID, nil)
 
 	moveReq := types.RegisterMovePL{MatchID: matchID, Col: 0}
 	body, _ := json.Marshal(moveReq)
@@ -348,7 +349,7 @@ func TestHub_HandleRegisterMove3D(t *testing.T) {
 
 	opts := core.MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true}
 	matchID, _ := hub.MatchController3D.CreateMatch(p1ID, opts)
-	hub.MatchController3D.JoinMatch(p2ID, matchID)
+	hub.MatchController3D.JoinMatch(p2ID, matchID, nil)
 
 	moveReq := types.RegisterMove3DPL{MatchID: matchID, Row: 0, Col: 0}
 	body, _ := json.Marshal(moveReq)
@@ -413,4 +414,565 @@ func TestHub_ListenFromUser_Disconnect(t *testing.T) {
 	if _, ok := hub.UserConns[p1ID]; ok {
 		t.Error("user connection was not removed after disconnect")
 	}
-}
\ No newline at end of file
+}
+
+func TestHub_FlagFall2D(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p2Conn, p2ClientConn := newTestConn(t)
+
+	p1ID := "player1"
+	p2ID := "player2"
+	hub.UserConns[p1ID] = p1Conn
+	hub.UserConns[p2ID] = p2Conn
+
+	opts := core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 50}
+	matchID, _ := hub.MatchController2D.CreateMatch(p1ID, opts)
+	hub.MatchController2D.JoinMatch(p2ID, matchID, nil)
+
+	for _, c := range []*websocket.Conn{p1ClientConn, p2ClientConn} {
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		var resp WsResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if resp.Status != WS_STATUS_GAMEOVER_TIMEOUT {
+			t.Errorf("expected status GAMEOVER_TIMEOUT, got %v", resp.Status)
+		}
+		body := resp.Body.(map[string]any)
+		if body["loser_id"] != p1ID {
+			t.Errorf("expected loser_id %s, got %v", p1ID, body["loser_id"])
+		}
+	}
+}
+
+func TestHub_HandleAbandonMatch2D(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p2Conn, p2ClientConn := newTestConn(t)
+
+	p1ID := "player1"
+	p2ID := "player2"
+	hub.UserConns[p1ID] = p1Conn
+	hub.UserConns[p2ID] = p2Conn
+
+	opts := core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	matchID, _ := hub.MatchController2D.CreateMatch(p1ID, opts)
+	hub.MatchController2D.JoinMatch(p2ID, matchID, nil)
+
+	body, _ := json.Marshal(types.AbandonMatchPL{MatchID: matchID})
+	req := WsRequest{
+		Type: MESSAGE_TYPE_ABANDON_MATCH_2D,
+		ID:   "7",
+		Body: body,
+	}
+	reqBytes, _ := json.Marshal(req)
+
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+
+	// Check response to player 1
+	_, msg, err := p1ClientConn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message from p1: %v", err)
+	}
+	var resp WsResponse
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.Status != WS_STATUS_GAMEOVER_LOST {
+		t.Errorf("expected status GAMEOVER_LOST for p1, got %v", resp.Status)
+	}
+
+	// Check message to player 2
+	_, msg, err = p2ClientConn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message from p2: %v", err)
+	}
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.Status != WS_STATUS_GAMEOVER_WON {
+		t.Errorf("expected status GAMEOVER_WON for p2, got %v", resp.Status)
+	}
+}
+
+func TestHub_DrawOffer2D(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p2Conn, p2ClientConn := newTestConn(t)
+
+	p1ID := "player1"
+	p2ID := "player2"
+	hub.UserConns[p1ID] = p1Conn
+	hub.UserConns[p2ID] = p2Conn
+
+	opts := core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	matchID, _ := hub.MatchController2D.CreateMatch(p1ID, opts)
+	hub.MatchController2D.JoinMatch(p2ID, matchID, nil)
+
+	body, _ := json.Marshal(types.DrawPL{MatchID: matchID})
+	readStatus := func(c *websocket.Conn) WsStatus {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		var resp WsResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		return resp.Status
+	}
+
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_ASK_DRAW_2D, ID: "8", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	if s := readStatus(p1ClientConn); s != WS_STATUS_OK {
+		t.Errorf("expected status OK for p1, got %v", s)
+	}
+	if s := readStatus(p2ClientConn); s != WS_STATUS_ENEMY_OFFERED_DRAW {
+		t.Errorf("expected status ENEMY_OFFERED_DRAW for p2, got %v", s)
+	}
+
+	reqBytes, _ = json.Marshal(WsRequest{Type: MESSAGE_TYPE_ACCEPT_DRAW_2D, ID: "9", Body: body})
+	hub.ProcessMessage(p2ID, p2Conn, reqBytes, websocket.BinaryMessage)
+	if s := readStatus(p2ClientConn); s != WS_STATUS_GAMEOVER_DRAW {
+		t.Errorf("expected status GAMEOVER_DRAW for p2, got %v", s)
+	}
+	if s := readStatus(p1ClientConn); s != WS_STATUS_GAMEOVER_DRAW {
+		t.Errorf("expected status GAMEOVER_DRAW for p1, got %v", s)
+	}
+}
+
+func TestHub_Takeback2D(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p2Conn, p2ClientConn := newTestConn(t)
+
+	p1ID := "player1"
+	p2ID := "player2"
+	hub.UserConns[p1ID] = p1Conn
+	hub.UserConns[p2ID] = p2Conn
+
+	opts := core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	matchID, _ := hub.MatchController2D.CreateMatch(p1ID, opts)
+	hub.MatchController2D.JoinMatch(p2ID, matchID, nil)
+	hub.MatchController2D.RegisterMove(p1ID, types.RegisterMovePL{MatchID: matchID, Col: 3}, nil)
+
+	body, _ := json.Marshal(types.TakebackPL{MatchID: matchID})
+	readResponse := func(c *websocket.Conn) WsResponse {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		var resp WsResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		return resp
+	}
+
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_ASK_TAKEBACK_2D, ID: "10", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	if resp := readResponse(p1ClientConn); resp.Status != WS_STATUS_OK {
+		t.Errorf("expected status OK for p1, got %v", resp.Status)
+	}
+	if resp := readResponse(p2ClientConn); resp.Status != WS_STATUS_ENEMY_ASKED_TAKEBACK {
+		t.Errorf("expected status ENEMY_ASKED_TAKEBACK for p2, got %v", resp.Status)
+	}
+
+	reqBytes, _ = json.Marshal(WsRequest{Type: MESSAGE_TYPE_APPROVE_TAKEBACK_2D, ID: "11", Body: body})
+	hub.ProcessMessage(p2ID, p2Conn, reqBytes, websocket.BinaryMessage)
+	for _, c := range []*websocket.Conn{p1ClientConn, p2ClientConn} {
+		resp := readResponse(c)
+		if resp.Status != WS_STATUS_TAKEBACK_DONE {
+			t.Errorf("expected status TAKEBACK_DONE, got %v", resp.Status)
+		}
+		moves := resp.Body.(map[string]any)["Moves"].([]any)
+		if len(moves) != 0 {
+			t.Errorf("expected the reverted position to have no moves, got %d", len(moves))
+		}
+	}
+}
+
+func TestHub_PopOut2D_OpponentWins(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p2Conn, p2ClientConn := newTestConn(t)
+
+	p1ID := "player1"
+	p2ID := "player2"
+	hub.UserConns[p1ID] = p1Conn
+	hub.UserConns[p2ID] = p2Conn
+
+	opts := core.MatchOpts{W: 4, H: 4, A: 4, Starts1: true, Variant: core.VARIANT_POPOUT}
+	matchID, _ := hub.MatchController2D.CreateMatch(p1ID, opts)
+	hub.MatchController2D.JoinMatch(p2ID, matchID, nil)
+	// p2 fills the bottom row but p1's disc in column 0, then covers it
+	for i, col := range []int{0, 1, 1, 2, 2, 3, 3, 0} {
+		pid := p1ID
+		if i%2 != 0 {
+			pid = p2ID
+		}
+		if _, _, err := hub.MatchController2D.RegisterMove(pid, types.RegisterMovePL{MatchID: matchID, Col: col}, nil); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+
+	body, _ := json.Marshal(types.RegisterMovePL{MatchID: matchID, Col: 0, Kind: int(core.MOVE_KIND_POP)})
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_REGISTER_MOVE_2D, ID: "12", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+
+	for _, c := range []struct {
+		conn *websocket.Conn
+		want WsStatus
+	}{{p1ClientConn, WS_STATUS_GAMEOVER_LOST}, {p2ClientConn, WS_STATUS_GAMEOVER_WON}} {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		var resp WsResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if resp.Status != c.want {
+			t.Errorf("expected status %v, got %v", c.want, resp.Status)
+		}
+	}
+}
+
+func TestHub_HandleAbandonMatch2D_ThreePlayers(t *testing.T) {
+	hub := newTestHub()
+	ids := []string{"player1", "player2", "player3"}
+	clientConns := make([]*websocket.Conn, len(ids))
+	for i, id := range ids {
+		var conn *websocket.Conn
+		conn, clientConns[i] = newTestConn(t)
+		hub.UserConns[id] = conn
+	}
+
+	opts := core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Players: 3}
+	matchID, _ := hub.MatchController2D.CreateMatch(ids[0], opts)
+	hub.MatchController2D.JoinMatch(ids[1], matchID, nil)
+	hub.MatchController2D.JoinMatch(ids[2], matchID, nil)
+
+	abandon := func(userID string) {
+		body, _ := json.Marshal(types.AbandonMatchPL{MatchID: matchID})
+		reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_ABANDON_MATCH_2D, ID: "13", Body: body})
+		hub.ProcessMessage(userID, hub.UserConns[userID], reqBytes, websocket.BinaryMessage)
+	}
+	expectStatuses := func(want ...WsStatus) {
+		for i, c := range clientConns {
+			c.SetReadDeadline(time.Now().Add(time.Second))
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				t.Fatalf("failed to read message: %v", err)
+			}
+			var resp WsResponse
+			if err := json.Unmarshal(msg, &resp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if resp.Status != want[i] {
+				t.Errorf("expected status %v for %s, got %v", want[i], ids[i], resp.Status)
+			}
+		}
+	}
+
+	// the match goes on without player3
+	abandon(ids[2])
+	expectStatuses(WS_STATUS_PLAYER_ELIMINATED, WS_STATUS_PLAYER_ELIMINATED, WS_STATUS_PLAYER_ELIMINATED)
+
+	// player2 is the last player left
+	abandon(ids[0])
+	expectStatuses(WS_STATUS_GAMEOVER_LOST, WS_STATUS_GAMEOVER_WON, WS_STATUS_GAMEOVER_LOST)
+}
+
+func TestHub_Swap2D(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p2Conn, p2ClientConn := newTestConn(t)
+
+	p1ID := "player1"
+	p2ID := "player2"
+	hub.UserConns[p1ID] = p1Conn
+	hub.UserConns[p2ID] = p2Conn
+
+	opts := core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Pie: true}
+	matchID, _ := hub.MatchController2D.CreateMatch(p1ID, opts)
+	hub.MatchController2D.JoinMatch(p2ID, matchID, nil)
+	hub.MatchController2D.RegisterMove(p1ID, types.RegisterMovePL{MatchID: matchID, Col: 3}, nil)
+
+	body, _ := json.Marshal(types.SwapPL{MatchID: matchID})
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_SWAP_2D, ID: "14", Body: body})
+	hub.ProcessMessage(p2ID, p2Conn, reqBytes, websocket.BinaryMessage)
+
+	for _, c := range []struct {
+		conn *websocket.Conn
+		want WsStatus
+	}{{p2ClientConn, WS_STATUS_OK}, {p1ClientConn, WS_STATUS_ENEMY_SENT_MOVE}} {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		var resp WsResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if resp.Status != c.want {
+			t.Errorf("expected status %v, got %v", c.want, resp.Status)
+		}
+		if c.want == WS_STATUS_ENEMY_SENT_MOVE && resp.Body.(map[string]any)["kind"] != float64(core.MOVE_KIND_SWAP) {
+			t.Errorf("expected a swap, got %v", resp.Body)
+		}
+	}
+}
+
+func TestHub_HandleRegisterMove2D_Scoring(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p2Conn, p2ClientConn := newTestConn(t)
+
+	p1ID := "player1"
+	p2ID := "player2"
+	hub.UserConns[p1ID] = p1Conn
+	hub.UserConns[p2ID] = p2Conn
+
+	opts := core.MatchOpts{W: 3, H: 3, A: 3, Starts1: true, Scoring: true}
+	matchID, _ := hub.MatchController2D.CreateMatch(p1ID, opts)
+	hub.MatchController2D.JoinMatch(p2ID, matchID, nil)
+	for _, move := range []struct {
+		pid string
+		col int
+	}{{p1ID, 0}, {p2ID, 0}, {p1ID, 1}, {p2ID, 1}} {
+		hub.MatchController2D.RegisterMove(move.pid, types.RegisterMovePL{MatchID: matchID, Col: move.col}, nil)
+	}
+
+	body, _ := json.Marshal(types.RegisterMovePL{MatchID: matchID, Col: 2})
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_REGISTER_MOVE_2D, ID: "15", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+
+	for _, c := range []struct {
+		conn *websocket.Conn
+		want WsStatus
+	}{{p1ClientConn, WS_STATUS_OK}, {p2ClientConn, WS_STATUS_ENEMY_SENT_MOVE}} {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read message: %v", err)
+		}
+		var resp WsResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if resp.Status != c.want {
+			t.Errorf("expected status %v, got %v", c.want, resp.Status)
+		}
+		if c.want != WS_STATUS_ENEMY_SENT_MOVE {
+			continue
+		}
+		b := resp.Body.(map[string]any)
+		if scores := b["scores"].([]any); scores[0] != float64(1) || scores[1] != float64(0) {
+			t.Errorf("expected scores [1 0], got %v", b["scores"])
+		}
+		if completed := b["completed"].([]any); len(completed) != 1 {
+			t.Errorf("expected a completed line, got %v", b["completed"])
+		}
+	}
+}
+
+// readStatus reads messages from conn until one has the given status, and returns its body
+func readStatus(t *testing.T, conn *websocket.Conn, want WsStatus) any {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read a message of status %v: %v", want, err)
+		}
+		var resp WsResponse
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if resp.Status == want {
+			return resp.Body
+		}
+	}
+}
+
+func TestHub_HandleCreateMatch2D_Bot(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p1ID := "player1"
+	hub.UserConns[p1ID] = p1Conn
+
+	//the bot takes the second seat, which moves first
+	opts := core.MatchOpts{W: 7, H: 6, A: 4, T0: 60000, Bot: &core.BotOpts{Level: core.BOT_LEVEL_EASY}}
+	body, _ := json.Marshal(opts)
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_CREATE_MATCH_2D, ID: "16", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+
+	matchID := readStatus(t, p1ClientConn, WS_STATUS_OK).(map[string]any)["id"].(string)
+	joined := readStatus(t, p1ClientConn, WS_STATUS_ENEMY_JOINED).(map[string]any)
+	botID := joined["id"].(string)
+	if hub.bot(botID) == nil {
+		t.Fatalf("expected the bot to join, got %v", joined)
+	}
+	if bot, _ := joined["bot"].(map[string]any); joined["nick"] != "Dot" || bot["name"] != "easy" || bot["level"] != float64(core.BOT_LEVEL_EASY) {
+		t.Fatalf("expected the DTO of an easy bot, got %v", joined)
+	}
+	if b := readStatus(t, p1ClientConn, WS_STATUS_ENEMY_SENT_MOVE).(map[string]any); b["seat"] != float64(1) {
+		t.Fatalf("expected the bot's move, got %v", b)
+	}
+
+	//the bot answers each move, on its clock
+	body, _ = json.Marshal(types.RegisterMovePL{MatchID: matchID, Col: 0})
+	reqBytes, _ = json.Marshal(WsRequest{Type: MESSAGE_TYPE_REGISTER_MOVE_2D, ID: "17", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	//the answer to the move is written concurrently, so it may come after the bot's reply
+	b := readStatus(t, p1ClientConn, WS_STATUS_ENEMY_SENT_MOVE).(map[string]any)
+	if b["seat"] != float64(1) || b["time_left_p2"].(float64) > 60000 {
+		t.Fatalf("expected the bot's move, charged to its clock, got %v", b)
+	}
+	m := hub.MatchController2D.Matches[matchID]
+	if len(m.Moves) != 3 || m.Moves[2].Seat != 1 {
+		t.Fatalf("expected 3 moves, the last one by the bot, got %+v", m.Moves)
+	}
+
+	//bots turn draw offers down
+	body, _ = json.Marshal(types.DrawPL{MatchID: matchID})
+	reqBytes, _ = json.Marshal(WsRequest{Type: MESSAGE_TYPE_ASK_DRAW_2D, ID: "18", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	readStatus(t, p1ClientConn, WS_STATUS_ENEMY_DECLINED_DRAW)
+
+	//the bot is forgotten once the match is over
+	body, _ = json.Marshal(types.AbandonMatchPL{MatchID: matchID})
+	reqBytes, _ = json.Marshal(WsRequest{Type: MESSAGE_TYPE_ABANDON_MATCH_2D, ID: "19", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	readStatus(t, p1ClientConn, WS_STATUS_GAMEOVER_LOST)
+	if hub.bot(botID) != nil {
+		t.Fatal("expected the bot to be released once the match is over")
+	}
+}
+
+func TestHub_HandleCreateMatch2D_BotNoMoveLeft(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p1ID := "player1"
+	hub.UserConns[p1ID] = p1Conn
+
+	//the cells under the blocked ones can't be played, and keep lines alive until the end
+	mask := [][]bool{make([]bool, 4), {true, true, true, false}, make([]bool, 4), make([]bool, 4)}
+	opts := core.MatchOpts{W: 4, H: 4, A: 3, Starts1: true, Scoring: true, Mask: mask, Bot: &core.BotOpts{Level: core.BOT_LEVEL_EASY}}
+	body, _ := json.Marshal(opts)
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_CREATE_MATCH_2D, ID: "19", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	matchID := readStatus(t, p1ClientConn, WS_STATUS_OK).(map[string]any)["id"].(string)
+	botID := readStatus(t, p1ClientConn, WS_STATUS_ENEMY_JOINED).(map[string]any)["id"].(string)
+
+	c := hub.MatchController2D
+	play := func() {
+		col := 0
+		c.View(matchID, func(m *core.Match2D) {
+			for m.Board[0][col] != core.SLOT_EMPTY {
+				col++
+			}
+		})
+		body, _ := json.Marshal(types.RegisterMovePL{MatchID: matchID, Col: col})
+		reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_REGISTER_MOVE_2D, ID: "20", Body: body})
+		hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	}
+	play()
+	p1ClientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for over := false; !over; {
+		_, msg, err := p1ClientConn.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected the match to end, got %v", err)
+		}
+		var resp WsResponse
+		json.Unmarshal(msg, &resp)
+		switch resp.Status {
+		case WS_STATUS_ENEMY_SENT_MOVE:
+			play()
+		case WS_STATUS_GAMEOVER_WON, WS_STATUS_GAMEOVER_LOST, WS_STATUS_GAMEOVER_DRAW:
+			over = true
+		}
+	}
+	c.View(matchID, func(m *core.Match2D) {
+		if !m.Gameover || m.Board[3][0] != core.SLOT_EMPTY {
+			t.Errorf("expected the match to end with the unreachable cells empty, got %v", m.Board)
+		}
+	})
+	if hub.bot(botID) != nil {
+		t.Fatal("expected the bot to be released once the match is over")
+	}
+}
+
+func TestHub_HandleCreateMatch3D_Bot(t *testing.T) {
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p1ID := "player1"
+	hub.UserConns[p1ID] = p1Conn
+
+	opts := core.MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, Bot: &core.BotOpts{Level: core.BOT_LEVEL_EASY}}
+	body, _ := json.Marshal(opts)
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_CREATE_MATCH_3D, ID: "19", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	matchID := readStatus(t, p1ClientConn, WS_STATUS_OK).(map[string]any)["id"].(string)
+	readStatus(t, p1ClientConn, WS_STATUS_ENEMY_JOINED)
+
+	body, _ = json.Marshal(types.RegisterMove3DPL{MatchID: matchID, Col: 1, Row: 1})
+	reqBytes, _ = json.Marshal(WsRequest{Type: MESSAGE_TYPE_REGISTER_MOVE_3D, ID: "20", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	if b := readStatus(t, p1ClientConn, WS_STATUS_ENEMY_SENT_MOVE).(map[string]any); b["seat"] != float64(1) {
+		t.Fatalf("expected the bot's move, got %v", b)
+	}
+}
+
+func TestHub_HandleAnalyze2D(t *testing.T) {
+	defer func(budget time.Duration) { analysisBudget = budget }(analysisBudget)
+	analysisBudget = 500 * time.Millisecond
+	hub := newTestHub()
+	p1Conn, p1ClientConn := newTestConn(t)
+	p1ID, p2ID := "player1", "player2"
+	hub.UserConns[p1ID] = p1Conn
+
+	c := hub.MatchController2D
+	matchID, err := c.CreateMatch(p1ID, core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.JoinMatch(p2ID, matchID, nil)
+
+	//hints are for matches against bots
+	body, _ := json.Marshal(types.HintPL{MatchID: matchID})
+	reqBytes, _ := json.Marshal(WsRequest{Type: MESSAGE_TYPE_HINT_2D, ID: "21", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	readStatus(t, p1ClientConn, WS_STATUS_BAD_REQUEST)
+
+	//the first player misses a win on the spot, and wins two plies later
+	for i, col := range []int{3, 3, 4, 4, 5, 5, 0, 2, 6} {
+		if _, _, err := c.RegisterMove([]string{p1ID, p2ID}[i%2], types.RegisterMovePL{MatchID: matchID, Col: col}, nil); err != nil {
+			t.Fatalf("unexpected error playing column %d: %v", col, err)
+		}
+	}
+	body, _ = json.Marshal(types.AnalyzePL{MatchID: matchID})
+	reqBytes, _ = json.Marshal(WsRequest{Type: MESSAGE_TYPE_ANALYZE_2D, ID: "22", Body: body})
+	hub.ProcessMessage(p1ID, p1Conn, reqBytes, websocket.BinaryMessage)
+	b, _ := json.Marshal(readStatus(t, p1ClientConn, WS_STATUS_OK).(map[string]any)["moves"])
+	var moves []engine.MoveAnalysis
+	if err := json.Unmarshal(b, &moves); err != nil {
+		t.Fatalf("failed to unmarshal the analysis: %v", err)
+	}
+	if len(moves) != 9 {
+		t.Fatalf("expected 9 analyzed moves, got %d", len(moves))
+	}
+	miss, win := moves[6], moves[8]
+	if *miss.Best != (engine.Solution{Outcome: engine.OUTCOME_WIN, Plies: 1}) ||
+		*miss.Played != (engine.Solution{Outcome: engine.OUTCOME_WIN, Plies: 3}) || miss.Mistake {
+		t.Fatalf("expected a slower win, got %+v", miss)
+	}
+	if *win.Played != (engine.Solution{Outcome: engine.OUTCOME_WIN, Plies: 1}) {
+		t.Fatalf("expected a win on the spot, got %+v", win)
+	}
+}
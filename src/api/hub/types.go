@@ -15,6 +15,15 @@ const (
 	WS_STATUS_GAMEOVER_WON
 	WS_STATUS_GAMEOVER_LOST
 	WS_STATUS_GAMEOVER_DRAW
+	WS_STATUS_GAMEOVER_TIMEOUT
+	WS_STATUS_ENEMY_OFFERED_DRAW
+	WS_STATUS_ENEMY_DECLINED_DRAW
+	WS_STATUS_ENEMY_ASKED_TAKEBACK
+	WS_STATUS_ENEMY_DENIED_TAKEBACK
+	WS_STATUS_TAKEBACK_DONE
+	// WS_STATUS_PLAYER_ELIMINATED tells every seat of a match with more than two players that
+	// a player resigned or ran out of time, and that the match goes on without them
+	WS_STATUS_PLAYER_ELIMINATED
 )
 const (
 	MESSAGE_TYPE_REGISTER_MOVE_2D MessageType = iota
@@ -26,6 +35,22 @@ const (
 	MESSAGE_TYPE_REGISTER_MOVE_3D
 	MESSAGE_TYPE_JOIN_MATCH_3D
 	MESSAGE_TYPE_CREATE_MATCH_3D
+	MESSAGE_TYPE_ABANDON_MATCH_3D
+	MESSAGE_TYPE_ACCEPT_DRAW_2D
+	MESSAGE_TYPE_DECLINE_DRAW_2D
+	MESSAGE_TYPE_ASK_DRAW_3D
+	MESSAGE_TYPE_ACCEPT_DRAW_3D
+	MESSAGE_TYPE_DECLINE_DRAW_3D
+	MESSAGE_TYPE_ASK_TAKEBACK_2D
+	MESSAGE_TYPE_APPROVE_TAKEBACK_2D
+	MESSAGE_TYPE_DENY_TAKEBACK_2D
+	MESSAGE_TYPE_ASK_TAKEBACK_3D
+	MESSAGE_TYPE_APPROVE_TAKEBACK_3D
+	MESSAGE_TYPE_DENY_TAKEBACK_3D
+	MESSAGE_TYPE_SWAP_2D
+	MESSAGE_TYPE_SWAP_3D
+	MESSAGE_TYPE_HINT_2D
+	MESSAGE_TYPE_ANALYZE_2D
 )
 
 type WsRequest struct {
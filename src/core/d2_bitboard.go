@@ -0,0 +1,285 @@
+package core
+
+import (
+	"fmt"
+)
+
+// bits256 is a bitset wide enough for the largest 2D board allowed by validMatchOptions:
+// 15 columns of 15+1 bits
+type bits256 [4]uint64
+
+func (b bits256) shr(n int) bits256 {
+	var r bits256
+	w, s := n/64, uint(n%64)
+	for i := 0; i+w < len(b); i++ {
+		r[i] = b[i+w] >> s
+		if s > 0 && i+w+1 < len(b) {
+			r[i] |= b[i+w+1] << (64 - s)
+		}
+	}
+	return r
+}
+
+func (b bits256) and(o bits256) bits256 {
+	return bits256{b[0] & o[0], b[1] & o[1], b[2] & o[2], b[3] & o[3]}
+}
+
+func (b bits256) isZero() bool {
+	return b[0]|b[1]|b[2]|b[3] == 0
+}
+
+// Bitboard2D is a compact Connect-Four board meant for bots, analysis and bulk replay. It plays
+// by the same rules as Match2D, without players, clocks nor any of the match lifecycle.
+//
+// Each column takes H+1 bits, bottom-up: the extra bit on top of each column is always empty,
+// so that shifting a line never wraps into the next column. Boards where W*(H+1) fits in 64
+// bits are checked with plain uint64 arithmetic, larger ones with bits256.
+type Bitboard2D struct {
+	Opts     MatchOpts
+	Gameover bool
+
+	// discs holds the bitset of each player, discs[0] for SLOT_PLAYER1 and discs[1] for SLOT_PLAYER2
+	discs [2]bits256
+	// cells has a bit set for every cell of the board
+	cells   bits256
+	heights []int
+	// cols are the columns played so far, in order
+	cols []int
+	wide bool
+}
+
+func NewBitboard2D(opts MatchOpts) (*Bitboard2D, error) {
+	if opts.W <= 0 || opts.H <= 0 || opts.A <= 0 {
+		return nil, fmt.Errorf("invalid match options: dimensions and alignment must be positive")
+	}
+	if opts.A > opts.W && opts.A > opts.H {
+		return nil, fmt.Errorf("invalid match options: alignment must be less than or equal to some dimension")
+	}
+	if opts.Variant != VARIANT_CLASSIC || opts.NoGravity || opts.Exact || opts.WrapW || opts.WrapH ||
+		opts.Players > 2 || opts.Mask != nil || opts.RandomMask != nil || opts.Scoring {
+		return nil, fmt.Errorf("invalid match options: bitboards only play classic Connect-Four rules")
+	}
+	if opts.W*(opts.H+1) > 64*len(bits256{}) {
+		return nil, fmt.Errorf("invalid match options: board is too big for a bitboard")
+	}
+	var cells bits256
+	for col := range opts.W {
+		for row := range opts.H {
+			i := col*(opts.H+1) + row
+			cells[i/64] |= 1 << uint(i%64)
+		}
+	}
+	return &Bitboard2D{
+		Opts:    opts,
+		cells:   cells,
+		heights: make([]int, opts.W),
+		cols:    make([]int, 0, opts.W*opts.H),
+		wide:    opts.W*(opts.H+1) > 64,
+	}, nil
+}
+
+// BitboardFromMatch returns a bitboard with the moves of m played on it. Pie rule swaps are
+// skipped, since they change who plays each color but not the board
+func BitboardFromMatch(m *Match2D) (*Bitboard2D, error) {
+	b, err := NewBitboard2D(m.Opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, move := range m.Moves {
+		if move.Kind == MOVE_KIND_SWAP {
+			continue
+		}
+		if _, err := b.Play(move.Cell[1]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *Bitboard2D) bit(row, col int) int {
+	return col*(b.Opts.H+1) + row
+}
+
+func (b *Bitboard2D) has(who, row, col int) bool {
+	i := b.bit(row, col)
+	return b.discs[who][i/64]&(1<<uint(i%64)) != 0
+}
+
+// MoveCount returns the number of discs on the board
+func (b *Bitboard2D) MoveCount() int {
+	return len(b.cols)
+}
+
+// turn returns the index in discs of the player to move
+func (b *Bitboard2D) turn() int {
+	if (len(b.cols)%2 == 0) == b.Opts.Starts1 {
+		return 0
+	}
+	return 1
+}
+
+// Turn returns the slot of the player to move
+func (b *Bitboard2D) Turn() Slot {
+	return Slot(b.turn() + 1)
+}
+
+// At returns the slot at p, with rows numbered top-down like Match2D.Board
+func (b *Bitboard2D) At(p Point) Slot {
+	row := b.Opts.H - 1 - p.Row
+	for who := range b.discs {
+		if b.has(who, row, p.Col) {
+			return Slot(who + 1)
+		}
+	}
+	return SLOT_EMPTY
+}
+
+func (b *Bitboard2D) CanPlay(col int) bool {
+	return !b.Gameover && col >= 0 && col < b.Opts.W && b.heights[col] < b.Opts.H
+}
+
+// Play drops a disc of the player to move in col. It returns the same result as
+// Match2D.RegisterMove would for that move
+func (b *Bitboard2D) Play(col int) (GameoverResult, error) {
+	if b.Gameover {
+		return nil, fmt.Errorf("game is over")
+	}
+	if col < 0 || col >= b.Opts.W {
+		return nil, fmt.Errorf("invalid column")
+	}
+	if b.heights[col] >= b.Opts.H {
+		return nil, fmt.Errorf("invalid move. column is full")
+	}
+	who := b.turn()
+	row := b.heights[col]
+	i := b.bit(row, col)
+	b.discs[who][i/64] |= 1 << uint(i%64)
+	b.heights[col]++
+	b.cols = append(b.cols, col)
+
+	res := b.isGameover(who, row, col)
+	if res != nil {
+		b.Gameover = true
+	}
+	return res, nil
+}
+
+// Undo takes back the last move
+func (b *Bitboard2D) Undo() {
+	if len(b.cols) == 0 {
+		return
+	}
+	col := b.cols[len(b.cols)-1]
+	b.cols = b.cols[:len(b.cols)-1]
+	b.heights[col]--
+	i := b.bit(b.heights[col], col)
+	who := b.turn()
+	b.discs[who][i/64] &^= 1 << uint(i%64)
+	b.Gameover = false
+}
+
+// shifts are the bit distances between neighbouring cells along each line direction, in the
+// order of lineDirections(2): horizontal, vertical, and both diagonals
+func (b *Bitboard2D) shifts() [4]int {
+	h := b.Opts.H
+	return [4]int{h + 1, 1, h + 2, h}
+}
+
+// HasAlignment reports whether the player with slot s has A discs in a row anywhere on the board
+func (b *Bitboard2D) HasAlignment(s Slot) bool {
+	return b.alignment(b.discs[s-1])
+}
+
+// CanStillAlign reports whether the player with slot s has a line left with none of the
+// opponent's discs on it
+func (b *Bitboard2D) CanStillAlign(s Slot) bool {
+	enemy := b.discs[2-s]
+	return b.alignment(bits256{
+		b.cells[0] &^ enemy[0], b.cells[1] &^ enemy[1], b.cells[2] &^ enemy[2], b.cells[3] &^ enemy[3],
+	})
+}
+
+func (b *Bitboard2D) alignment(x bits256) bool {
+	for _, shift := range b.shifts() {
+		if b.wide {
+			if alignment256(x, shift, b.Opts.A) {
+				return true
+			}
+		} else if alignment64(x[0], shift, b.Opts.A) {
+			return true
+		}
+	}
+	return false
+}
+
+// alignment64 reports whether x has a run of a set bits, each shift bits apart. Runs are grown
+// by doubling, so that it takes log2(a) shift-and-AND steps
+func alignment64(x uint64, shift, a int) bool {
+	run := x
+	n := 1
+	for n*2 <= a {
+		run &= run >> uint(n*shift)
+		n *= 2
+	}
+	if n < a {
+		run &= run >> uint((a-n)*shift)
+	}
+	return run != 0
+}
+
+func alignment256(x bits256, shift, a int) bool {
+	run := x
+	n := 1
+	for n*2 <= a {
+		run = run.and(run.shr(n * shift))
+		n *= 2
+	}
+	if n < a {
+		run = run.and(run.shr((a - n) * shift))
+	}
+	return !run.isZero()
+}
+
+// isGameover checks the move of player who at row, col. Since the game stops at the first
+// alignment, any alignment on the board must go through the last disc played, so the
+// shift-and-AND check is enough to tell whether the move won. Only then are the lines traced.
+func (b *Bitboard2D) isGameover(who, row, col int) GameoverResult {
+	if b.HasAlignment(Slot(who + 1)) {
+		var lines []Line
+		for _, dir := range lineDirections(2) {
+			line := b.getVictoryLine(who, row, col, dir)
+			if line != nil {
+				lines = append(lines, line)
+			}
+		}
+		return GameoverResult{"resType": RESULT_TYPE_WON, "lines": lines}
+	}
+	if len(b.cols) >= b.Opts.W*b.Opts.H {
+		return GameoverResult{"resType": RESULT_TYPE_DRAW, "reason": DRAW_REASON_BOARD_FULL}
+	}
+	if !b.CanStillAlign(SLOT_PLAYER1) && !b.CanStillAlign(SLOT_PLAYER2) {
+		return GameoverResult{"resType": RESULT_TYPE_DRAW, "reason": DRAW_REASON_NO_LINES_LEFT}
+	}
+	return nil
+}
+
+// getVictoryLine follows MatchND.getVictoryLine, with dir given as row (bottom-up) and column
+func (b *Bitboard2D) getVictoryLine(who, row, col int, dir PointND) Line {
+	h := b.Opts.H
+	line := Line{{Row: h - 1 - row, Col: col}}
+	for _, sign := range []int{1, -1} {
+		r, c := row, col
+		for {
+			r += sign * dir[0]
+			c += sign * dir[1]
+			if r < 0 || r >= h || c < 0 || c >= b.Opts.W || !b.has(who, r, c) {
+				break
+			}
+			line = append(line, Point{Row: h - 1 - r, Col: c})
+		}
+	}
+	if len(line) >= b.Opts.A {
+		return line
+	}
+	return nil
+}
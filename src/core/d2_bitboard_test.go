@@ -0,0 +1,176 @@
+package core
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// playRandomGame plays the same random game on a Match2D and a Bitboard2D, and fails on the
+// first move where they disagree
+func playRandomGame(t *testing.T, rng *rand.Rand, opts MatchOpts) {
+	match, err := NewMatch2D("p1", "p2", opts)
+	if err != nil {
+		t.Fatal("unexpected err in match creation: ", err)
+	}
+	match.Started = true
+	bb, err := NewBitboard2D(opts)
+	if err != nil {
+		t.Fatal("unexpected err in bitboard creation: ", err)
+	}
+
+	for i := 0; !match.Gameover; i++ {
+		// out of range and full columns are tried on purpose
+		col := rng.Intn(opts.W+2) - 1
+		pid := match.getCurrPlayerID()
+		want, wantErr := match.RegisterMove(Move{Col: col, RegisteredAt: time.Now()}, pid)
+		got, gotErr := bb.Play(col)
+		if (wantErr == nil) != (gotErr == nil) {
+			t.Fatalf("%+v move %d col %d: match err %v, bitboard err %v", opts, i, col, wantErr, gotErr)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("%+v move %d col %d: match res %v, bitboard res %v", opts, i, col, want, got)
+		}
+	}
+	for r := range opts.H {
+		for c := range opts.W {
+			if match.Board[r][c] != bb.At(Point{Row: r, Col: c}) {
+				t.Fatalf("%+v: boards differ at row %d col %d", opts, r, c)
+			}
+		}
+	}
+}
+
+func TestBitboard2D_MatchesMatch2D(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	configs := []MatchOpts{
+		{W: 7, H: 6, A: 4, Starts1: true},
+		{W: 7, H: 6, A: 4, Starts1: false},
+		{W: 3, H: 3, A: 3, Starts1: true},
+		{W: 8, H: 7, A: 5, Starts1: true},   // exactly 64 bits
+		{W: 9, H: 7, A: 4, Starts1: true},   // first size past a single word
+		{W: 15, H: 15, A: 5, Starts1: true}, // largest board
+		{W: 15, H: 3, A: 15, Starts1: false},
+		{W: 4, H: 12, A: 6, Starts1: true},
+	}
+	for _, opts := range configs {
+		for range 200 {
+			playRandomGame(t, rng, opts)
+		}
+	}
+}
+
+func TestBitboard2D_Undo(t *testing.T) {
+	bb, _ := NewBitboard2D(MatchOpts{W: 7, H: 6, A: 4, Starts1: true})
+	for _, col := range []int{0, 1, 0, 1, 0, 1} {
+		if _, err := bb.Play(col); err != nil {
+			t.Fatal("unexpected err: ", err)
+		}
+	}
+	res, _ := bb.Play(0)
+	if res == nil || res["resType"] != RESULT_TYPE_WON {
+		t.Fatalf("expected a win, got %v", res)
+	}
+
+	bb.Undo()
+	if bb.Gameover || bb.MoveCount() != 6 || bb.At(Point{Row: 2, Col: 0}) != SLOT_EMPTY {
+		t.Fatal("expected the winning move to be taken back")
+	}
+	if bb.Turn() != SLOT_PLAYER1 {
+		t.Fatalf("expected player 1 to move, got %v", bb.Turn())
+	}
+	if res, _ := bb.Play(2); res != nil {
+		t.Fatalf("expected the game to go on, got %v", res)
+	}
+}
+
+func TestBitboardFromMatch(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+	for i, col := range []int{3, 3, 4, 2} {
+		pid := "p1"
+		if i%2 != 0 {
+			pid = "p2"
+		}
+		if _, err := match.RegisterMove(Move{Col: col}, pid); err != nil {
+			t.Fatal("unexpected err: ", err)
+		}
+	}
+
+	bb, err := BitboardFromMatch(match)
+	if err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if bb.At(Point{Row: 4, Col: 3}) != SLOT_PLAYER2 || bb.At(Point{Row: 5, Col: 4}) != SLOT_PLAYER1 {
+		t.Fatal("bitboard does not hold the match position")
+	}
+	if bb.Turn() != SLOT_PLAYER1 {
+		t.Fatalf("expected player 1 to move, got %v", bb.Turn())
+	}
+}
+
+// benchGame is a 7x6 game with no alignment until its last move, which wins
+var benchGame = []int{3, 3, 4, 4, 2, 2, 0, 6, 6, 5, 5, 1, 0, 0, 1, 1, 5, 6, 2, 2, 4, 3}
+
+func benchPosition(b *testing.B, opts MatchOpts, moves []int) (*Match2D, *Bitboard2D) {
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+	for _, col := range moves {
+		if _, err := match.RegisterMove(Move{Col: col}, match.getCurrPlayerID()); err != nil {
+			b.Fatal("unexpected err: ", err)
+		}
+	}
+	bb, err := BitboardFromMatch(match)
+	if err != nil {
+		b.Fatal("unexpected err: ", err)
+	}
+	return match, bb
+}
+
+func BenchmarkIsGameover2D(b *testing.B) {
+	match, _ := benchPosition(b, MatchOpts{W: 7, H: 6, A: 4, Starts1: true}, benchGame[:len(benchGame)-1])
+	cell := match.Moves[len(match.Moves)-1].Cell
+	b.ResetTimer()
+	for range b.N {
+		match.isGameover(cell)
+	}
+}
+
+func BenchmarkBitboard2D_HasAlignment(b *testing.B) {
+	_, bb := benchPosition(b, MatchOpts{W: 7, H: 6, A: 4, Starts1: true}, benchGame[:len(benchGame)-1])
+	b.ResetTimer()
+	for range b.N {
+		bb.HasAlignment(SLOT_PLAYER1)
+	}
+}
+
+func BenchmarkBitboard2D_HasAlignmentWide(b *testing.B) {
+	_, bb := benchPosition(b, MatchOpts{W: 15, H: 15, A: 5, Starts1: true}, benchGame[:len(benchGame)-1])
+	b.ResetTimer()
+	for range b.N {
+		bb.HasAlignment(SLOT_PLAYER1)
+	}
+}
+
+func BenchmarkMatch2D_ReplayGame(b *testing.B) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	for range b.N {
+		match, _ := NewMatch2D("p1", "p2", opts)
+		match.Started = true
+		for _, col := range benchGame {
+			match.RegisterMove(Move{Col: col}, match.getCurrPlayerID())
+		}
+	}
+}
+
+func BenchmarkBitboard2D_ReplayGame(b *testing.B) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	for range b.N {
+		bb, _ := NewBitboard2D(opts)
+		for _, col := range benchGame {
+			bb.Play(col)
+		}
+	}
+}
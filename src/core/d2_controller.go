@@ -1,25 +1,19 @@
 package core
 
 import (
-	"connectx/src/errs"
 	"connectx/src/types"
-	"sync"
 	"time"
 
 	"fmt"
-	"strings"
-
-	"github.com/google/uuid"
 )
 
 type MatchController2D struct {
-	Matches      map[string]*Match2D
-	MatchesMutex sync.Mutex
+	MatchController[*Match2D]
 }
 
 func NewMatchController2D() *MatchController2D {
 	return &MatchController2D{
-		Matches: make(map[string]*Match2D),
+		MatchController: MatchController[*Match2D]{Matches: make(map[string]*Match2D)},
 	}
 }
 
@@ -27,73 +21,50 @@ func (c *MatchController2D) CreateMatch(p1ID string, opts MatchOpts) (string, er
 	if err := validMatchOptions(opts); err != nil {
 		return "", fmt.Errorf("invalid match options: %s", err.Error())
 	}
+	if opts.Mask == nil && opts.RandomMask != nil {
+		opts.Mask = RandomMask2D(opts.W, opts.H, *opts.RandomMask)
+	}
 
 	m, err := NewMatch2D(p1ID, "", opts)
 	if err != nil {
 		return "", err
 	}
-
-	id := uuid.New().String()
-	c.MatchesMutex.Lock()
-	c.Matches[id] = m
-	c.MatchesMutex.Unlock()
-	return id, nil
-}
-
-func (c *MatchController2D) JoinMatch(playerID string, matchID string) (*Match2D, bool, error) {
-	c.MatchesMutex.Lock()
-	defer c.MatchesMutex.Unlock()
-	match, ok := c.Matches[matchID]
-	if !ok {
-		return nil, false, errs.ErrNotFound
-	}
-	if match.P2.ID != "" {
-		if match.P1.ID != playerID && match.P2.ID != playerID {
-			return nil, false, errs.ErrUnjoinable
-		}
-		return match, false, nil
-	}
-
-	//first time that user2 joins
-	match.P2.ID = playerID
-	match.Started = true
-	match.StartedAt = time.Now()
-	return match, true, nil
+	return c.addMatch(m), nil
 }
 
 func validMatchOptions(opts MatchOpts) error {
-	errs := []string{}
-	if opts.W < 3 || opts.W > 15 {
-		errs = append(errs, "invalid W")
+	if opts.Variant != VARIANT_CLASSIC && opts.Variant != VARIANT_POPOUT {
+		return fmt.Errorf("invalid variant")
 	}
-	if opts.H < 3 || opts.H > 15 {
-		errs = append(errs, "invalid H")
+	if err := validPlayers(opts.Players, opts.Variant); err != nil {
+		return err
 	}
-	if opts.A < 3 || opts.A > 15 {
-		errs = append(errs, "invalid A")
+	if err := validBot(opts.Bot); err != nil {
+		return err
 	}
-	if opts.A > opts.W && opts.A > opts.H {
-		errs = append(errs, "A cant be bigger than W nor H")
+	if opts.RandomMask != nil {
+		if err := opts.RandomMask.valid(); err != nil {
+			return err
+		}
 	}
-	errStr := strings.Join(errs, ", ")
-	if errStr != "" {
-		return fmt.Errorf("%s", errStr)
+	if opts.NoGravity {
+		if opts.Variant == VARIANT_POPOUT {
+			return fmt.Errorf("PopOut needs gravity")
+		}
+		//up to a go board, for Gomoku
+		return validBoardOptions([]int{opts.W, opts.H}, []string{"W", "H"}, 19, opts.A, false)
 	}
-	return nil
-
+	return validBoardOptions([]int{opts.W, opts.H}, []string{"W", "H"}, 15, opts.A, false)
 }
 
-func (c *MatchController2D) RegisterMove(userID string, pl types.RegisterMovePL) (*Match2D, GameoverResult, error) {
-	c.MatchesMutex.Lock()
-	m, ok := c.Matches[pl.MatchID]
-	c.MatchesMutex.Unlock()
-	if !ok {
-		return nil, nil, errs.ErrNotFound
-	}
-	move := Move{Col: pl.Col, RegisteredAt: time.Now()}
-	res, err := m.RegisterMove(move, userID)
-	if err != nil {
-		return nil, nil, err
+func (c *MatchController2D) RegisterMove(userID string, pl types.RegisterMovePL, read func(m *Match2D)) (*Match2D, GameoverResult, error) {
+	//swaps have a message of their own
+	kind := MOVE_KIND(pl.Kind)
+	if kind != MOVE_KIND_DROP && kind != MOVE_KIND_POP {
+		return nil, nil, fmt.Errorf("invalid move. unknown move kind")
 	}
-	return m, res, nil
+	return c.do(pl.MatchID, func(m *Match2D) (GameoverResult, error) {
+		move := Move{Col: pl.Col, Row: pl.Row, Kind: kind, RegisteredAt: time.Now()}
+		return m.RegisterMove(move, userID)
+	}, read)
 }
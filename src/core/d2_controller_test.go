@@ -2,7 +2,9 @@ package core
 
 import (
 	"connectx/src/types"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMatchController2D_CreateMatch(t *testing.T) {
@@ -46,28 +48,28 @@ func TestMatchController2D_JoinMatch(t *testing.T) {
 	matchID, _ := c.CreateMatch(p1ID, opts)
 
 	// Test joining a valid match
-	match, isFirst, err := c.JoinMatch(p2ID, matchID)
+	match, isFirst, err := c.JoinMatch(p2ID, matchID, nil)
 	if err != nil {
 		t.Fatalf("JoinMatch failed: %v", err)
 	}
 	if !isFirst {
 		t.Fatal("Expected isFirst to be true for the first time joiner")
 	}
-	if match.P2.ID != p2ID {
-		t.Fatalf("P2.ID was not set correctly: got %s, want %s", match.P2.ID, p2ID)
+	if match.Players[1].ID != p2ID {
+		t.Fatalf("Players[1].ID was not set correctly: got %s, want %s", match.Players[1].ID, p2ID)
 	}
 	if !match.Started {
 		t.Fatal("Match should be started after the second player joins")
 	}
 
 	// Test joining a match that is already full
-	_, _, err = c.JoinMatch("player3", matchID)
+	_, _, err = c.JoinMatch("player3", matchID, nil)
 	if err == nil {
 		t.Fatal("Expected an error when joining a full match, but got nil")
 	}
 
 	// Test joining a non-existent match
-	_, _, err = c.JoinMatch(p2ID, "non-existent-match")
+	_, _, err = c.JoinMatch(p2ID, "non-existent-match", nil)
 	if err == nil {
 		t.Fatal("Expected an error when joining a non-existent match, but got nil")
 	}
@@ -79,29 +81,146 @@ func TestMatchController2D_RegisterMove(t *testing.T) {
 	p2ID := "player2"
 	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
 	matchID, _ := c.CreateMatch(p1ID, opts)
-	c.JoinMatch(p2ID, matchID)
+	c.JoinMatch(p2ID, matchID, nil)
 
 	// Test a valid move
 	pl := types.RegisterMovePL{MatchID: matchID, Col: 0}
-	_, _, err := c.RegisterMove(p1ID, pl)
+	_, _, err := c.RegisterMove(p1ID, pl, nil)
 	if err != nil {
 		t.Fatalf("RegisterMove failed for a valid move: %v", err)
 	}
 
 	// Test a move for the wrong player
-	_, _, err = c.RegisterMove(p1ID, pl)
+	_, _, err = c.RegisterMove(p1ID, pl, nil)
 	if err == nil {
 		t.Fatal("Expected an error when the wrong player tries to move, but got nil")
 	}
 }
 
+func TestMatchController2D_RegisterMove_Kind(t *testing.T) {
+	c := NewMatchController2D()
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Pie: true}
+	matchID, _ := c.CreateMatch("player1", opts)
+	c.JoinMatch("player2", matchID, nil)
+	c.RegisterMove("player1", types.RegisterMovePL{MatchID: matchID, Col: 3}, nil)
+
+	// swaps only go through their own message, and unknown kinds are no drops
+	for _, kind := range []MOVE_KIND{MOVE_KIND_SWAP, 7, -1} {
+		pl := types.RegisterMovePL{MatchID: matchID, Col: 0, Kind: int(kind)}
+		if _, _, err := c.RegisterMove("player2", pl, nil); err == nil {
+			t.Fatalf("expected an error for a move of kind %d, but got nil", kind)
+		}
+	}
+	if _, _, err := c.RegisterMove("player2", types.RegisterMovePL{MatchID: matchID, Col: 0}, nil); err != nil {
+		t.Fatalf("RegisterMove failed for a valid drop: %v", err)
+	}
+}
+
 func TestMatchController2D_RegisterMove_NotFound(t *testing.T) {
 	c := NewMatchController2D()
 	p1ID := "player1"
 
 	pl := types.RegisterMovePL{MatchID: "non-existent-match", Col: 0}
-	_, _, err := c.RegisterMove(p1ID, pl)
+	_, _, err := c.RegisterMove(p1ID, pl, nil)
 	if err == nil {
 		t.Fatal("Expected an error when registering a move for a non-existent match, but got nil")
 	}
-}
\ No newline at end of file
+}
+
+func TestMatchController2D_FlagFall(t *testing.T) {
+	c := NewMatchController2D()
+	timeouts := make(chan GameoverResult, 1)
+	c.OnTimeout = func(matchID string, m *Match2D, res GameoverResult) {
+		timeouts <- res
+	}
+	p1ID := "player1"
+	p2ID := "player2"
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 50}
+	matchID, _ := c.CreateMatch(p1ID, opts)
+	match, _, _ := c.JoinMatch(p2ID, matchID, nil)
+
+	select {
+	case res := <-timeouts:
+		if res["resType"] != RESULT_TYPE_TIMEOUT {
+			t.Fatalf("expected result type to be TIMEOUT, got %v", res["resType"])
+		}
+		if res["loserID"] != p1ID {
+			t.Fatalf("expected %s to lose on time, got %v", p1ID, res["loserID"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the match to end on time, but it did not")
+	}
+
+	match.mu.Lock()
+	defer match.mu.Unlock()
+	if !match.Gameover {
+		t.Fatal("expected the match to be over after the flag fell")
+	}
+}
+
+func TestMatchController2D_CreateMatch_NoGravityLimits(t *testing.T) {
+	c := NewMatchController2D()
+	if _, err := c.CreateMatch("player1", MatchOpts{W: 19, H: 19, A: 5, NoGravity: true}); err != nil {
+		t.Fatalf("expected a 19x19 board without gravity to be valid, got %v", err)
+	}
+	if _, err := c.CreateMatch("player1", MatchOpts{W: 19, H: 19, A: 5}); err == nil {
+		t.Fatal("expected a 19x19 board with gravity to be invalid")
+	}
+	if _, err := c.CreateMatch("player1", MatchOpts{W: 7, H: 6, A: 4, NoGravity: true, Variant: VARIANT_POPOUT}); err == nil {
+		t.Fatal("expected PopOut without gravity to be invalid")
+	}
+}
+
+func TestMatchController2D_JoinMatch_ThreePlayers(t *testing.T) {
+	c := NewMatchController2D()
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Players: 3}
+	matchID, err := c.CreateMatch("player1", opts)
+	if err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+
+	match, _, _ := c.JoinMatch("player2", matchID, nil)
+	if match.Started {
+		t.Fatal("Match should wait for the third player")
+	}
+	match, isFirst, err := c.JoinMatch("player3", matchID, nil)
+	if err != nil || !isFirst {
+		t.Fatalf("expected player3 to take the last seat, got %v, %v", isFirst, err)
+	}
+	if !match.Started || match.Players[2].ID != "player3" {
+		t.Fatal("Match should be started once every seat is taken")
+	}
+
+	if _, err := c.CreateMatch("player1", MatchOpts{W: 7, H: 6, A: 4, Players: 5}); err == nil {
+		t.Fatal("expected 5 players to be invalid")
+	}
+	if _, err := c.CreateMatch("player1", MatchOpts{W: 7, H: 6, A: 4, Players: 3, Variant: VARIANT_POPOUT}); err == nil {
+		t.Fatal("expected PopOut with 3 players to be invalid")
+	}
+}
+
+func TestMatchController2D_CreateMatch_RandomMask(t *testing.T) {
+	c := NewMatchController2D()
+	opts := MatchOpts{W: 7, H: 6, A: 4, RandomMask: &RandomMask{Seed: 1, Density: 0.2}}
+	matchID, err := c.CreateMatch("player1", opts)
+	if err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if mask := c.Matches[matchID].Opts.Mask; !reflect.DeepEqual(mask, RandomMask2D(7, 6, *opts.RandomMask)) {
+		t.Fatalf("expected the mask to be generated from the seed, got %v", mask)
+	}
+	opts.RandomMask.Density = 0.9
+	if _, err := c.CreateMatch("player1", opts); err == nil {
+		t.Fatal("expected an error for a density above 0.5")
+	}
+}
+
+func TestMatchController2D_CreateMatch_Bot(t *testing.T) {
+	c := NewMatchController2D()
+	if _, err := c.CreateMatch("player1", MatchOpts{W: 7, H: 6, A: 4, Bot: &BotOpts{Level: BOT_LEVEL_HARD}}); err != nil {
+		t.Fatalf("expected a hard bot to be valid, got %v", err)
+	}
+	if _, err := c.CreateMatch("player1", MatchOpts{W: 7, H: 6, A: 4, Bot: &BotOpts{Level: 7}}); err == nil {
+		t.Fatal("expected an unknown bot level to be invalid")
+	}
+}
@@ -2,51 +2,57 @@ package core
 
 import (
 	"fmt"
+	"slices"
 	"time"
 )
 
-type Slot int
-type RESULT_TYPE int
-
-const (
-	RESULT_TYPE_WON RESULT_TYPE = iota
-	RESULT_TYPE_DRAW
-	RESULT_TYPE_TIMEOUT
-)
-const (
-	SLOT_EMPTY Slot = iota
-	SLOT_PLAYER1
-	SLOT_PLAYER2
-)
-
-type Direction struct {
-	Row int
-	Col int
-}
-
 type Move struct {
-	Col          int
+	Col int
+	// Row is counted from the top, like Match2D.Board. Moves only choose it on boards without
+	// gravity; otherwise it is where the disc landed
+	Row  int
+	Kind MOVE_KIND
+	// Seat is the seat of the mover. It is set by the engine
+	Seat int
+	// Completed holds the lines the move completed, in scoring matches
+	Completed    []Line
 	RegisteredAt time.Time
+	// TimeSpent is the time charged to the mover's clock for this move, in milliseconds
+	TimeSpent int64
 }
 type MatchOpts struct {
-	W       int   `json:"w"`
-	H       int   `json:"h"`
-	A       int   `json:"a"`
-	Starts1 bool  `json:"starts1"`
-	T0      int64 `json:"t0"`
-	TD      int64 `json:"td"`
-}
-
-func (d *Direction) OtherSide() Direction {
-	r := 0
-	if d.Row != 0 {
-		r = -d.Row
-	}
-	c := 0
-	if d.Col != 0 {
-		c = -d.Col
-	}
-	return Direction{Row: r, Col: c}
+	W       int  `json:"w"`
+	H       int  `json:"h"`
+	A       int  `json:"a"`
+	Starts1 bool `json:"starts1"`
+	// Players is the number of seats, from 2 to 4. 0 means 2
+	Players int `json:"players"`
+	// T0 is the initial time of each player, in milliseconds. 0 means untimed
+	T0 int64 `json:"t0"`
+	// TD is the increment added to the mover's clock after each move, in milliseconds
+	TD      int64   `json:"td"`
+	Variant VARIANT `json:"variant"`
+	// NoGravity lets moves address any empty (row, col), for Gomoku, tic-tac-toe and other m,n,k-games
+	NoGravity bool `json:"no_gravity"`
+	// Exact makes only lines of exactly A discs win, as in Gomoku's exact-five rule. Otherwise
+	// longer lines (overlines) win too
+	Exact bool `json:"exact"`
+	// WrapW makes lines continue across the left and right edges
+	WrapW bool `json:"wrap_w"`
+	// WrapH makes lines continue across the top and bottom edges
+	WrapH bool `json:"wrap_h"`
+	// Mask, if set, has the layout of Match2D.Board and marks its blocked cells, to shape the
+	// board, e.g. as a diamond
+	Mask [][]bool `json:"mask"`
+	// RandomMask, if set and Mask is not, makes CreateMatch generate Mask from a seed
+	RandomMask *RandomMask `json:"random_mask"`
+	// Pie lets the second player swap after the first move, to take over the first player's disc
+	Pie bool `json:"pie"`
+	// Scoring plays on until the board is full, and the player who completed the most lines of A
+	// discs wins
+	Scoring bool `json:"scoring"`
+	// Bot, if set, seats server-side bots in every seat but the creator's
+	Bot *BotOpts `json:"bot"`
 }
 
 type Point struct {
@@ -54,79 +60,125 @@ type Point struct {
 	Col int
 }
 type Line []Point
-type Player struct {
-	ID       string
-	TimeLeft int64
+
+// Match2D is a Connect-Four board: discs fall down each column, to the highest row index.
+// The engine stores the board bottom-up, so Board[H-1] is a view of its row 0.
+// With NoGravity, discs stay where they are played instead
+type Match2D struct {
+	*MatchND
+	Board [][]Slot
+	Opts  MatchOpts
 }
 
-func createBoard2D(W, H int) [][]Slot {
-	board := make([][]Slot, H)
-	for i := 0; i < H; i++ {
-		board[i] = make([]Slot, W)
+func (opts MatchOpts) toND() MatchOptsND {
+	gravity := 0
+	if opts.NoGravity {
+		gravity = NO_GRAVITY
 	}
-	return board
+	return MatchOptsND{
+		Dims:      []int{opts.H, opts.W},
+		Gravity:   gravity,
+		AxisNames: []string{"row", "column"},
+		A:         opts.A,
+		Starts1:   opts.Starts1,
+		Players:   opts.Players,
+		T0:        opts.T0,
+		TD:        opts.TD,
+		Variant:   opts.Variant,
+		Exact:     opts.Exact,
+		Wrap:      []bool{opts.WrapH, opts.WrapW},
+		Blocked:   opts.blocked(),
+		Pie:       opts.Pie,
+		Scoring:   opts.Scoring,
+	}
+}
+
+// blocked flattens Mask in the engine order, where rows go bottom-up
+func (opts MatchOpts) blocked() []bool {
+	if opts.Mask == nil {
+		return nil
+	}
+	blocked := make([]bool, 0, opts.W*opts.H)
+	for i := range opts.Mask {
+		blocked = append(blocked, opts.Mask[len(opts.Mask)-1-i]...)
+	}
+	return blocked
+}
+
+func (opts MatchOpts) validMask() bool {
+	if opts.Mask == nil {
+		return true
+	}
+	if len(opts.Mask) != opts.H {
+		return false
+	}
+	for _, row := range opts.Mask {
+		if len(row) != opts.W {
+			return false
+		}
+	}
+	return true
 }
 
 func NewMatch2D(p1ID, p2ID string, opts MatchOpts) (*Match2D, error) {
-	if opts.W <= 0 || opts.H <= 0 || opts.A <= 0 {
-		return nil, fmt.Errorf("invalid match options: dimensions and alignment must be positive")
+	if !opts.validMask() {
+		return nil, fmt.Errorf("invalid match options: mask must have the layout of the board")
 	}
-	if opts.A > opts.W && opts.A > opts.H {
-		return nil, fmt.Errorf("invalid match options: alignment must be less than or equal to width or height")
+	nd, err := NewMatchND(p1ID, p2ID, opts.toND())
+	if err != nil {
+		return nil, err
 	}
 	return &Match2D{
-		Opts: opts,
-		P1: Player{
-			ID:       p1ID,
-			TimeLeft: opts.T0,
-		},
-		P2: Player{
-			ID:       p2ID,
-			TimeLeft: opts.T0,
-		},
-		Board: createBoard2D(opts.W, opts.H),
-		Moves: make([]Move, 0),
+		MatchND: nd,
+		Board:   opts.board(nd.Cells),
+		Opts:    opts,
 	}, nil
 }
 
-type Match2D struct {
-	Board     [][]Slot
-	P1        Player
-	P2        Player
-	Opts      MatchOpts
-	Moves     []Move
-	StartedAt time.Time
-	Started   bool
-	Gameover  bool
+// board returns the rows of cells, top row first, as views of the engine's bottom-up rows
+func (opts MatchOpts) board(cells []Slot) [][]Slot {
+	board := make([][]Slot, opts.H)
+	for i := range opts.H {
+		r := opts.H - 1 - i
+		board[i] = cells[r*opts.W : (r+1)*opts.W]
+	}
+	return board
+}
+
+// Copy returns an untimed copy of the match, for bots and analysis. See MatchND.Copy
+func (m *Match2D) Copy() *Match2D {
+	nd := m.MatchND.Copy()
+	opts := m.Opts
+	opts.T0, opts.TD = 0, 0
+	return &Match2D{MatchND: nd, Board: opts.board(nd.Cells), Opts: opts}
 }
 
 type Match2DDTO struct {
-	Board     [][]int `json:"board"`
-	P1        *PlayerDTO
-	P2        *PlayerDTO
+	Board [][]int `json:"board"`
+	// Players holds a player per seat, nil for the seats nobody took yet
+	Players []*PlayerDTO
+	// Scores holds the score of each seat, in scoring matches
+	Scores    []int
 	Opts      MatchOpts
 	Moves     []Move
 	StartedAt time.Time
 	Started   bool
 	Gameover  bool
+	// DrawOfferedBy is the ID of the player with a pending draw offer, if any
+	DrawOfferedBy string
+	// TakebackRequestedBy is the ID of the player with a pending takeback request, if any
+	TakebackRequestedBy string
+}
+
+func (m *Match2D) DTO(userModel DTOGetter) (any, error) {
+	return m.ToDTO(userModel)
 }
 
 func (m *Match2D) ToDTO(userModel DTOGetter) (*Match2DDTO, error) {
-	p1, err := userModel.GetUserDTO(m.P1.ID)
+	players, err := m.playerDTOs(userModel)
 	if err != nil {
 		return nil, err
 	}
-	p1.TimeLeft = m.P1.TimeLeft
-
-	var p2 *PlayerDTO
-	if m.P2.ID != "" {
-		var err error
-		p2, err = userModel.GetUserDTO(m.P2.ID)
-		if err != nil {
-			return nil, err
-		}
-		p2.TimeLeft = m.P2.TimeLeft
-	}
 
 	// Convert board
 	boardDTO := make([][]int, len(m.Board))
@@ -139,119 +191,84 @@ func (m *Match2D) ToDTO(userModel DTOGetter) (*Match2DDTO, error) {
 
 	return &Match2DDTO{
 		Board:     boardDTO,
-		P1:        p1,
-		P2:        p2,
+		Players:   players,
+		Scores:    slices.Clone(m.Scores),
 		Opts:      m.Opts,
-		Moves:     m.Moves,
+		Moves:     m.moves(),
 		StartedAt: m.StartedAt,
 		Started:   m.Started,
 		Gameover:  m.Gameover,
-	}, nil
-}
-
 
-type GameoverResult map[string]any
-
-func (m *Match2D) getCurrPlayerID() string {
-	if (len(m.Moves)%2 == 0) == m.Opts.Starts1 {
-		return m.P1.ID
-	}
-	return m.P2.ID
+		DrawOfferedBy:       m.DrawOfferedBy,
+		TakebackRequestedBy: m.TakebackRequestedBy,
+	}, nil
 }
 
-func (m *Match2D) getRow(col int) int {
-	for i := m.Opts.H - 1; i >= 0; i-- {
-		if m.Board[i][col] == SLOT_EMPTY {
-			return i
-		}
+// moves returns the moves of the match in board coordinates
+func (m *Match2D) moves() []Move {
+	moves := make([]Move, len(m.Moves))
+	for i, move := range m.Moves {
+		moves[i] = m.BoardMove(move)
 	}
-	return -1
+	return moves
 }
 
-func (m *Match2D) GetEnemyID(pid string) string {
-	if pid != m.P1.ID && pid != m.P2.ID {
-		return ""
+// BoardMove converts a move of the engine, such as one of MatchND.LegalMoves, to board coordinates
+func (m *Match2D) BoardMove(move MoveND) Move {
+	return Move{
+		Col:          move.Cell[1],
+		Row:          m.Opts.H - 1 - move.Cell[0],
+		Kind:         move.Kind,
+		Seat:         move.Seat,
+		Completed:    m.boardLines(move.Completed),
+		RegisteredAt: move.RegisteredAt,
+		TimeSpent:    move.TimeSpent,
 	}
-	if pid == m.P1.ID {
-		return m.P2.ID
-	}
-	return m.P1.ID
 }
-func (m *Match2D) getVictoryLine(row, col int, dir Direction) Line {
-	v := m.Board[row][col]
-	if v == SLOT_EMPTY {
-		return nil
 
+// toLines converts the winning lines found by the engine to board coordinates
+func (m *Match2D) toLines(res GameoverResult) {
+	linesND, ok := res["lines"].([]LineND)
+	if !ok {
+		return
 	}
-	line := Line{Point{Row: row, Col: col}}
-
-	for i, j := row+dir.Row, col+dir.Col; i >= 0 && i < m.Opts.H && j >= 0 && j < m.Opts.W && m.Board[i][j] == v; i, j = i+dir.Row, j+dir.Col {
-		line = append(line, Point{Row: i, Col: j})
-	}
-
-	otherDir := dir.OtherSide()
-	for i, j := row+otherDir.Row, col+otherDir.Col; i >= 0 && i < m.Opts.H && j >= 0 && j < m.Opts.W && m.Board[i][j] == v; i, j = i+otherDir.Row, j+otherDir.Col {
-		line = append(line, Point{Row: i, Col: j})
-	}
-
-	if len(line) >= m.Opts.A {
-		return line
-	}
-	return nil
+	res["lines"] = m.boardLines(linesND)
 }
 
-func (m *Match2D) isGameover(row, col int) GameoverResult {
-	dirs := []Direction{
-		{Row: 1, Col: 0},
-		{Row: 0, Col: 1},
-		{Row: 1, Col: 1},
-		{Row: 1, Col: -1},
+// boardLines converts lines found by the engine to board coordinates
+func (m *Match2D) boardLines(linesND []LineND) []Line {
+	if linesND == nil {
+		return nil
 	}
-	var lines []Line
-	for _, dir := range dirs {
-		line := m.getVictoryLine(row, col, dir)
-		if line != nil {
-			lines = append(lines, line)
+	lines := make([]Line, len(linesND))
+	for i, lineND := range linesND {
+		for _, p := range lineND {
+			lines[i] = append(lines[i], Point{Row: m.Opts.H - 1 - p[0], Col: p[1]})
 		}
 	}
+	return lines
+}
 
-	if len(lines) > 0 {
-		return GameoverResult{"resType": RESULT_TYPE_WON, "lines": lines}
-	}
-
-	if len(m.Moves) == m.Opts.H*m.Opts.W {
-		return GameoverResult{"resType": RESULT_TYPE_DRAW}
+// LastCompleted returns the lines completed by the last move of a scoring match
+func (m *Match2D) LastCompleted() []Line {
+	if len(m.Moves) == 0 {
+		return nil
 	}
-
-	return nil
+	return m.boardLines(m.Moves[len(m.Moves)-1].Completed)
 }
 
 func (m *Match2D) RegisterMove(move Move, pid string) (GameoverResult, error) {
-	if m.Gameover {
-		return nil, fmt.Errorf("game is over")
-	}
-	if !m.Started {
-		return nil, fmt.Errorf("match has not started yet")
-	}
-	if move.Col < 0 || move.Col >= m.Opts.W {
-		return nil, fmt.Errorf("invalid column")
+	if move.Kind == MOVE_KIND_SWAP {
+		return m.Swap(pid, move.RegisteredAt)
 	}
-	currPID := m.getCurrPlayerID()
-	if currPID != pid {
-		return nil, fmt.Errorf("not your turn")
+	play := m.Play
+	if move.Kind == MOVE_KIND_POP {
+		play = m.Pop
 	}
-	row := m.getRow(move.Col)
-	if row <= -1 {
-		return nil, fmt.Errorf("invalid move. column is full")
-	}
-	m.Board[row][move.Col] = SLOT_PLAYER1
-	if currPID == m.P2.ID {
-		m.Board[row][move.Col] = SLOT_PLAYER2
-	}
-	m.Moves = append(m.Moves, move)
-	res := m.isGameover(row, move.Col)
-	if res != nil {
-		m.Gameover = true
+	res, err := play(PointND{m.Opts.H - 1 - move.Row, move.Col}, move.RegisteredAt, pid)
+	if err != nil {
+		return nil, err
 	}
+	m.toLines(res)
 	return res, nil
 }
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMatch2D_RegisterMove_Win(t *testing.T) {
@@ -89,3 +91,409 @@ func TestMatch2D_RegisterMove_Gameover(t *testing.T) {
 		t.Fatal("expected an error for making a move on a game that is over, but got nil")
 	}
 }
+
+func TestMatch2D_RegisterMove_Clock(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 10000, TD: 1000}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+	match.StartedAt = time.Now()
+
+	_, err := match.RegisterMove(Move{Col: 0, RegisteredAt: match.StartedAt.Add(3 * time.Second)}, "p1")
+	if err != nil {
+		t.Fatalf("unexpected error on move 1: %v", err)
+	}
+	if match.Players[0].TimeLeft != 8000 {
+		t.Fatalf("expected p1 to have 8000ms left, got %d", match.Players[0].TimeLeft)
+	}
+	if match.Players[1].TimeLeft != 10000 {
+		t.Fatalf("expected p2 clock to be untouched, got %d", match.Players[1].TimeLeft)
+	}
+
+	res, err := match.RegisterMove(Move{Col: 1, RegisteredAt: match.StartedAt.Add(14 * time.Second)}, "p2")
+	if err != nil {
+		t.Fatalf("unexpected error on move 2: %v", err)
+	}
+	if res == nil || res["resType"] != RESULT_TYPE_TIMEOUT {
+		t.Fatalf("expected a timeout, got %v", res)
+	}
+	if !match.Gameover {
+		t.Fatal("expected game to be over after a timeout")
+	}
+	if len(match.Moves) != 1 {
+		t.Fatalf("expected the late move not to be registered, got %d moves", len(match.Moves))
+	}
+}
+
+func TestMatch2D_Resign(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	if _, err := match.Resign("p3", time.Now()); err == nil {
+		t.Fatal("expected an error for resigning as a non player, but got nil")
+	}
+	res, err := match.Resign("p2", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error resigning: %v", err)
+	}
+	if res["resType"] != RESULT_TYPE_RESIGN || res["loserID"] != "p2" {
+		t.Fatalf("expected p2 to lose by resignation, got %v", res)
+	}
+	if !match.Gameover {
+		t.Fatal("expected game to be over after resigning")
+	}
+	if _, err := match.Resign("p1", time.Now()); err == nil {
+		t.Fatal("expected an error for resigning a game that is over, but got nil")
+	}
+}
+
+func TestMatch2D_DrawOffer(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	if err := match.OfferDraw("p1"); err != nil {
+		t.Fatalf("unexpected error offering a draw: %v", err)
+	}
+	if err := match.OfferDraw("p2"); err == nil {
+		t.Fatal("expected an error for offering a draw while another offer is pending, but got nil")
+	}
+	if _, err := match.AcceptDraw("p1"); err == nil {
+		t.Fatal("expected an error for accepting your own draw offer, but got nil")
+	}
+
+	// the offerer moving keeps the offer alive, the opponent moving lets it expire
+	if _, err := match.RegisterMove(Move{Col: 0}, "p1"); err != nil {
+		t.Fatalf("unexpected error on move 1: %v", err)
+	}
+	if match.DrawOfferedBy != "p1" {
+		t.Fatal("expected the draw offer to still be pending after the offerer moved")
+	}
+	if _, err := match.RegisterMove(Move{Col: 0}, "p2"); err != nil {
+		t.Fatalf("unexpected error on move 2: %v", err)
+	}
+	if _, err := match.AcceptDraw("p2"); err == nil {
+		t.Fatal("expected an error for accepting an expired draw offer, but got nil")
+	}
+
+	if err := match.OfferDraw("p2"); err != nil {
+		t.Fatalf("unexpected error offering a draw: %v", err)
+	}
+	res, err := match.AcceptDraw("p1")
+	if err != nil {
+		t.Fatalf("unexpected error accepting a draw: %v", err)
+	}
+	if res["resType"] != RESULT_TYPE_DRAW || res["reason"] != DRAW_REASON_AGREEMENT {
+		t.Fatalf("expected an agreed draw, got %v", res)
+	}
+	if !match.Gameover {
+		t.Fatal("expected game to be over after accepting a draw")
+	}
+}
+
+func TestMatch2D_Takeback(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 10000, TD: 1000}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+	match.StartedAt = time.Now()
+
+	if err := match.RequestTakeback("p1"); err == nil {
+		t.Fatal("expected an error for taking back before moving, but got nil")
+	}
+	if _, err := match.RegisterMove(Move{Col: 3, RegisteredAt: match.StartedAt.Add(3 * time.Second)}, "p1"); err != nil {
+		t.Fatalf("unexpected error on move 1: %v", err)
+	}
+	if err := match.RequestTakeback("p1"); err != nil {
+		t.Fatalf("unexpected error requesting a takeback: %v", err)
+	}
+	if err := match.ApproveTakeback("p1", time.Now()); err == nil {
+		t.Fatal("expected an error for approving your own takeback, but got nil")
+	}
+	if err := match.ApproveTakeback("p2", match.StartedAt.Add(5*time.Second)); err != nil {
+		t.Fatalf("unexpected error approving a takeback: %v", err)
+	}
+	if len(match.Moves) != 0 {
+		t.Fatalf("expected the move to be taken back, got %d moves", len(match.Moves))
+	}
+	if match.Board[opts.H-1][3] != SLOT_EMPTY {
+		t.Fatal("expected the slot of the taken back move to be empty")
+	}
+	if match.Players[0].TimeLeft != 10000 {
+		t.Fatalf("expected p1 to get back the time spent, got %d", match.Players[0].TimeLeft)
+	}
+	if match.getCurrPlayerID() != "p1" {
+		t.Fatal("expected p1 to be on the move after the takeback")
+	}
+
+	// the clock restarts from the takeback, not from the previous move
+	if _, err := match.RegisterMove(Move{Col: 2, RegisteredAt: match.StartedAt.Add(6 * time.Second)}, "p1"); err != nil {
+		t.Fatalf("unexpected error on move after takeback: %v", err)
+	}
+	if match.Players[0].TimeLeft != 10000 {
+		t.Fatalf("expected p1 to be charged 1000ms, got %d left", match.Players[0].TimeLeft)
+	}
+}
+
+func TestMatch2D_Takeback_ChargesThinkingTime(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 10000, TD: 1000}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+	match.StartedAt = time.Now()
+	at := func(ms int) time.Time { return match.StartedAt.Add(time.Duration(ms) * time.Millisecond) }
+
+	// p2 thinks from p1's move until they approve the takeback, and gets none of it back
+	match.RegisterMove(Move{Col: 3, RegisteredAt: at(1000)}, "p1")
+	match.RequestTakeback("p1")
+	if err := match.ApproveTakeback("p2", at(4000)); err != nil {
+		t.Fatalf("unexpected error approving a takeback: %v", err)
+	}
+	if match.Players[0].TimeLeft != 10000 || match.Players[1].TimeLeft != 7000 {
+		t.Fatalf("expected clocks of 10000 and 7000, got %d and %d", match.Players[0].TimeLeft, match.Players[1].TimeLeft)
+	}
+
+	// p1 asks on the move, after p2 replied: both moves are undone, but p1 is charged for the
+	// time they thought since p2's move
+	match.RegisterMove(Move{Col: 3, RegisteredAt: at(5000)}, "p1")
+	match.RegisterMove(Move{Col: 3, RegisteredAt: at(7000)}, "p2")
+	match.RequestTakeback("p1")
+	if err := match.ApproveTakeback("p2", at(10000)); err != nil {
+		t.Fatalf("unexpected error approving a takeback: %v", err)
+	}
+	if len(match.Moves) != 0 || match.getCurrPlayerID() != "p1" {
+		t.Fatalf("expected both moves to be taken back, got %d moves", len(match.Moves))
+	}
+	if match.Players[0].TimeLeft != 7000 || match.Players[1].TimeLeft != 7000 {
+		t.Fatalf("expected clocks of 7000 and 7000, got %d and %d", match.Players[0].TimeLeft, match.Players[1].TimeLeft)
+	}
+}
+
+func TestMatch2D_RegisterMove_NoLinesLeft(t *testing.T) {
+	// only the two rows can hold 4 in a row
+	opts := MatchOpts{W: 4, H: 2, A: 4, Starts1: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	var res GameoverResult
+	for i, col := range []int{0, 1, 0, 1} {
+		pid := "p1"
+		if i%2 != 0 {
+			pid = "p2"
+		}
+		var err error
+		res, err = match.RegisterMove(Move{Col: col}, pid)
+		if err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+		if i < 3 && res != nil {
+			t.Fatalf("expected the game to go on after move %d, got %v", i, res)
+		}
+	}
+
+	if res["resType"] != RESULT_TYPE_DRAW || res["reason"] != DRAW_REASON_NO_LINES_LEFT {
+		t.Fatalf("expected a draw with no lines left, got %v", res)
+	}
+	if !match.Gameover {
+		t.Fatal("expected game to be over")
+	}
+}
+
+func TestMatch2D_RegisterMove_BoardFull(t *testing.T) {
+	// p1 keeps a line alive until p2 fills the last cell
+	opts := MatchOpts{W: 4, H: 1, A: 3, Starts1: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	var res GameoverResult
+	for i, col := range []int{0, 3, 1, 2} {
+		pid := "p1"
+		if i%2 != 0 {
+			pid = "p2"
+		}
+		res, _ = match.RegisterMove(Move{Col: col}, pid)
+	}
+	if res["resType"] != RESULT_TYPE_DRAW || res["reason"] != DRAW_REASON_BOARD_FULL {
+		t.Fatalf("expected a draw on a full board, got %v", res)
+	}
+}
+
+func TestMatch2D_RegisterMove_NoGravity(t *testing.T) {
+	opts := MatchOpts{W: 15, H: 15, A: 5, Starts1: true, NoGravity: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	// p1 plays a diagonal in the middle of the board, p2 plays along the top row
+	moves := []Move{
+		{Row: 5, Col: 5}, {Row: 0, Col: 0},
+		{Row: 6, Col: 6}, {Row: 0, Col: 1},
+		{Row: 7, Col: 7}, {Row: 0, Col: 2},
+		{Row: 8, Col: 8}, {Row: 0, Col: 3},
+	}
+	for i, move := range moves {
+		res, err := match.RegisterMove(move, match.getCurrPlayerID())
+		if err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+		if res != nil {
+			t.Fatalf("expected the game to go on after move %d, got %v", i, res)
+		}
+	}
+	if match.Board[5][5] != SLOT_PLAYER1 || match.Board[0][3] != SLOT_PLAYER2 {
+		t.Fatal("expected discs to stay where they were played")
+	}
+	if _, err := match.RegisterMove(Move{Row: 0, Col: 0}, "p1"); err == nil {
+		t.Fatal("expected an error for playing a taken cell")
+	}
+
+	res, err := match.RegisterMove(Move{Row: 9, Col: 9}, "p1")
+	if err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if res["resType"] != RESULT_TYPE_WON {
+		t.Fatalf("expected p1 to win, got %v", res)
+	}
+	lines := res["lines"].([]Line)
+	if len(lines) != 1 || len(lines[0]) != 5 || lines[0][0] != (Point{Row: 9, Col: 9}) {
+		t.Fatalf("expected the diagonal to be the winning line, got %v", lines)
+	}
+}
+
+func TestMatch2D_RegisterMove_ExactOverline(t *testing.T) {
+	for _, exact := range []bool{true, false} {
+		opts := MatchOpts{W: 15, H: 15, A: 5, Starts1: true, NoGravity: true, Exact: exact}
+		match, _ := NewMatch2D("p1", "p2", opts)
+		match.Started = true
+
+		// p1 leaves a gap at column 4 between runs of four and two
+		moves := []Move{
+			{Row: 7, Col: 0}, {Row: 0, Col: 0},
+			{Row: 7, Col: 1}, {Row: 0, Col: 2},
+			{Row: 7, Col: 2}, {Row: 0, Col: 4},
+			{Row: 7, Col: 3}, {Row: 0, Col: 6},
+			{Row: 7, Col: 5}, {Row: 0, Col: 8},
+			{Row: 7, Col: 6}, {Row: 0, Col: 10},
+		}
+		for i, move := range moves {
+			if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+				t.Fatalf("unexpected error on move %d: %v", i, err)
+			}
+		}
+
+		// filling the gap makes a line of seven
+		res, err := match.RegisterMove(Move{Row: 7, Col: 4}, "p1")
+		if err != nil {
+			t.Fatal("unexpected err: ", err)
+		}
+		if exact && res != nil {
+			t.Fatalf("expected an overline not to win with the exact rule, got %v", res)
+		}
+		if !exact && (res == nil || res["resType"] != RESULT_TYPE_WON) {
+			t.Fatalf("expected an overline to win without the exact rule, got %v", res)
+		}
+	}
+}
+
+func TestMatch2D_RegisterMove_WrapW(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, WrapW: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	// p1's bottom row goes from column 5 round to column 1
+	playCols(t, match, []Move{{Col: 5}, {Col: 5}, {Col: 6}, {Col: 6}, {Col: 0}, {Col: 0}})
+	res := playCols(t, match, []Move{{Col: 1}})
+	if res["resType"] != RESULT_TYPE_WON {
+		t.Fatalf("expected p1 to win across the edge, got %v", res)
+	}
+	want := []Line{{{Row: 5, Col: 1}, {Row: 5, Col: 0}, {Row: 5, Col: 6}, {Row: 5, Col: 5}}}
+	if !reflect.DeepEqual(res["lines"], want) {
+		t.Fatalf("expected lines %v, got %v", want, res["lines"])
+	}
+}
+
+func TestMatch2D_Swap(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 10000, Pie: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+	match.StartedAt = time.Now()
+
+	if _, err := match.Swap("p2", time.Now()); err == nil {
+		t.Fatal("expected an error for swapping before the first move")
+	}
+	playCols(t, match, []Move{{Col: 3, RegisteredAt: match.StartedAt.Add(3 * time.Second)}})
+	if _, err := match.Swap("p2", match.StartedAt.Add(4*time.Second)); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+
+	// p2 owns the first disc now, and p1 moves next with the other color
+	if match.Players[0].ID != "p2" || match.getCurrPlayerID() != "p1" {
+		t.Fatalf("expected the seats to be exchanged, got %+v", match.Players)
+	}
+	if match.Players[1].TimeLeft != 7000 || match.Players[0].TimeLeft != 9000 {
+		t.Fatalf("expected the clocks to follow the players, got %+v", match.Players)
+	}
+	playCols(t, match, []Move{{Col: 4, RegisteredAt: match.StartedAt.Add(5 * time.Second)}})
+	if match.Board[5][3] != SLOT_PLAYER1 || match.Board[5][4] != SLOT_PLAYER2 {
+		t.Fatalf("expected p1 to play with the second color, got %v", match.Board)
+	}
+	if _, err := match.Swap("p2", time.Now()); err == nil {
+		t.Fatal("expected an error for swapping after the second move")
+	}
+	b, err := BitboardFromMatch(match)
+	if err != nil || b.MoveCount() != 2 || b.Turn() != SLOT_PLAYER1 {
+		t.Fatalf("expected the bitboard to skip the swap, got %v", err)
+	}
+}
+
+func TestMatch2D_Swap_Takeback(t *testing.T) {
+	match, _ := NewMatch2D("p1", "p2", MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Pie: true})
+	match.Started = true
+	playCols(t, match, []Move{{Col: 3}})
+	match.Swap("p2", time.Now())
+
+	if err := match.RequestTakeback("p2"); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if err := match.ApproveTakeback("p1", time.Now()); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if match.Players[0].ID != "p1" || match.getCurrPlayerID() != "p2" || len(match.Moves) != 1 {
+		t.Fatalf("expected the swap to be undone, got %+v", match.Players)
+	}
+
+	classic, _ := NewMatch2D("p1", "p2", MatchOpts{W: 7, H: 6, A: 4, Starts1: true})
+	classic.Started = true
+	playCols(t, classic, []Move{{Col: 3}})
+	if _, err := classic.Swap("p2", time.Now()); err == nil {
+		t.Fatal("expected an error for swapping without the pie rule")
+	}
+}
+
+func TestMatch2D_RegisterMove_Scoring(t *testing.T) {
+	// p1 fills the bottom row and p2 the top one. Each run of 5 holds 3 lines of 3
+	opts := MatchOpts{W: 5, H: 2, A: 3, Starts1: true, Scoring: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	var res GameoverResult
+	for i, col := range []int{0, 0, 1, 1, 2, 2, 3, 3, 4, 4} {
+		var err error
+		res, err = match.RegisterMove(Move{Col: col}, match.getCurrPlayerID())
+		if err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+		if i < 9 && res != nil {
+			t.Fatalf("expected the game to go on after move %d, got %v", i, res)
+		}
+		if i == 4 {
+			lines := match.LastCompleted()
+			if len(lines) != 1 || lines[0][0] != (Point{Row: 1, Col: 0}) || match.Scores[0] != 1 {
+				t.Fatalf("expected p1 to complete the first bottom line, got %v and scores %v", lines, match.Scores)
+			}
+		}
+	}
+	if res["resType"] != RESULT_TYPE_DRAW || res["reason"] != DRAW_REASON_EQUAL_SCORES {
+		t.Fatalf("expected a draw on equal scores, got %v", res)
+	}
+	if scores := res["scores"].([]int); scores[0] != 3 || scores[1] != 3 {
+		t.Fatalf("expected scores of 3 each, got %v", scores)
+	}
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// columnChars holds the character of each column in 2D move lists, counted from 1 as in the
+// usual Connect-Four notation, where 4453 opens in the middle of a 7x6 board
+const columnChars = "123456789abcdefghij"
+
+// POP_NOTATION prefixes the column of a PopOut pop in 2D move lists
+const POP_NOTATION = "p"
+
+// FormatMoves2D writes moves in the 2D move notation. With gravity, it is a string of column
+// characters, such as 4453, where pops are prefixed with p and swaps are written s. Without
+// gravity, moves are row,col pairs separated by spaces, such as 8,8 7,9, counted from 1 and with
+// rows counted from the top, like Match2D.Board
+func FormatMoves2D(opts MatchOpts, moves []Move) string {
+	tokens := make([]string, len(moves))
+	for i, move := range moves {
+		switch {
+		case move.Kind == MOVE_KIND_SWAP:
+			tokens[i] = SWAP_NOTATION
+		case opts.NoGravity:
+			tokens[i] = formatCoords(move.Row, move.Col)
+		case move.Kind == MOVE_KIND_POP:
+			tokens[i] = POP_NOTATION + columnChars[move.Col:move.Col+1]
+		default:
+			tokens[i] = columnChars[move.Col : move.Col+1]
+		}
+	}
+	if opts.NoGravity {
+		return strings.Join(tokens, " ")
+	}
+	return strings.Join(tokens, "")
+}
+
+// ParseMoves2D parses a move list written by FormatMoves2D, for a board with opts. Spaces are
+// allowed between the moves of boards with gravity too. The parsed moves only tell where the
+// discs were played, so with gravity their Row is left to RegisterMove
+func ParseMoves2D(opts MatchOpts, s string) ([]Move, error) {
+	moves := []Move{}
+	if opts.NoGravity {
+		for _, token := range strings.Fields(s) {
+			if token == SWAP_NOTATION {
+				moves = append(moves, Move{Kind: MOVE_KIND_SWAP})
+				continue
+			}
+			coords, err := parseCoords(token, 2)
+			if err != nil {
+				return nil, err
+			}
+			if coords[0] >= opts.H || coords[1] >= opts.W {
+				return nil, fmt.Errorf("invalid move %q. cell out of the board", token)
+			}
+			moves = append(moves, Move{Row: coords[0], Col: coords[1]})
+		}
+		return moves, nil
+	}
+
+	s = strings.Join(strings.Fields(s), "")
+	for i := 0; i < len(s); i++ {
+		if s[i:i+1] == SWAP_NOTATION {
+			moves = append(moves, Move{Kind: MOVE_KIND_SWAP})
+			continue
+		}
+		kind := MOVE_KIND_DROP
+		if s[i:i+1] == POP_NOTATION && i+1 < len(s) {
+			kind = MOVE_KIND_POP
+			i++
+		}
+		col := strings.IndexByte(columnChars, s[i])
+		if col < 0 || col >= opts.W {
+			return nil, fmt.Errorf("invalid move %q. column out of the board", s[i])
+		}
+		moves = append(moves, Move{Col: col, Kind: kind})
+	}
+	return moves, nil
+}
+
+// Notation returns the moves of the match in the 2D move notation
+func (m *Match2D) Notation() string {
+	return FormatMoves2D(m.Opts, m.moves())
+}
+
+// Position returns the position of the match as a string, such as
+//
+//	7x6 4 7/7/7/3x3/2ox3/xoxo3 o
+//
+// which holds the width and height of the board, A, the rows from the top, and the side to move.
+// Discs are written x, o, y and z for the seats from the first, blocked cells # and runs of
+// empty cells as their length
+func (m *Match2D) Position() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%dx%d %d ", m.Opts.W, m.Opts.H, m.Opts.A)
+	for i, row := range m.Board {
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+		formatCells(&sb, row)
+	}
+	sb.WriteByte(' ')
+	sb.WriteByte(slotChars[m.turn+1])
+	return sb.String()
+}
+
+// NewMatch2DFromPosition creates a match set up at pos, a position string written by
+// Match2D.Position, for test fixtures, puzzles and bug reports. The board size and A come from
+// pos, and its blocked cells replace the mask of opts. The other options come from opts. The
+// match has no moves to take back, and starts once every seat is taken like any other
+func NewMatch2DFromPosition(p1ID, p2ID string, pos string, opts MatchOpts) (*Match2D, error) {
+	fields := strings.Fields(pos)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("invalid position. expected size, alignment, board and side to move")
+	}
+	dims, err := parseDims(fields[0], 2)
+	if err != nil {
+		return nil, err
+	}
+	opts.W, opts.H = dims[0], dims[1]
+	if _, err := fmt.Sscan(fields[1], &opts.A); err != nil {
+		return nil, fmt.Errorf("invalid position. invalid alignment %q", fields[1])
+	}
+	rows := strings.Split(fields[2], "/")
+	if len(rows) != opts.H {
+		return nil, fmt.Errorf("invalid position. expected %d rows", opts.H)
+	}
+	turn, err := parseSlot(fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make([]Slot, opts.W*opts.H)
+	opts.Mask, opts.RandomMask = make([][]bool, opts.H), nil
+	for i, row := range rows {
+		slots, err := parseCells(row, opts.W)
+		if err != nil {
+			return nil, err
+		}
+		//rows go bottom-up in the engine
+		copy(cells[(opts.H-1-i)*opts.W:], slots)
+		opts.Mask[i] = make([]bool, opts.W)
+		for j, s := range slots {
+			opts.Mask[i][j] = s == SLOT_BLOCKED
+		}
+	}
+	m, err := NewMatch2D(p1ID, p2ID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.setPosition(cells, turn); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
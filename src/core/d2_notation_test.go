@@ -0,0 +1,72 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestMatch2D_Notation(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	moves, err := ParseMoves2D(opts, "4453")
+	if err != nil {
+		t.Fatalf("unexpected error parsing moves: %v", err)
+	}
+	for i, move := range moves {
+		if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	if got := match.Notation(); got != "4453" {
+		t.Fatalf("expected notation 4453, got %s", got)
+	}
+	if got := match.Position(); got != "7x6 4 7/7/7/7/3o3/2oxx2 x" {
+		t.Fatalf("unexpected position %s", got)
+	}
+
+	if _, err := ParseMoves2D(opts, "48"); err == nil {
+		t.Fatal("expected an error for a column out of the board")
+	}
+	popout := MatchOpts{W: 7, H: 6, A: 4, Variant: VARIANT_POPOUT}
+	if moves, _ := ParseMoves2D(popout, "4 p4"); len(moves) != 2 || moves[1].Kind != MOVE_KIND_POP || moves[1].Col != 3 {
+		t.Fatalf("expected a drop and a pop in column 4, got %v", moves)
+	}
+	gomoku := MatchOpts{W: 15, H: 15, A: 5, NoGravity: true, Pie: true}
+	if got := FormatMoves2D(gomoku, []Move{{Row: 7, Col: 7}, {Kind: MOVE_KIND_SWAP}, {Row: 6, Col: 8}}); got != "8,8 s 7,9" {
+		t.Fatalf("expected notation 8,8 s 7,9, got %s", got)
+	}
+}
+
+func TestNewMatch2DFromPosition(t *testing.T) {
+	pos := "7x6 4 7/7/#5#/3x3/2ox3/xoxo3 o"
+	match, err := NewMatch2DFromPosition("p1", "p2", pos, MatchOpts{Starts1: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	match.Started = true
+	if got := match.Position(); got != pos {
+		t.Fatalf("expected position %s, got %s", pos, got)
+	}
+	if match.Board[2][0] != SLOT_BLOCKED || match.Board[4][3] != SLOT_PLAYER1 {
+		t.Fatal("expected the board of the position")
+	}
+	if _, err := match.RegisterMove(Move{Col: 3}, "p1"); err == nil {
+		t.Fatal("expected o to be on the move")
+	}
+	if _, err := match.RegisterMove(Move{Col: 3}, "p2"); err != nil {
+		t.Fatalf("unexpected error on move: %v", err)
+	}
+
+	for _, pos := range []string{
+		"7x6 4 7/7/7/7/7/7",
+		"7x6 4 7/7/7/7/7/8 x",
+		"7x6 4 7/7/7/7/3x3/7 x",
+		"7x6 4 7/7/7/7/7/xxxx3 o",
+		"7x6 4 7/7/7/7/7/y6 x",
+	} {
+		if _, err := NewMatch2DFromPosition("p1", "p2", pos, MatchOpts{}); err == nil {
+			t.Errorf("expected an error for position %s", pos)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rules2D are the names of the boolean rules of 2D matches in the Rules tag of records, in the
+// order of formatRules
+var rules2D = []string{"no_gravity", "exact", "wrap_w", "wrap_h", "pie", "scoring"}
+
+// variantNotations holds the Variant tag of each VARIANT
+var variantNotations = []string{"classic", "popout"}
+
+// Record returns the game record of the match. Besides the tags of every record, it has the
+// Variant, the W, H and A of the board, the rules that are set, and the blocked cells of the mask,
+// written like the rows of Match2D.Position
+func (m *Match2D) Record() *Record {
+	tags := []Tag{
+		{Name: "Variant", Value: variantNotations[m.Opts.Variant]},
+		{Name: "W", Value: strconv.Itoa(m.Opts.W)},
+		{Name: "H", Value: strconv.Itoa(m.Opts.H)},
+		{Name: "A", Value: strconv.Itoa(m.Opts.A)},
+	}
+	o := m.Opts
+	if rules := formatRules(rules2D, o.NoGravity, o.Exact, o.WrapW, o.WrapH, o.Pie, o.Scoring); rules != "" {
+		tags = append(tags, Tag{Name: "Rules", Value: rules})
+	}
+	if m.Opts.Mask != nil {
+		rows := make([]string, len(m.Opts.Mask))
+		for i, row := range m.Opts.Mask {
+			var sb strings.Builder
+			formatCells(&sb, maskSlots(row))
+			rows[i] = sb.String()
+		}
+		tags = append(tags, Tag{Name: "Mask", Value: strings.Join(rows, "/")})
+	}
+	return m.newRecord("2D", tags, func(move MoveND) string {
+		return FormatMoves2D(m.Opts, []Move{m.BoardMove(move)})
+	})
+}
+
+// ImportRecord2D replays a 2D record through RegisterMove, and returns the match it records. It
+// fails on the first move that can't be played, and if the match doesn't end like the record says
+func ImportRecord2D(r *Record) (*Match2D, error) {
+	if g := r.Tag("Game"); g != "2D" {
+		return nil, fmt.Errorf("invalid record. expected a 2D game, got %s", g)
+	}
+	var opts MatchOpts
+	var err error
+	if opts.W, err = recordInt(r, "W"); err != nil {
+		return nil, err
+	}
+	if opts.H, err = recordInt(r, "H"); err != nil {
+		return nil, err
+	}
+	if opts.A, err = recordInt(r, "A"); err != nil {
+		return nil, err
+	}
+	if v := r.Tag("Variant"); v != "" {
+		variant := slices.Index(variantNotations, v)
+		if variant < 0 {
+			return nil, fmt.Errorf("invalid record. invalid Variant tag %q", v)
+		}
+		opts.Variant = VARIANT(variant)
+	}
+	rules := recordRules(r)
+	opts.NoGravity, opts.Exact, opts.Pie, opts.Scoring = rules["no_gravity"], rules["exact"], rules["pie"], rules["scoring"]
+	opts.WrapW, opts.WrapH = rules["wrap_w"], rules["wrap_h"]
+	var nd MatchOptsND
+	if err := recordOpts(r, &nd); err != nil {
+		return nil, err
+	}
+	opts.Starts1, opts.T0, opts.TD, opts.Players = nd.Starts1, nd.T0, nd.TD, nd.Players
+	if err := validMatchOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid record. %w", err)
+	}
+	if mask := r.Tag("Mask"); mask != "" {
+		rows := strings.Split(mask, "/")
+		if len(rows) != opts.H {
+			return nil, fmt.Errorf("invalid record. expected %d rows in the Mask tag", opts.H)
+		}
+		opts.Mask = make([][]bool, opts.H)
+		for i, row := range rows {
+			if opts.Mask[i], err = parseMask(row, opts.W); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rp := recordReplay[*Match2D]{
+		newMatch: func() (*Match2D, error) {
+			m, err := NewMatch2D("", "", opts)
+			if err != nil {
+				return nil, fmt.Errorf("invalid record. %w", err)
+			}
+			return m, seatRecordPlayers(m.MatchND, r)
+		},
+		playMove: func(m *Match2D, notation string, at time.Time, pid string) (GameoverResult, error) {
+			moves, err := ParseMoves2D(opts, notation)
+			if err != nil {
+				return nil, err
+			}
+			if len(moves) != 1 {
+				return nil, fmt.Errorf("expected a single move")
+			}
+			moves[0].RegisteredAt = at
+			return m.RegisterMove(moves[0], pid)
+		},
+	}
+	return rp.importRecord(r)
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch2D_Record(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 60000, TD: 1000}
+	match, _ := NewMatch2D("alice", "bob", opts)
+	start := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	match.Started = true
+	match.StartedAt = start
+
+	moves, _ := ParseMoves2D(opts, "4455667")
+	for i, move := range moves {
+		move.RegisteredAt = start.Add(time.Duration(i+1) * time.Second)
+		if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	r := match.Record()
+	if r.Result != "1-0" || r.Tag("Termination") != "line" || r.Tag("TimeControl") != "60000+1000" {
+		t.Fatalf("unexpected record tags %v", r.Tags)
+	}
+	text := r.String()
+	if !strings.Contains(text, `[P2 "bob"]`) || !strings.Contains(text, "1. 4 {[%at 2025-08-01T12:00:01Z]}") {
+		t.Fatalf("unexpected record text:\n%s", text)
+	}
+
+	parsed, err := ParseRecord(text)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the record: %v", err)
+	}
+	imported, err := ImportRecord2D(parsed)
+	if err != nil {
+		t.Fatalf("unexpected error importing the record: %v", err)
+	}
+	if imported.Position() != match.Position() || imported.Notation() != "4455667" {
+		t.Fatalf("expected the imported match to match, got %s", imported.Position())
+	}
+	if imported.Players[0].TimeLeft != match.Players[0].TimeLeft {
+		t.Fatal("expected the clocks to be replayed from the timestamps")
+	}
+
+	// records must end like their moves
+	parsed.Result = "0-1"
+	if _, err := ImportRecord2D(parsed); err == nil {
+		t.Fatal("expected an error for a wrong result")
+	}
+}
+
+func TestImportRecord2D_CommentsAndVariations(t *testing.T) {
+	text := `[Game "2D"]
+[P1 "alice"]
+[P2 "bob"]
+[W "7"]
+[H "6"]
+[A "4"]
+[Result "1/2-1/2"]
+[Termination "agreement"]
+
+{a friendly game} 1. 4 {the usual opening} 4 (3 2. 4 (5) 5) ; the mirror
+2. 5 R2 ( 3 ) 1/2-1/2
+`
+	r, err := ParseRecord(text)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the record: %v", err)
+	}
+	if r.Comment != "a friendly game" || r.Moves[0].Comment != "the usual opening" || r.Moves[1].Comment != "the mirror" {
+		t.Fatalf("unexpected comments %q %v", r.Comment, r.Moves)
+	}
+	if len(r.Moves[1].Variations) != 1 || len(r.Moves[1].Variations[0]) != 3 || len(r.Moves[1].Variations[0][1].Variations) != 1 {
+		t.Fatalf("unexpected variations %v", r.Moves[1].Variations)
+	}
+	// bob can't resign in a drawn game
+	if _, err := ImportRecord2D(r); err == nil || !strings.Contains(err.Error(), "expected result") {
+		t.Fatalf("expected an error for the resignation, got %v", err)
+	}
+
+	r.Moves = r.Moves[:3]
+	if _, err := ImportRecord2D(r); err != nil {
+		t.Fatalf("unexpected error importing the record: %v", err)
+	}
+	// variations are played too
+	r.Moves[1].Variations[0][0].Move = "8"
+	if _, err := ImportRecord2D(r); err == nil {
+		t.Fatal("expected an error for a variation out of the board")
+	}
+
+	for _, text := range []string{"[Game 2D]\n", "1. 4 (", "1. 4 {", "( 4 )", "1. 4 1-0 4"} {
+		if _, err := ParseRecord(text); err == nil {
+			t.Errorf("expected an error parsing %q", text)
+		}
+	}
+}
+
+func TestMatch2D_Record_Swap(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Pie: true}
+	match, _ := NewMatch2D("alice", "bob", opts)
+	match.Started = true
+	moves, _ := ParseMoves2D(opts, "4s141414")
+	playCols(t, match, moves)
+	// the winner is the mover of the last move
+	winner := func(m *Match2D) string { return m.Players[m.Moves[len(m.Moves)-1].Seat].ID }
+	if !match.Gameover || winner(match) != "bob" {
+		t.Fatalf("expected bob to win, got %v", match.Result)
+	}
+
+	r := match.Record()
+	if r.Tag("P1") != "alice" || r.Tag("P2") != "bob" {
+		t.Fatalf("expected the players in their seats at the start, got %v", r.Tags)
+	}
+	parsed, err := ParseRecord(r.String())
+	if err != nil {
+		t.Fatalf("unexpected error parsing the record: %v", err)
+	}
+	imported, err := ImportRecord2D(parsed)
+	if err != nil {
+		t.Fatalf("unexpected error importing the record: %v", err)
+	}
+	if winner(imported) != "bob" || imported.Players[0].ID != "bob" {
+		t.Fatalf("expected bob to win from the first seat, got %v", imported.Players)
+	}
+}
+
+func TestRecord_String_CommentBraces(t *testing.T) {
+	r := &Record{
+		Tags:    []Tag{{Name: "Game", Value: "2D"}},
+		Comment: "{a} game",
+		Moves:   []RecordMove{{Move: "4", Comment: `a } in C:\dir\`}, {Move: "4", Comment: `\} and \\`}},
+		Result:  RESULT_UNFINISHED,
+	}
+	parsed, err := ParseRecord(r.String())
+	if err != nil {
+		t.Fatalf("unexpected error parsing the record: %v", err)
+	}
+	if parsed.Comment != r.Comment || len(parsed.Moves) != 2 {
+		t.Fatalf("expected the record to round-trip, got %q %v", parsed.Comment, parsed.Moves)
+	}
+	for i, move := range parsed.Moves {
+		if move.Comment != r.Moves[i].Comment {
+			t.Errorf("expected comment %q, got %q", r.Moves[i].Comment, move.Comment)
+		}
+	}
+
+	// unescaped backslashes are read as they are
+	parsed, err = ParseRecord(`1. 4 {C:\dir} 4 *`)
+	if err != nil || parsed.Moves[0].Comment != `C:\dir` {
+		t.Fatalf("expected the comment to be kept, got %v %v", parsed, err)
+	}
+}
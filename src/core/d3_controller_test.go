@@ -3,6 +3,7 @@ package core
 import (
 	"connectx/src/types"
 	"testing"
+	"time"
 )
 
 func TestMatchController3D_CreateMatch(t *testing.T) {
@@ -46,28 +47,28 @@ func TestMatchController3D_JoinMatch(t *testing.T) {
 	matchID, _ := c.CreateMatch(p1ID, opts)
 
 	// Test joining a valid match
-	match, isFirst, err := c.JoinMatch(p2ID, matchID)
+	match, isFirst, err := c.JoinMatch(p2ID, matchID, nil)
 	if err != nil {
 		t.Fatalf("JoinMatch failed: %v", err)
 	}
 	if !isFirst {
 		t.Fatal("Expected isFirst to be true for the first time joiner")
 	}
-	if match.P2.ID != p2ID {
-		t.Fatalf("P2.ID was not set correctly: got %s, want %s", match.P2.ID, p2ID)
+	if match.Players[1].ID != p2ID {
+		t.Fatalf("Players[1].ID was not set correctly: got %s, want %s", match.Players[1].ID, p2ID)
 	}
 	if !match.Started {
 		t.Fatal("Match should be started after the second player joins")
 	}
 
 	// Test joining a match that is already full
-	_, _, err = c.JoinMatch("player3", matchID)
+	_, _, err = c.JoinMatch("player3", matchID, nil)
 	if err == nil {
 		t.Fatal("Expected an error when joining a full match, but got nil")
 	}
 
 	// Test joining a non-existent match
-	_, _, err = c.JoinMatch(p2ID, "non-existent-match")
+	_, _, err = c.JoinMatch(p2ID, "non-existent-match", nil)
 	if err == nil {
 		t.Fatal("Expected an error when joining a non-existent match, but got nil")
 	}
@@ -79,17 +80,17 @@ func TestMatchController3D_RegisterMove(t *testing.T) {
 	p2ID := "player2"
 	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true}
 	matchID, _ := c.CreateMatch(p1ID, opts)
-	c.JoinMatch(p2ID, matchID)
+	c.JoinMatch(p2ID, matchID, nil)
 
 	// Test a valid move
 	pl := types.RegisterMove3DPL{MatchID: matchID, Row: 0, Col: 0}
-	_, _, err := c.RegisterMove(p1ID, pl)
+	_, _, err := c.RegisterMove(p1ID, pl, nil)
 	if err != nil {
 		t.Fatalf("RegisterMove failed for a valid move: %v", err)
 	}
 
 	// Test a move for the wrong player
-	_, _, err = c.RegisterMove(p1ID, pl)
+	_, _, err = c.RegisterMove(p1ID, pl, nil)
 	if err == nil {
 		t.Fatal("Expected an error when the wrong player tries to move, but got nil")
 	}
@@ -100,8 +101,56 @@ func TestMatchController3D_RegisterMove_NotFound(t *testing.T) {
 	p1ID := "player1"
 
 	pl := types.RegisterMove3DPL{MatchID: "non-existent-match", Row: 0, Col: 0}
-	_, _, err := c.RegisterMove(p1ID, pl)
+	_, _, err := c.RegisterMove(p1ID, pl, nil)
 	if err == nil {
 		t.Fatal("Expected an error when registering a move for a non-existent match, but got nil")
 	}
-}
\ No newline at end of file
+}
+
+func TestMatchController3D_FlagFall(t *testing.T) {
+	c := NewMatchController3D()
+	timeouts := make(chan GameoverResult3D, 1)
+	c.OnTimeout = func(matchID string, m *Match3D, res GameoverResult3D) {
+		timeouts <- res
+	}
+	p1ID := "player1"
+	p2ID := "player2"
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, T0: 1000}
+	matchID, _ := c.CreateMatch(p1ID, opts)
+	c.JoinMatch(p2ID, matchID, nil)
+
+	// p1 moves in time, so it's p2 who should run out of it
+	pl := types.RegisterMove3DPL{MatchID: matchID, Row: 0, Col: 0}
+	if _, _, err := c.RegisterMove(p1ID, pl, nil); err != nil {
+		t.Fatalf("RegisterMove failed for a valid move: %v", err)
+	}
+
+	select {
+	case res := <-timeouts:
+		if res["loserID"] != p2ID {
+			t.Fatalf("expected %s to lose on time, got %v", p2ID, res["loserID"])
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the match to end on time, but it did not")
+	}
+}
+
+func TestMatchController3D_CreateMatch_AlignmentFitsEveryAxis(t *testing.T) {
+	c := NewMatchController3D()
+	// unlike in 2D, A has to fit along every axis
+	opts := MatchOpts3D{R: 3, C: 10, H: 10, A: 5, Starts1: true}
+
+	if _, err := c.CreateMatch("player1", opts); err == nil {
+		t.Fatal("expected CreateMatch to fail with A bigger than R, but it did not")
+	}
+}
+
+func TestMatchController3D_CreateMatch_InvalidGravity(t *testing.T) {
+	c := NewMatchController3D()
+	if _, err := c.CreateMatch("player1", MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Gravity: GRAVITY_3D_NONE + 1}); err == nil {
+		t.Fatal("expected an error for an invalid gravity")
+	}
+	if _, err := c.CreateMatch("player1", MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Gravity: GRAVITY_3D_NONE}); err != nil {
+		t.Fatalf("expected a Qubic board to be valid, got %v", err)
+	}
+}
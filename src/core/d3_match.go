@@ -2,22 +2,77 @@ package core
 
 import (
 	"fmt"
+	"slices"
 	"time"
 )
 
 type Move3D struct {
-	Col          int
-	Row          int
+	Col int
+	Row int
+	H   int
+	// Kind tells swaps from drops. It is set by the engine, and RegisterMove swaps on MOVE_KIND_SWAP
+	Kind MOVE_KIND
+	// Seat is the seat of the mover. It is set by the engine
+	Seat int
+	// Completed holds the lines the move completed, in scoring matches
+	Completed    []Line3D
 	RegisteredAt time.Time
+	// TimeSpent is the time charged to the mover's clock for this move, in milliseconds
+	TimeSpent int64
 }
 type MatchOpts3D struct {
-	R       int   `json:"r"`
-	C       int   `json:"c"`
-	H       int   `json:"h"`
-	A       int   `json:"a"`
-	Starts1 bool  `json:"starts1"`
-	T0      int64 `json:"t0"`
-	TD      int64 `json:"td"`
+	R       int  `json:"r"`
+	C       int  `json:"c"`
+	H       int  `json:"h"`
+	A       int  `json:"a"`
+	Starts1 bool `json:"starts1"`
+	// Players is the number of seats, from 2 to 4. 0 means 2
+	Players int `json:"players"`
+	// T0 is the initial time of each player, in milliseconds. 0 means untimed
+	T0 int64 `json:"t0"`
+	// TD is the increment added to the mover's clock after each move, in milliseconds
+	TD      int64      `json:"td"`
+	Gravity GRAVITY_3D `json:"gravity"`
+	// WrapR, WrapC and WrapH make lines continue across the edges of their axis
+	WrapR bool `json:"wrap_r"`
+	WrapC bool `json:"wrap_c"`
+	WrapH bool `json:"wrap_h"`
+	// Mask, if set, has the layout of Match3D.Board and marks its blocked cells, to shape the
+	// board, e.g. as a pyramid
+	Mask [][][]bool `json:"mask"`
+	// RandomMask, if set and Mask is not, makes CreateMatch generate Mask from a seed
+	RandomMask *RandomMask `json:"random_mask"`
+	// Pie lets the second player swap after the first move, to take over the first player's disc
+	Pie bool `json:"pie"`
+	// Scoring plays on until the board is full, and the player who completed the most lines of A
+	// discs wins
+	Scoring bool `json:"scoring"`
+	// Bot, if set, seats server-side bots in every seat but the creator's
+	Bot *BotOpts `json:"bot"`
+}
+
+// GRAVITY_3D is the axis discs fall along in a 3D match, towards coordinate 0
+type GRAVITY_3D int
+
+const (
+	GRAVITY_3D_H GRAVITY_3D = iota
+	GRAVITY_3D_ROW
+	GRAVITY_3D_COL
+	// GRAVITY_3D_NONE lets moves take any empty (row, col, h), as in Qubic
+	GRAVITY_3D_NONE
+)
+
+// axis returns the engine axis of g
+func (g GRAVITY_3D) axis() int {
+	switch g {
+	case GRAVITY_3D_ROW:
+		return 0
+	case GRAVITY_3D_COL:
+		return 1
+	case GRAVITY_3D_NONE:
+		return NO_GRAVITY
+	}
+	return 2
 }
 
 type Point3D struct {
@@ -27,77 +82,129 @@ type Point3D struct {
 }
 type Line3D []Point3D
 
-func createBoard3D(R, C, H int) [][][]Slot {
-	board := make([][][]Slot, R)
-	for i := 0; i < R; i++ {
-		board[i] = make([][]Slot, C)
-		for j := 0; j < C; j++ {
-			board[i][j] = make([]Slot, H)
+type GameoverResult3D = GameoverResult
+
+// Match3D is a board of (row, col) sticks, where discs stack up from h = 0. Gravity can also
+// pull along the row or col axis instead, or be off
+type Match3D struct {
+	*MatchND
+	Board [][][]Slot
+	Opts  MatchOpts3D
+}
+
+func (opts MatchOpts3D) toND() MatchOptsND {
+	return MatchOptsND{
+		Dims:      []int{opts.R, opts.C, opts.H},
+		Gravity:   opts.Gravity.axis(),
+		AxisNames: []string{"row", "column", "height"},
+		A:         opts.A,
+		Starts1:   opts.Starts1,
+		Players:   opts.Players,
+		T0:        opts.T0,
+		TD:        opts.TD,
+		Wrap:      []bool{opts.WrapR, opts.WrapC, opts.WrapH},
+		Blocked:   opts.blocked(),
+		Pie:       opts.Pie,
+		Scoring:   opts.Scoring,
+	}
+}
+
+// blocked flattens Mask, whose layout is the engine order
+func (opts MatchOpts3D) blocked() []bool {
+	if opts.Mask == nil {
+		return nil
+	}
+	blocked := make([]bool, 0, opts.R*opts.C*opts.H)
+	for _, layer := range opts.Mask {
+		for _, stick := range layer {
+			blocked = append(blocked, stick...)
 		}
 	}
-	return board
+	return blocked
+}
+
+func (opts MatchOpts3D) validMask() bool {
+	if opts.Mask == nil {
+		return true
+	}
+	if len(opts.Mask) != opts.R {
+		return false
+	}
+	for _, layer := range opts.Mask {
+		if len(layer) != opts.C {
+			return false
+		}
+		for _, stick := range layer {
+			if len(stick) != opts.H {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 func NewMatch3D(p1ID, p2ID string, opts MatchOpts3D) (*Match3D, error) {
-	if opts.R <= 0 || opts.C <= 0 || opts.H <= 0 || opts.A <= 0 {
-		return nil, fmt.Errorf("invalid match options: dimensions and alignment must be positive")
+	if !opts.validMask() {
+		return nil, fmt.Errorf("invalid match options: mask must have the layout of the board")
 	}
-	if opts.A > opts.R && opts.A > opts.C && opts.A > opts.H {
-		return nil, fmt.Errorf("invalid match options: alignment must be less than or equal to any dimension")
+	nd, err := NewMatchND(p1ID, p2ID, opts.toND())
+	if err != nil {
+		return nil, err
 	}
 	return &Match3D{
-		Opts: opts,
-		P1: Player{
-			ID:       p1ID,
-			TimeLeft: opts.T0,
-		},
-		P2: Player{
-			ID:       p2ID,
-			TimeLeft: opts.T0,
-		},
-		Board: createBoard3D(opts.R, opts.C, opts.H),
-		Moves: make([]Move3D, 0),
+		MatchND: nd,
+		Board:   opts.board(nd.Cells),
+		Opts:    opts,
 	}, nil
 }
 
-type Match3D struct {
-	Board     [][][]Slot
-	P1        Player
-	P2        Player
-	Opts      MatchOpts3D
-	Moves     []Move3D
-	StartedAt time.Time
-	Started   bool
-	Gameover  bool
+// board returns the sticks of cells, by row and column, as views of the engine's cells
+func (opts MatchOpts3D) board(cells []Slot) [][][]Slot {
+	board := make([][][]Slot, opts.R)
+	for i := range opts.R {
+		board[i] = make([][]Slot, opts.C)
+		for j := range opts.C {
+			start := (i*opts.C + j) * opts.H
+			board[i][j] = cells[start : start+opts.H]
+		}
+	}
+	return board
+}
+
+// Copy returns an untimed copy of the match, for bots and analysis. See MatchND.Copy
+func (m *Match3D) Copy() *Match3D {
+	nd := m.MatchND.Copy()
+	opts := m.Opts
+	opts.T0, opts.TD = 0, 0
+	return &Match3D{MatchND: nd, Board: opts.board(nd.Cells), Opts: opts}
 }
 
 type Match3DDTO struct {
-	Board     [][][]int `json:"board"`
-	P1        *PlayerDTO
-	P2        *PlayerDTO
+	Board [][][]int `json:"board"`
+	// Players holds a player per seat, nil for the seats nobody took yet
+	Players []*PlayerDTO
+	// Scores holds the score of each seat, in scoring matches
+	Scores    []int
 	Opts      MatchOpts3D
 	Moves     []Move3D
 	StartedAt time.Time
 	Started   bool
 	Gameover  bool
+	// DrawOfferedBy is the ID of the player with a pending draw offer, if any
+	DrawOfferedBy string
+	// TakebackRequestedBy is the ID of the player with a pending takeback request, if any
+	TakebackRequestedBy string
+}
+
+func (m *Match3D) DTO(userModel DTOGetter) (any, error) {
+	return m.ToDTO(userModel)
 }
 
 func (m *Match3D) ToDTO(userModel DTOGetter) (*Match3DDTO, error) {
-	p1, err := userModel.GetUserDTO(m.P1.ID)
+	players, err := m.playerDTOs(userModel)
 	if err != nil {
 		return nil, err
 	}
-	p1.TimeLeft = m.P1.TimeLeft
-
-	var p2 *PlayerDTO
-	if m.P2.ID != "" {
-		var err error
-		p2, err = userModel.GetUserDTO(m.P2.ID)
-		if err != nil {
-			return nil, err
-		}
-		p2.TimeLeft = m.P2.TimeLeft
-	}
 
 	// Convert board
 	boardDTO := make([][][]int, len(m.Board))
@@ -113,168 +220,81 @@ func (m *Match3D) ToDTO(userModel DTOGetter) (*Match3DDTO, error) {
 
 	return &Match3DDTO{
 		Board:     boardDTO,
-		P1:        p1,
-		P2:        p2,
+		Players:   players,
+		Scores:    slices.Clone(m.Scores),
 		Opts:      m.Opts,
-		Moves:     m.Moves,
+		Moves:     m.moves(),
 		StartedAt: m.StartedAt,
 		Started:   m.Started,
 		Gameover:  m.Gameover,
+
+		DrawOfferedBy:       m.DrawOfferedBy,
+		TakebackRequestedBy: m.TakebackRequestedBy,
 	}, nil
 }
 
-
-type GameoverResult3D map[string]any
-
-func (m *Match3D) getCurrPlayerID() string {
-	if (len(m.Moves)%2 == 0) == m.Opts.Starts1 {
-		return m.P1.ID
+// moves returns the moves of the match in board coordinates
+func (m *Match3D) moves() []Move3D {
+	moves := make([]Move3D, len(m.Moves))
+	for i, move := range m.Moves {
+		moves[i] = m.BoardMove(move)
 	}
-	return m.P2.ID
+	return moves
 }
 
-func (m *Match3D) getH(row, col int) int {
-	stick := m.Board[row][col]
-	for h, val := range stick {
-		if val == SLOT_EMPTY {
-			return h
-		}
+// BoardMove converts a move of the engine, such as one of MatchND.LegalMoves, to board coordinates
+func (m *Match3D) BoardMove(move MoveND) Move3D {
+	return Move3D{
+		Row:          move.Cell[0],
+		Col:          move.Cell[1],
+		H:            move.Cell[2],
+		Kind:         move.Kind,
+		Seat:         move.Seat,
+		Completed:    m.boardLines(move.Completed),
+		RegisteredAt: move.RegisteredAt,
+		TimeSpent:    move.TimeSpent,
 	}
-	return m.Opts.H
 }
 
-func (m *Match3D) GetEnemyID(pid string) string {
-	if pid != m.P1.ID && pid != m.P2.ID {
-		return ""
-	}
-	if pid == m.P1.ID {
-		return m.P2.ID
+// toLines converts the winning lines found by the engine to board coordinates
+func (m *Match3D) toLines(res GameoverResult) {
+	linesND, ok := res["lines"].([]LineND)
+	if !ok {
+		return
 	}
-	return m.P1.ID
+	res["lines"] = m.boardLines(linesND)
 }
 
-type Direction3D struct {
-	Row int
-	Col int
-	H   int
-}
-
-func (d *Direction3D) OtherSide() Direction3D {
-	r := 0
-	if d.Row != 0 {
-		r = -d.Row
-	}
-	c := 0
-	if d.Col != 0 {
-		c = -d.Col
-	}
-	h := 0
-	if d.H != 0 {
-		h = -d.H
-	}
-	return Direction3D{Row: r, Col: c, H: h}
-}
-
-func (m *Match3D) getVictoryLine(row, col, h int, dir Direction3D) Line3D {
-	v := m.Board[row][col][h]
-	if v == SLOT_EMPTY {
+// boardLines converts lines found by the engine to board coordinates
+func (m *Match3D) boardLines(linesND []LineND) []Line3D {
+	if linesND == nil {
 		return nil
 	}
-	line := Line3D{Point3D{Row: row, Col: col, H: h}}
-
-	// Check in the given direction
-	for i, j, k := row+dir.Row, col+dir.Col, h+dir.H; i >= 0 && i < m.Opts.R && j >= 0 && j < m.Opts.C && k >= 0 && k < m.Opts.H; i, j, k = i+dir.Row, j+dir.Col, k+dir.H {
-		if m.Board[i][j][k] == v {
-			line = append(line, Point3D{Row: i, Col: j, H: k})
-		} else {
-			break
+	lines := make([]Line3D, len(linesND))
+	for i, lineND := range linesND {
+		for _, p := range lineND {
+			lines[i] = append(lines[i], Point3D{Row: p[0], Col: p[1], H: p[2]})
 		}
 	}
-
-	// Check in the other direction
-	otherDir := dir.OtherSide()
-	for i, j, k := row+otherDir.Row, col+otherDir.Col, h+otherDir.H; i >= 0 && i < m.Opts.R && j >= 0 && j < m.Opts.C && k >= 0 && k < m.Opts.H; i, j, k = i+otherDir.Row, j+otherDir.Col, k+otherDir.H {
-		if m.Board[i][j][k] == v {
-			line = append(line, Point3D{Row: i, Col: j, H: k})
-		} else {
-			break
-		}
-	}
-
-	if len(line) >= m.Opts.A {
-		return line
-	}
-	return nil
+	return lines
 }
-func (m *Match3D) isGameover(row, col, h int) GameoverResult3D {
-	dirs := []Direction3D{
-		// Axis-aligned
-		{Row: 1, Col: 0, H: 0},
-		{Row: 0, Col: 1, H: 0},
-		{Row: 0, Col: 0, H: 1},
-		// Planar diagonals
-		{Row: 1, Col: 1, H: 0},
-		{Row: 1, Col: -1, H: 0},
-		{Row: 1, Col: 0, H: 1},
-		{Row: 1, Col: 0, H: -1},
-		{Row: 0, Col: 1, H: 1},
-		{Row: 0, Col: 1, H: -1},
-		// Space diagonals
-		{Row: 1, Col: 1, H: 1},
-		{Row: 1, Col: 1, H: -1},
-		{Row: 1, Col: -1, H: 1},
-		{Row: -1, Col: 1, H: 1},
-	}
-
-	var lines []Line3D
-	for _, dir := range dirs {
-		line := m.getVictoryLine(row, col, h, dir)
-		if line != nil {
-			lines = append(lines, line)
-		}
-	}
 
-	if len(lines) > 0 {
-		return GameoverResult3D{"resType": RESULT_TYPE_WON, "lines": lines}
-	}
-
-	if len(m.Moves) >= m.Opts.R*m.Opts.H*m.Opts.C {
-		return GameoverResult3D{
-			"resType": RESULT_TYPE_DRAW,
-		}
+// LastCompleted returns the lines completed by the last move of a scoring match
+func (m *Match3D) LastCompleted() []Line3D {
+	if len(m.Moves) == 0 {
+		return nil
 	}
-	return nil
+	return m.boardLines(m.Moves[len(m.Moves)-1].Completed)
 }
 
 func (m *Match3D) RegisterMove(move Move3D, pid string) (GameoverResult3D, error) {
-	if m.Gameover {
-		return nil, fmt.Errorf("game is over")
-	}
-	if !m.Started {
-		return nil, fmt.Errorf("match has not started yet")
-	}
-	if move.Row < 0 || move.Row >= m.Opts.R {
-		return nil, fmt.Errorf("invalid row")
-	}
-	if move.Col < 0 || move.Col >= m.Opts.C {
-		return nil, fmt.Errorf("invalid column")
-	}
-	currPID := m.getCurrPlayerID()
-	if currPID != pid {
-		return nil, fmt.Errorf("not your turn")
+	if move.Kind == MOVE_KIND_SWAP {
+		return m.Swap(pid, move.RegisteredAt)
 	}
-	h := m.getH(move.Row, move.Col)
-	if h >= m.Opts.H {
-		return nil, fmt.Errorf("invalid move. stick is full")
-	}
-	m.Board[move.Row][move.Col][h] = SLOT_PLAYER1
-	if currPID == m.P2.ID {
-		m.Board[move.Row][move.Col][h] = SLOT_PLAYER2
-	}
-	m.Moves = append(m.Moves, move)
-	res := m.isGameover(move.Row, move.Col, h)
-	if res != nil {
-		m.Gameover = true
+	res, err := m.Play(PointND{move.Row, move.Col, move.H}, move.RegisteredAt, pid)
+	if err != nil {
+		return nil, err
 	}
+	m.toLines(res)
 	return res, nil
-}
\ No newline at end of file
+}
@@ -102,3 +102,219 @@ func TestMatch3D_RegisterMove_Gameover(t *testing.T) {
 		t.Fatal("expected an error for making a move on a game that is over, but got nil")
 	}
 }
+
+func TestMatch3D_RegisterMove_Clock(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, T0: 10000, TD: 1000}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	match.Started = true
+	match.StartedAt = time.Now()
+
+	_, err := match.RegisterMove(Move3D{Row: 0, Col: 0, RegisteredAt: match.StartedAt.Add(3 * time.Second)}, "p1")
+	if err != nil {
+		t.Fatalf("unexpected error on move 1: %v", err)
+	}
+	if match.Players[0].TimeLeft != 8000 {
+		t.Fatalf("expected p1 to have 8000ms left, got %d", match.Players[0].TimeLeft)
+	}
+
+	res, err := match.RegisterMove(Move3D{Row: 1, Col: 0, RegisteredAt: match.StartedAt.Add(14 * time.Second)}, "p2")
+	if err != nil {
+		t.Fatalf("unexpected error on move 2: %v", err)
+	}
+	if res == nil || res["resType"] != RESULT_TYPE_TIMEOUT {
+		t.Fatalf("expected a timeout, got %v", res)
+	}
+	if len(match.Moves) != 1 {
+		t.Fatalf("expected the late move not to be registered, got %d moves", len(match.Moves))
+	}
+}
+
+func TestMatch3D_Resign(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true}
+	match, _ := NewMatch3D("p1", "p2", opts)
+
+	if _, err := match.Resign("p1", time.Now()); err == nil {
+		t.Fatal("expected an error for resigning a match that has not started, but got nil")
+	}
+	match.Started = true
+	res, err := match.Resign("p1", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error resigning: %v", err)
+	}
+	if res["resType"] != RESULT_TYPE_RESIGN || res["loserID"] != "p1" {
+		t.Fatalf("expected p1 to lose by resignation, got %v", res)
+	}
+	if _, err := match.RegisterMove(Move3D{Row: 0, Col: 0}, "p1"); err == nil {
+		t.Fatal("expected an error for making a move after resigning, but got nil")
+	}
+}
+
+func TestMatch3D_DeclineDraw(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	match.Started = true
+
+	if err := match.DeclineDraw("p2"); err == nil {
+		t.Fatal("expected an error for declining a draw that was not offered, but got nil")
+	}
+	if err := match.OfferDraw("p1"); err != nil {
+		t.Fatalf("unexpected error offering a draw: %v", err)
+	}
+	if err := match.DeclineDraw("p2"); err != nil {
+		t.Fatalf("unexpected error declining a draw: %v", err)
+	}
+	if match.DrawOfferedBy != "" || match.Gameover {
+		t.Fatal("expected the offer to be discarded and the game to go on")
+	}
+}
+
+func TestMatch3D_Takeback(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	match.Started = true
+
+	moves := []Move3D{{Row: 0, Col: 0}, {Row: 0, Col: 0}, {Row: 1, Col: 1}}
+	for i, move := range moves {
+		pid := "p1"
+		if i%2 != 0 {
+			pid = "p2"
+		}
+		if _, err := match.RegisterMove(move, pid); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+
+	// p2 is on the move, so taking back their last move also takes back p1's reply
+	if err := match.RequestTakeback("p2"); err != nil {
+		t.Fatalf("unexpected error requesting a takeback: %v", err)
+	}
+	if err := match.DenyTakeback("p2"); err == nil {
+		t.Fatal("expected an error for denying your own takeback, but got nil")
+	}
+	if err := match.ApproveTakeback("p1", time.Now()); err != nil {
+		t.Fatalf("unexpected error approving a takeback: %v", err)
+	}
+	if len(match.Moves) != 1 {
+		t.Fatalf("expected 2 moves to be taken back, got %d moves left", len(match.Moves))
+	}
+	if match.Board[0][0][1] != SLOT_EMPTY || match.Board[1][1][0] != SLOT_EMPTY {
+		t.Fatal("expected the slots of the taken back moves to be empty")
+	}
+	if match.Board[0][0][0] != SLOT_PLAYER1 {
+		t.Fatal("expected the first move to be kept")
+	}
+	if match.getCurrPlayerID() != "p2" {
+		t.Fatal("expected p2 to be on the move after the takeback")
+	}
+}
+
+func TestMatch3D_RegisterMove_Qubic(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, Gravity: GRAVITY_3D_NONE}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	match.Started = true
+
+	// p1 plays the main space diagonal, p2 plays along an edge of the bottom layer
+	moves := []Move3D{
+		{Row: 0, Col: 0, H: 0}, {Row: 0, Col: 1, H: 0},
+		{Row: 1, Col: 1, H: 1}, {Row: 0, Col: 2, H: 0},
+		{Row: 2, Col: 2, H: 2}, {Row: 0, Col: 3, H: 0},
+	}
+	for i, move := range moves {
+		if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	if match.Board[2][2][2] != SLOT_PLAYER1 {
+		t.Fatal("expected discs to stay where they were played")
+	}
+	if _, err := match.RegisterMove(Move3D{Row: 1, Col: 1, H: 1}, "p1"); err == nil {
+		t.Fatal("expected an error for playing a taken cell")
+	}
+
+	res, err := match.RegisterMove(Move3D{Row: 3, Col: 3, H: 3}, "p1")
+	if err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if res["resType"] != RESULT_TYPE_WON {
+		t.Fatalf("expected p1 to win, got %v", res)
+	}
+}
+
+func TestMatch3D_RegisterMove_GravityAlongRow(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, Gravity: GRAVITY_3D_ROW}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	match.Started = true
+
+	// the row is ignored: discs fall along it, towards row 0
+	for i, move := range []Move3D{{Row: 3, Col: 1, H: 2}, {Row: 0, Col: 1, H: 2}} {
+		if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	if match.Board[0][1][2] != SLOT_PLAYER1 || match.Board[1][1][2] != SLOT_PLAYER2 {
+		t.Fatal("expected discs to stack up along the row axis")
+	}
+	if _, err := match.RegisterMove(Move3D{Col: 1, H: 4}, "p1"); err == nil {
+		t.Fatal("expected an error for an invalid height")
+	}
+}
+
+func TestMatch3D_RegisterMove_Wrap(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, WrapR: true, WrapC: true}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	match.Started = true
+
+	// p1's diagonal on the floor starts at (2, 0) and goes round the row axis
+	moves := []Move3D{{Row: 2, Col: 0}, {Row: 0, Col: 0}, {Row: 3, Col: 1}, {Row: 0, Col: 1}, {Row: 0, Col: 2}, {Row: 1, Col: 1}}
+	for i, move := range moves {
+		if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	res, err := match.RegisterMove(Move3D{Row: 1, Col: 3}, "p1")
+	if err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if res["resType"] != RESULT_TYPE_WON {
+		t.Fatalf("expected p1 to win across the edges, got %v", res)
+	}
+}
+
+func TestMatch3D_RegisterMove_Scoring(t *testing.T) {
+	opts := MatchOpts3D{R: 3, C: 3, H: 3, A: 3, Starts1: true, Scoring: true}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	match.Started = true
+
+	// p1 completes a stick, and the game goes on
+	moves := []Move3D{
+		{Row: 0, Col: 0}, {Row: 2, Col: 2},
+		{Row: 0, Col: 0}, {Row: 2, Col: 2},
+		{Row: 0, Col: 0},
+	}
+	for i, move := range moves {
+		res, err := match.RegisterMove(move, match.getCurrPlayerID())
+		if err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+		if res != nil {
+			t.Fatalf("expected the game to go on after move %d, got %v", i, res)
+		}
+	}
+	if lines := match.LastCompleted(); len(lines) != 1 || len(lines[0]) != 3 {
+		t.Fatalf("expected p1 to complete the stick, got %v", lines)
+	}
+	if match.Scores[0] != 1 || match.Scores[1] != 0 {
+		t.Fatalf("expected scores [1 0], got %v", match.Scores)
+	}
+
+	// taking the move back takes its line back
+	if err := match.RequestTakeback("p1"); err != nil {
+		t.Fatalf("unexpected error requesting a takeback: %v", err)
+	}
+	if err := match.ApproveTakeback("p2", time.Now()); err != nil {
+		t.Fatalf("unexpected error approving a takeback: %v", err)
+	}
+	if match.Scores[0] != 0 {
+		t.Fatalf("expected p1's score to be taken back, got %v", match.Scores)
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatMoves3D writes moves in the 3D move notation: the coordinates of each move separated by
+// spaces, such as 1,1 2,3, counted from 1. The coordinate along the gravity axis is left out, so
+// moves are row,col pairs on the usual boards and row,col,h triples without gravity. Swaps are
+// written s
+func FormatMoves3D(opts MatchOpts3D, moves []Move3D) string {
+	g := opts.Gravity.axis()
+	tokens := make([]string, len(moves))
+	for i, move := range moves {
+		if move.Kind == MOVE_KIND_SWAP {
+			tokens[i] = SWAP_NOTATION
+			continue
+		}
+		var coords []int
+		for axis, c := range []int{move.Row, move.Col, move.H} {
+			if axis != g {
+				coords = append(coords, c)
+			}
+		}
+		tokens[i] = formatCoords(coords...)
+	}
+	return strings.Join(tokens, " ")
+}
+
+// ParseMoves3D parses a move list written by FormatMoves3D, for a board with opts. The parsed
+// moves only tell where the discs were played, so their coordinate along the gravity axis is
+// left to RegisterMove
+func ParseMoves3D(opts MatchOpts3D, s string) ([]Move3D, error) {
+	g := opts.Gravity.axis()
+	dims := []int{opts.R, opts.C, opts.H}
+	n := len(dims)
+	if g != NO_GRAVITY {
+		n--
+	}
+	moves := []Move3D{}
+	for _, token := range strings.Fields(s) {
+		if token == SWAP_NOTATION {
+			moves = append(moves, Move3D{Kind: MOVE_KIND_SWAP})
+			continue
+		}
+		coords, err := parseCoords(token, n)
+		if err != nil {
+			return nil, err
+		}
+		p := make([]int, len(dims))
+		for axis := range dims {
+			if axis == g {
+				continue
+			}
+			p[axis], coords = coords[0], coords[1:]
+			if p[axis] >= dims[axis] {
+				return nil, fmt.Errorf("invalid move %q. cell out of the board", token)
+			}
+		}
+		moves = append(moves, Move3D{Row: p[0], Col: p[1], H: p[2]})
+	}
+	return moves, nil
+}
+
+// Notation returns the moves of the match in the 3D move notation
+func (m *Match3D) Notation() string {
+	return FormatMoves3D(m.Opts, m.moves())
+}
+
+// Position returns the position of the match as a string, such as
+//
+//	4x4x4 4 xo2,4,4,4/4,4,4,4/4,4,4,4/4,4,4,x3 o
+//
+// which holds R, C and H, A, the rows of the board and the side to move. Each row lists its
+// sticks separated by commas, from column 0, and each stick lists its cells from h = 0. Cells
+// are written like in Match2D.Position
+func (m *Match3D) Position() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%dx%dx%d %d ", m.Opts.R, m.Opts.C, m.Opts.H, m.Opts.A)
+	for i, layer := range m.Board {
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+		for j, stick := range layer {
+			if j > 0 {
+				sb.WriteByte(',')
+			}
+			formatCells(&sb, stick)
+		}
+	}
+	sb.WriteByte(' ')
+	sb.WriteByte(slotChars[m.turn+1])
+	return sb.String()
+}
+
+// NewMatch3DFromPosition creates a match set up at pos, a position string written by
+// Match3D.Position. Like NewMatch2DFromPosition, the board size, A and the blocked cells come
+// from pos, and the other options from opts
+func NewMatch3DFromPosition(p1ID, p2ID string, pos string, opts MatchOpts3D) (*Match3D, error) {
+	fields := strings.Fields(pos)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("invalid position. expected size, alignment, board and side to move")
+	}
+	dims, err := parseDims(fields[0], 3)
+	if err != nil {
+		return nil, err
+	}
+	opts.R, opts.C, opts.H = dims[0], dims[1], dims[2]
+	if _, err := fmt.Sscan(fields[1], &opts.A); err != nil {
+		return nil, fmt.Errorf("invalid position. invalid alignment %q", fields[1])
+	}
+	rows := strings.Split(fields[2], "/")
+	if len(rows) != opts.R {
+		return nil, fmt.Errorf("invalid position. expected %d rows", opts.R)
+	}
+	turn, err := parseSlot(fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make([]Slot, 0, opts.R*opts.C*opts.H)
+	opts.Mask, opts.RandomMask = make([][][]bool, opts.R), nil
+	for i, row := range rows {
+		sticks := strings.Split(row, ",")
+		if len(sticks) != opts.C {
+			return nil, fmt.Errorf("invalid position. expected %d sticks per row", opts.C)
+		}
+		opts.Mask[i] = make([][]bool, opts.C)
+		for j, stick := range sticks {
+			slots, err := parseCells(stick, opts.H)
+			if err != nil {
+				return nil, err
+			}
+			cells = append(cells, slots...)
+			opts.Mask[i][j] = make([]bool, opts.H)
+			for k, s := range slots {
+				opts.Mask[i][j][k] = s == SLOT_BLOCKED
+			}
+		}
+	}
+	m, err := NewMatch3D(p1ID, p2ID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.setPosition(cells, turn); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
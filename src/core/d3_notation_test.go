@@ -0,0 +1,63 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestMatch3D_Notation(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	match.Started = true
+
+	moves, err := ParseMoves3D(opts, "1,1 1,1 4,4")
+	if err != nil {
+		t.Fatalf("unexpected error parsing moves: %v", err)
+	}
+	for i, move := range moves {
+		if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	if got := match.Notation(); got != "1,1 1,1 4,4" {
+		t.Fatalf("expected notation 1,1 1,1 4,4, got %s", got)
+	}
+	pos := "4x4x4 4 xo2,4,4,4/4,4,4,4/4,4,4,4/4,4,4,x3 o"
+	if got := match.Position(); got != pos {
+		t.Fatalf("expected position %s, got %s", pos, got)
+	}
+
+	qubic := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Gravity: GRAVITY_3D_NONE}
+	if moves, _ := ParseMoves3D(qubic, "1,2,3"); len(moves) != 1 || moves[0].Row != 0 || moves[0].Col != 1 || moves[0].H != 2 {
+		t.Fatalf("expected a move at (0, 1, 2), got %v", moves)
+	}
+	if _, err := ParseMoves3D(opts, "1,2,3"); err == nil {
+		t.Fatal("expected an error for a height on a board with gravity")
+	}
+}
+
+func TestNewMatch3DFromPosition(t *testing.T) {
+	pos := "4x4x4 4 xo2,4,4,4/4,4,4,4/4,4,4,4/4,4,4,x3 o"
+	match, err := NewMatch3DFromPosition("p1", "p2", pos, MatchOpts3D{Starts1: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := match.Position(); got != pos {
+		t.Fatalf("expected position %s, got %s", pos, got)
+	}
+	if match.Board[0][0][1] != SLOT_PLAYER2 || match.getCurrPlayerID() != "p2" {
+		t.Fatal("expected the board and side to move of the position")
+	}
+
+	// a scoring position counts the lines it holds
+	scoring := "3x3x3 3 xxx,3,3/3,3,3/3,o2,oo1 o"
+	match, err = NewMatch3DFromPosition("p1", "p2", scoring, MatchOpts3D{Scoring: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if match.Scores[0] != 1 || match.Scores[1] != 0 {
+		t.Fatalf("expected scores [1 0], got %v", match.Scores)
+	}
+	if _, err := NewMatch3DFromPosition("p1", "p2", scoring, MatchOpts3D{}); err == nil {
+		t.Fatal("expected an error for a complete line")
+	}
+}
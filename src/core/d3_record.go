@@ -0,0 +1,130 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rules3D are the names of the boolean rules of 3D matches in the Rules tag of records, in the
+// order of formatRules
+var rules3D = []string{"wrap_r", "wrap_c", "wrap_h", "pie", "scoring"}
+
+// gravityNotations holds the Gravity tag of each GRAVITY_3D
+var gravityNotations = []string{"h", "row", "col", "none"}
+
+// Record returns the game record of the match. Besides the tags of every record, it has the R,
+// C, H and A of the board, its Gravity, the rules that are set, and the blocked cells of the
+// mask, written like the rows of Match3D.Position
+func (m *Match3D) Record() *Record {
+	tags := []Tag{
+		{Name: "R", Value: strconv.Itoa(m.Opts.R)},
+		{Name: "C", Value: strconv.Itoa(m.Opts.C)},
+		{Name: "H", Value: strconv.Itoa(m.Opts.H)},
+		{Name: "A", Value: strconv.Itoa(m.Opts.A)},
+		{Name: "Gravity", Value: gravityNotations[m.Opts.Gravity]},
+	}
+	o := m.Opts
+	if rules := formatRules(rules3D, o.WrapR, o.WrapC, o.WrapH, o.Pie, o.Scoring); rules != "" {
+		tags = append(tags, Tag{Name: "Rules", Value: rules})
+	}
+	if m.Opts.Mask != nil {
+		rows := make([]string, len(m.Opts.Mask))
+		for i, layer := range m.Opts.Mask {
+			sticks := make([]string, len(layer))
+			for j, stick := range layer {
+				var sb strings.Builder
+				formatCells(&sb, maskSlots(stick))
+				sticks[j] = sb.String()
+			}
+			rows[i] = strings.Join(sticks, ",")
+		}
+		tags = append(tags, Tag{Name: "Mask", Value: strings.Join(rows, "/")})
+	}
+	return m.newRecord("3D", tags, func(move MoveND) string {
+		return FormatMoves3D(m.Opts, []Move3D{m.BoardMove(move)})
+	})
+}
+
+// ImportRecord3D replays a 3D record through RegisterMove, and returns the match it records. It
+// fails on the first move that can't be played, and if the match doesn't end like the record says
+func ImportRecord3D(r *Record) (*Match3D, error) {
+	if g := r.Tag("Game"); g != "3D" {
+		return nil, fmt.Errorf("invalid record. expected a 3D game, got %s", g)
+	}
+	var opts MatchOpts3D
+	var err error
+	if opts.R, err = recordInt(r, "R"); err != nil {
+		return nil, err
+	}
+	if opts.C, err = recordInt(r, "C"); err != nil {
+		return nil, err
+	}
+	if opts.H, err = recordInt(r, "H"); err != nil {
+		return nil, err
+	}
+	if opts.A, err = recordInt(r, "A"); err != nil {
+		return nil, err
+	}
+	if g := r.Tag("Gravity"); g != "" {
+		gravity := slices.Index(gravityNotations, g)
+		if gravity < 0 {
+			return nil, fmt.Errorf("invalid record. invalid Gravity tag %q", g)
+		}
+		opts.Gravity = GRAVITY_3D(gravity)
+	}
+	rules := recordRules(r)
+	opts.WrapR, opts.WrapC, opts.WrapH = rules["wrap_r"], rules["wrap_c"], rules["wrap_h"]
+	opts.Pie, opts.Scoring = rules["pie"], rules["scoring"]
+	var nd MatchOptsND
+	if err := recordOpts(r, &nd); err != nil {
+		return nil, err
+	}
+	opts.Starts1, opts.T0, opts.TD, opts.Players = nd.Starts1, nd.T0, nd.TD, nd.Players
+	if err := validMatchOptions3D(opts); err != nil {
+		return nil, fmt.Errorf("invalid record. %w", err)
+	}
+	if mask := r.Tag("Mask"); mask != "" {
+		rows := strings.Split(mask, "/")
+		if len(rows) != opts.R {
+			return nil, fmt.Errorf("invalid record. expected %d rows in the Mask tag", opts.R)
+		}
+		opts.Mask = make([][][]bool, opts.R)
+		for i, row := range rows {
+			sticks := strings.Split(row, ",")
+			if len(sticks) != opts.C {
+				return nil, fmt.Errorf("invalid record. expected %d sticks per row in the Mask tag", opts.C)
+			}
+			opts.Mask[i] = make([][]bool, opts.C)
+			for j, stick := range sticks {
+				if opts.Mask[i][j], err = parseMask(stick, opts.H); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	rp := recordReplay[*Match3D]{
+		newMatch: func() (*Match3D, error) {
+			m, err := NewMatch3D("", "", opts)
+			if err != nil {
+				return nil, fmt.Errorf("invalid record. %w", err)
+			}
+			return m, seatRecordPlayers(m.MatchND, r)
+		},
+		playMove: func(m *Match3D, notation string, at time.Time, pid string) (GameoverResult, error) {
+			moves, err := ParseMoves3D(opts, notation)
+			if err != nil {
+				return nil, err
+			}
+			if len(moves) != 1 {
+				return nil, fmt.Errorf("expected a single move")
+			}
+			moves[0].RegisteredAt = at
+			return m.RegisterMove(moves[0], pid)
+		},
+	}
+	return rp.importRecord(r)
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatch3D_Record_Eliminations(t *testing.T) {
+	opts := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, Players: 3, T0: 10000}
+	match, _ := NewMatch3D("p1", "p2", opts)
+	start := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	match.Join("p3", start)
+
+	for i, move := range []Move3D{{Row: 0, Col: 0}, {Row: 1, Col: 1}, {Row: 2, Col: 2}, {Row: 0, Col: 0}} {
+		move.RegisteredAt = start.Add(time.Duration(i+1) * time.Second)
+		if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	// p3 resigns out of turn, then p2 runs out of time
+	match.Resign("p3", start.Add(5*time.Second))
+	if res := match.FlagFall(start.Add(time.Minute)); res == nil || !match.Gameover {
+		t.Fatalf("expected p2's flag to fall and end the match, got %v", res)
+	}
+
+	r := match.Record()
+	if r.Result != "1-0-0" || r.Tag("Termination") != "time forfeit" || r.Tag("Gravity") != "h" {
+		t.Fatalf("unexpected record tags %v", r.Tags)
+	}
+	if notation := r.Moves[len(r.Moves)-2].Move + " " + r.Moves[len(r.Moves)-1].Move; notation != "R3 T2" {
+		t.Fatalf("expected the eliminations at the end of the moves, got %s", notation)
+	}
+
+	parsed, err := ParseRecord(r.String())
+	if err != nil {
+		t.Fatalf("unexpected error parsing the record: %v", err)
+	}
+	imported, err := ImportRecord3D(parsed)
+	if err != nil {
+		t.Fatalf("unexpected error importing the record:\n%s\n%v", r.String(), err)
+	}
+	if imported.Position() != match.Position() || !imported.Players[2].Eliminated {
+		t.Fatalf("expected the imported match to match, got %s", imported.Position())
+	}
+
+	// a timeout needs the clock to have run out
+	parsed.Moves[len(parsed.Moves)-1].At = start.Add(5 * time.Second)
+	if _, err := ImportRecord3D(parsed); err == nil {
+		t.Fatal("expected an error for an early timeout")
+	}
+}
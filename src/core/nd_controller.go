@@ -0,0 +1,250 @@
+package core
+
+import (
+	"connectx/src/errs"
+	"connectx/src/types"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EngineMatch is a board configuration of the MatchND engine, such as Match2D or Match3D
+type EngineMatch interface {
+	Engine() *MatchND
+	DTO(userModel DTOGetter) (any, error)
+}
+
+// MatchController keeps the matches of one board configuration, and runs the parts of their
+// lifecycle that don't depend on it: joining, clocks, resignations, draws and takebacks
+type MatchController[M EngineMatch] struct {
+	Matches      map[string]M
+	MatchesMutex sync.Mutex
+	// OnTimeout is called when a match ends because the player to move ran out of time,
+	// without having sent a move. It is called with the match locked, so it must neither block
+	// nor lock the match again
+	OnTimeout func(matchID string, m M, res GameoverResult)
+}
+
+func NewMatchController[M EngineMatch]() *MatchController[M] {
+	return &MatchController[M]{
+		Matches: make(map[string]M),
+	}
+}
+
+func (c *MatchController[M]) addMatch(m M) string {
+	id := uuid.New().String()
+	c.MatchesMutex.Lock()
+	c.Matches[id] = m
+	c.MatchesMutex.Unlock()
+	return id
+}
+
+func (c *MatchController[M]) getMatch(matchID string) (M, error) {
+	c.MatchesMutex.Lock()
+	m, ok := c.Matches[matchID]
+	c.MatchesMutex.Unlock()
+	if !ok {
+		return m, errs.ErrNotFound
+	}
+	return m, nil
+}
+
+// JoinMatch seats playerID in the match. read, if set, is called with the match still locked
+// once playerID joined it
+func (c *MatchController[M]) JoinMatch(playerID string, matchID string, read func(m M)) (M, bool, error) {
+	var zero M
+	c.MatchesMutex.Lock()
+	defer c.MatchesMutex.Unlock()
+	match, ok := c.Matches[matchID]
+	if !ok {
+		return zero, false, errs.ErrNotFound
+	}
+	e := match.Engine()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	joined, err := e.Join(playerID, time.Now())
+	if err != nil {
+		return zero, false, err
+	}
+	if joined && e.Started {
+		//the last seat was just taken
+		c.scheduleFlagFall(matchID, match)
+	}
+	if read != nil {
+		read(match)
+	}
+	return match, joined, nil
+}
+
+// View runs fn on the match while holding its lock, to read it in a consistent state
+func (c *MatchController[M]) View(matchID string, fn func(m M)) error {
+	m, err := c.getMatch(matchID)
+	if err != nil {
+		return err
+	}
+	e := m.Engine()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fn(m)
+	return nil
+}
+
+// do runs fn on the match while holding its lock, and rearms its flag timer afterwards. read, if
+// set, is called before the lock is released if fn succeeded, so that the callers of the actions
+// below read the match in the state fn left it in, and not in the one the flag timer or another
+// player moved it to since
+func (c *MatchController[M]) do(matchID string, fn func(m M) (GameoverResult, error), read func(m M)) (M, GameoverResult, error) {
+	var zero M
+	m, err := c.getMatch(matchID)
+	if err != nil {
+		return zero, nil, err
+	}
+	e := m.Engine()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	res, err := fn(m)
+	if err != nil {
+		return zero, nil, err
+	}
+	c.scheduleFlagFall(matchID, m)
+	if read != nil {
+		read(m)
+	}
+	return m, res, nil
+}
+
+func (c *MatchController[M]) Abandon(userID string, pl types.AbandonMatchPL, read func(m M)) (M, GameoverResult, error) {
+	return c.do(pl.MatchID, func(m M) (GameoverResult, error) {
+		return m.Engine().Resign(userID, time.Now())
+	}, read)
+}
+
+func (c *MatchController[M]) Swap(userID string, pl types.SwapPL, read func(m M)) (M, GameoverResult, error) {
+	return c.do(pl.MatchID, func(m M) (GameoverResult, error) {
+		return m.Engine().Swap(userID, time.Now())
+	}, read)
+}
+
+func (c *MatchController[M]) OfferDraw(userID string, pl types.DrawPL, read func(m M)) (M, error) {
+	m, _, err := c.do(pl.MatchID, func(m M) (GameoverResult, error) {
+		return nil, m.Engine().OfferDraw(userID)
+	}, read)
+	return m, err
+}
+
+func (c *MatchController[M]) AcceptDraw(userID string, pl types.DrawPL, read func(m M)) (M, GameoverResult, error) {
+	return c.do(pl.MatchID, func(m M) (GameoverResult, error) {
+		return m.Engine().AcceptDraw(userID)
+	}, read)
+}
+
+func (c *MatchController[M]) DeclineDraw(userID string, pl types.DrawPL, read func(m M)) (M, error) {
+	m, _, err := c.do(pl.MatchID, func(m M) (GameoverResult, error) {
+		return nil, m.Engine().DeclineDraw(userID)
+	}, read)
+	return m, err
+}
+
+func (c *MatchController[M]) RequestTakeback(userID string, pl types.TakebackPL, read func(m M)) (M, error) {
+	m, _, err := c.do(pl.MatchID, func(m M) (GameoverResult, error) {
+		return nil, m.Engine().RequestTakeback(userID)
+	}, read)
+	return m, err
+}
+
+func (c *MatchController[M]) ApproveTakeback(userID string, pl types.TakebackPL, read func(m M)) (M, error) {
+	m, _, err := c.do(pl.MatchID, func(m M) (GameoverResult, error) {
+		return nil, m.Engine().ApproveTakeback(userID, time.Now())
+	}, read)
+	return m, err
+}
+
+func (c *MatchController[M]) DenyTakeback(userID string, pl types.TakebackPL, read func(m M)) (M, error) {
+	m, _, err := c.do(pl.MatchID, func(m M) (GameoverResult, error) {
+		return nil, m.Engine().DenyTakeback(userID)
+	}, read)
+	return m, err
+}
+
+// scheduleFlagFall (re)arms the timer that ends the match when the player to move runs out of time.
+// The match's lock must be held by the caller
+func (c *MatchController[M]) scheduleFlagFall(matchID string, m M) {
+	e := m.Engine()
+	if e.flagTimer != nil {
+		e.flagTimer.Stop()
+	}
+	if e.Gameover || e.Opts.T0 <= 0 {
+		return
+	}
+	ply := len(e.Moves)
+	e.flagTimer = time.AfterFunc(time.Until(e.flagDeadline()), func() {
+		c.flagFall(matchID, m, ply)
+	})
+}
+
+func (c *MatchController[M]) flagFall(matchID string, m M, ply int) {
+	e := m.Engine()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.Moves) != ply {
+		//a move arrived in the meantime and the timer is stale
+		return
+	}
+	res := e.FlagFall(time.Now())
+	//the match goes on if the flag did not fall, or fell for one of several players
+	c.scheduleFlagFall(matchID, m)
+	if res != nil && c.OnTimeout != nil {
+		c.OnTimeout(matchID, m, res)
+	}
+}
+
+// validPlayers checks the number of seats of a match, where 0 means 2
+func validPlayers(players int, variant VARIANT) error {
+	if players != 0 && (players < 2 || players > MAX_PLAYERS) {
+		return fmt.Errorf("invalid players")
+	}
+	if players > 2 && variant == VARIANT_POPOUT {
+		return fmt.Errorf("PopOut is played by two players")
+	}
+	return nil
+}
+
+// validBot checks the bot options of a match, if any
+func validBot(bot *BotOpts) error {
+	if bot != nil && (bot.Level < BOT_LEVEL_BEGINNER || bot.Level > BOT_LEVEL_EXPERT) {
+		return fmt.Errorf("invalid bot level")
+	}
+	return nil
+}
+
+// validBoardOptions checks the dimensions of a board, named after names, and its alignment
+// against the limits of a board configuration. With every, the alignment has to fit along every
+// axis, and otherwise along one of them
+func validBoardOptions(dims []int, names []string, maxDim int, a int, every bool) error {
+	errs := []string{}
+	shortest, longest := maxDim, 0
+	for i, d := range dims {
+		if d < 3 || d > maxDim {
+			errs = append(errs, "invalid "+names[i])
+		}
+		shortest, longest = min(shortest, d), max(longest, d)
+	}
+	if a < 3 || a > maxDim {
+		errs = append(errs, "invalid A")
+	}
+	if every && a > shortest || !every && a > longest {
+		sep := " nor "
+		if len(names) > 2 {
+			sep = ", nor "
+		}
+		errs = append(errs, "A cant be bigger than "+strings.Join(names[:len(names)-1], ", ")+sep+names[len(names)-1])
+	}
+	errStr := strings.Join(errs, ", ")
+	if errStr != "" {
+		return fmt.Errorf("%s", errStr)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// lineTable holds every winning line of a board configuration: each run of A cells along one
+// of the line directions. It only depends on the dimensions, A and the wrapping axes, so it is
+// cached by configuration and shared by the matches using it. It must not be modified once
+// built.
+type lineTable struct {
+	// lines holds the cell indexes of each line
+	lines [][]int
+	// byCell holds, for each cell index, the indexes in lines of the lines going through it
+	byCell [][]int
+}
+
+// lineTableCacheSize bounds how many line tables are cached, since clients pick the board
+// configurations. A table evicted while matches still use it stays theirs, and is built anew
+// for the next match of its configuration
+const lineTableCacheSize = 64
+
+var (
+	// lineTables holds the cached tables by key, and lineTableKeys their keys from the least to
+	// the most recently used
+	lineTables      = map[string]*lineTable{}
+	lineTableKeys   []string
+	lineTablesMutex sync.Mutex
+)
+
+// getLineTable returns the cached line table of a board with the given dimensions, alignment
+// and wrapping axes, building it on first use. wrap may be nil
+func getLineTable(dims []int, a int, wrap []bool) *lineTable {
+	key := fmt.Sprintf("%v/%d/%v", dims, a, wrap)
+	lineTablesMutex.Lock()
+	defer lineTablesMutex.Unlock()
+	t, ok := lineTables[key]
+	if ok {
+		lineTableKeys = slices.DeleteFunc(lineTableKeys, func(k string) bool { return k == key })
+	} else {
+		if len(lineTableKeys) == lineTableCacheSize {
+			delete(lineTables, lineTableKeys[0])
+			lineTableKeys = slices.Delete(lineTableKeys, 0, 1)
+		}
+		t = newLineTable(dims, a, wrap)
+		lineTables[key] = t
+	}
+	lineTableKeys = append(lineTableKeys, key)
+	return t
+}
+
+func newLineTable(dims []int, a int, wrap []bool) *lineTable {
+	size := 1
+	strides := make([]int, len(dims))
+	for i := len(dims) - 1; i >= 0; i-- {
+		strides[i] = size
+		size *= dims[i]
+	}
+	t := &lineTable{byCell: make([][]int, size)}
+	wraps := slices.Contains(wrap, true)
+	// seen holds the cells of every line so far, sorted, when wrapping lets the same cells be
+	// reached from several starts or directions
+	seen := map[string]bool{}
+
+	start := make(PointND, len(dims))
+	for i := range size {
+		rest := i
+		for axis := range dims {
+			start[axis] = rest / strides[axis]
+			rest %= strides[axis]
+		}
+	dirs:
+		for _, dir := range lineDirections(len(dims)) {
+			line := make([]int, a)
+			for k := range a {
+				idx := 0
+				for axis, c := range start {
+					c += k * dir[axis]
+					if wraps && wrap[axis] {
+						c = ((c % dims[axis]) + dims[axis]) % dims[axis]
+					}
+					if c < 0 || c >= dims[axis] {
+						continue dirs
+					}
+					idx += c * strides[axis]
+				}
+				line[k] = idx
+			}
+			if wraps {
+				//on small wrapping boards, a run of A cells can go round and take a cell twice
+				sorted := slices.Sorted(slices.Values(line))
+				if len(slices.Compact(sorted)) != a {
+					continue dirs
+				}
+				key := fmt.Sprint(sorted)
+				if seen[key] {
+					continue dirs
+				}
+				seen[key] = true
+			}
+			for _, idx := range line {
+				t.byCell[idx] = append(t.byCell[idx], len(t.lines))
+			}
+			t.lines = append(t.lines, line)
+		}
+	}
+	return t
+}
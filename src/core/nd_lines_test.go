@@ -0,0 +1,180 @@
+package core
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLineTable_Count(t *testing.T) {
+	cases := []struct {
+		dims []int
+		a    int
+		want int
+	}{
+		{[]int{6, 7}, 4, 69},
+		{[]int{4, 4, 4}, 4, 76},
+		{[]int{3, 3}, 3, 8},
+		{[]int{3, 10, 10}, 5, 3 * (10*6 + 6*10 + 6*6*2)},
+	}
+	for _, c := range cases {
+		if got := len(getLineTable(c.dims, c.a, nil).lines); got != c.want {
+			t.Errorf("expected %d lines for %v A%d, got %d", c.want, c.dims, c.a, got)
+		}
+	}
+	if getLineTable([]int{6, 7}, 4, nil) != getLineTable([]int{6, 7}, 4, nil) {
+		t.Error("expected the line table to be cached")
+	}
+}
+
+func TestLineTable_CacheBound(t *testing.T) {
+	standard := getLineTable([]int{6, 7}, 4, nil)
+	for w := range lineTableCacheSize + 10 {
+		getLineTable([]int{3, 3 + w}, 3, nil)
+		//the standard board stays the most recently used
+		getLineTable([]int{6, 7}, 4, nil)
+	}
+	lineTablesMutex.Lock()
+	n, keys := len(lineTables), len(lineTableKeys)
+	lineTablesMutex.Unlock()
+	if n != lineTableCacheSize || keys != lineTableCacheSize {
+		t.Fatalf("expected %d cached tables, got %d with %d keys", lineTableCacheSize, n, keys)
+	}
+	if getLineTable([]int{6, 7}, 4, nil) != standard {
+		t.Error("expected the most recently used table to stay cached")
+	}
+}
+
+func TestLineTable_Count_Wrap(t *testing.T) {
+	cases := []struct {
+		dims []int
+		a    int
+		wrap []bool
+		want int
+	}{
+		{[]int{6, 7}, 4, []bool{false, true}, 42 + 21 + 2*3*7},
+		{[]int{6, 7}, 4, []bool{true, true}, 4 * 42},
+		// going round a 3x3 torus from any cell of a line gives back the same cells
+		{[]int{3, 3}, 3, []bool{true, true}, 12},
+		// vertical runs longer than a wrapping axis would take some cell twice, but diagonal
+		// ones go round onto other columns
+		{[]int{3, 7}, 4, []bool{true, false}, 3*4 + 2*3*4},
+	}
+	for _, c := range cases {
+		table := getLineTable(c.dims, c.a, c.wrap)
+		if got := len(table.lines); got != c.want {
+			t.Errorf("expected %d lines for %v A%d wrap %v, got %d", c.want, c.dims, c.a, c.wrap, got)
+		}
+		for _, line := range table.lines {
+			if len(slices.Compact(slices.Sorted(slices.Values(line)))) != c.a {
+				t.Errorf("expected the cells of line %v to be distinct", line)
+			}
+		}
+	}
+}
+
+// checkLineCounters recounts every line of m from its cells
+func checkLineCounters(t *testing.T, m *MatchND) {
+	alive := [MAX_PLAYERS]int{}
+	for l, line := range m.lines.lines {
+		counts := [MAX_PLAYERS + 1]int{}
+		for _, idx := range line {
+			if s := m.Cells[idx]; s != SLOT_EMPTY {
+				counts[s-1]++
+			}
+		}
+		if counts != m.lineCounts[l] {
+			t.Fatalf("line %d: expected counts %v, got %v", l, counts, m.lineCounts[l])
+		}
+		for who := range m.Players {
+			if lineTotal(&counts) == counts[who] {
+				alive[who]++
+			}
+		}
+	}
+	if alive != m.alive {
+		t.Fatalf("expected alive lines %v, got %v", alive, m.alive)
+	}
+}
+
+func TestMatch3D_LineCounters(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	opts := MatchOpts3D{R: 4, C: 5, H: 3, A: 3, Starts1: true}
+	for range 50 {
+		match, _ := NewMatch3D("p1", "p2", opts)
+		match.Started = true
+		for !match.Gameover {
+			pid := match.getCurrPlayerID()
+			move := Move3D{Row: rng.Intn(opts.R), Col: rng.Intn(opts.C), RegisteredAt: time.Now()}
+			res, err := match.RegisterMove(move, pid)
+			if err != nil {
+				continue
+			}
+			checkLineCounters(t, match.MatchND)
+
+			// the counters must agree with tracing the lines from the last disc
+			cell := match.Moves[len(match.Moves)-1].Cell
+			traced := false
+			for _, dir := range match.dirs {
+				traced = traced || match.getVictoryLine(cell, dir) != nil
+			}
+			won := res != nil && res["resType"] == RESULT_TYPE_WON
+			if won != traced {
+				t.Fatalf("counters say won=%v, tracing says %v", won, traced)
+			}
+
+			if !match.Gameover && rng.Intn(4) == 0 {
+				if err := match.RequestTakeback(pid); err != nil {
+					t.Fatal("unexpected err: ", err)
+				}
+				if err := match.ApproveTakeback(match.GetEnemyID(pid), time.Now()); err != nil {
+					t.Fatal("unexpected err: ", err)
+				}
+				checkLineCounters(t, match.MatchND)
+			}
+		}
+	}
+}
+
+func TestMatchND_AliveLinesThrough(t *testing.T) {
+	match, _ := NewMatchND("p1", "p2", MatchOptsND{Dims: []int{3, 3}, Gravity: 0, A: 3, Starts1: true})
+	match.Started = true
+	// the bottom left corner lies on its row, its column and a diagonal
+	corner := PointND{0, 0}
+	if n := match.AliveLinesThrough(corner, SLOT_PLAYER1); n != 3 {
+		t.Fatalf("expected 3 lines through the corner, got %d", n)
+	}
+	if _, err := match.Play(PointND{0, 1}, time.Now(), "p1"); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if n := match.AliveLinesThrough(corner, SLOT_PLAYER2); n != 2 {
+		t.Fatalf("expected p2 to keep 2 lines through the corner, got %d", n)
+	}
+	if n := match.AliveLines(SLOT_PLAYER2); n != 6 {
+		t.Fatalf("expected p2 to keep 6 of 8 lines, got %d", n)
+	}
+	if n := match.AliveLines(SLOT_PLAYER1); n != 8 {
+		t.Fatalf("expected p1 to keep every line, got %d", n)
+	}
+}
+
+func BenchmarkIsGameover3D(b *testing.B) {
+	match, _ := NewMatch3D("p1", "p2", MatchOpts3D{R: 10, C: 10, H: 10, A: 4, Starts1: true})
+	match.Started = true
+	// two layers of discs where no two discs of the same player are neighbours in a plane,
+	// so that nobody has an alignment
+	for i := range 100 {
+		k := i / 2 % 25
+		shift := i % 2
+		move := Move3D{Row: k/5*2 + shift, Col: k%5*2 + shift}
+		if _, err := match.RegisterMove(move, match.getCurrPlayerID()); err != nil {
+			b.Fatal("unexpected err: ", err)
+		}
+	}
+	cell := match.Moves[len(match.Moves)-1].Cell
+	b.ResetTimer()
+	for range b.N {
+		match.isGameover(cell)
+	}
+}
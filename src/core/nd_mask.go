@@ -0,0 +1,62 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// RandomMask asks for a mask of blocked cells generated from a seed, so that the same seed
+// always gives the same board
+type RandomMask struct {
+	Seed int64 `json:"seed"`
+	// Density is the share of cells to block, from 0 to 0.5
+	Density float64 `json:"density"`
+}
+
+func (rm RandomMask) valid() error {
+	if rm.Density < 0 || rm.Density > 0.5 {
+		return fmt.Errorf("invalid mask density")
+	}
+	return nil
+}
+
+// RandomMask2D returns a mask of a w by h board, in the layout of Match2D.Board, that is
+// symmetric around the middle column so that neither side of the board is favoured
+func RandomMask2D(w, h int, rm RandomMask) [][]bool {
+	rng := rand.New(rand.NewSource(rm.Seed))
+	mask := make([][]bool, h)
+	for row := range mask {
+		mask[row] = make([]bool, w)
+		for col := range (w + 1) / 2 {
+			blocked := rng.Float64() < rm.Density
+			mask[row][col] = blocked
+			mask[row][w-1-col] = blocked
+		}
+	}
+	return mask
+}
+
+// RandomMask3D returns a mask of an r by c by h board, in the layout of Match3D.Board, that is
+// symmetric around the middle row and the middle column
+func RandomMask3D(r, c, h int, rm RandomMask) [][][]bool {
+	rng := rand.New(rand.NewSource(rm.Seed))
+	mask := make([][][]bool, r)
+	for row := range mask {
+		mask[row] = make([][]bool, c)
+		for col := range mask[row] {
+			mask[row][col] = make([]bool, h)
+		}
+	}
+	for row := range (r + 1) / 2 {
+		for col := range (c + 1) / 2 {
+			for k := range h {
+				blocked := rng.Float64() < rm.Density
+				mask[row][col][k] = blocked
+				mask[r-1-row][col][k] = blocked
+				mask[row][c-1-col][k] = blocked
+				mask[r-1-row][c-1-col][k] = blocked
+			}
+		}
+	}
+	return mask
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRandomMask2D(t *testing.T) {
+	rm := RandomMask{Seed: 42, Density: 0.3}
+	mask := RandomMask2D(7, 6, rm)
+	if !reflect.DeepEqual(mask, RandomMask2D(7, 6, rm)) {
+		t.Fatal("expected the same seed to give the same mask")
+	}
+	if reflect.DeepEqual(mask, RandomMask2D(7, 6, RandomMask{Seed: 43, Density: 0.3})) {
+		t.Fatal("expected another seed to give another mask")
+	}
+	for row := range mask {
+		for col := range mask[row] {
+			if mask[row][col] != mask[row][6-col] {
+				t.Fatalf("expected the mask to be symmetric, got %v", mask)
+			}
+		}
+	}
+}
+
+func TestRandomMask3D(t *testing.T) {
+	mask := RandomMask3D(4, 5, 3, RandomMask{Seed: 7, Density: 0.3})
+	for row := range 4 {
+		for col := range 5 {
+			for k := range 3 {
+				b := mask[row][col][k]
+				if b != mask[3-row][col][k] || b != mask[row][4-col][k] {
+					t.Fatalf("expected the mask to be symmetric, got %v", mask)
+				}
+			}
+		}
+	}
+}
+
+func TestMatch2D_Mask_Gravity(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Mask: make([][]bool, 6)}
+	for row := range opts.Mask {
+		opts.Mask[row] = make([]bool, 7)
+	}
+	opts.Mask[5][3] = true
+	opts.Mask[3][4] = true
+	opts.Mask[0][5] = true
+	match, err := NewMatch2D("p1", "p2", opts)
+	if err != nil {
+		t.Fatal("unexpected err in match creation: ", err)
+	}
+	match.Started = true
+
+	// discs stack on the blocked cells, even above empty ones
+	playCols(t, match, []Move{{Col: 3}, {Col: 4}})
+	if match.Board[4][3] != SLOT_PLAYER1 || match.Board[2][4] != SLOT_PLAYER2 {
+		t.Fatalf("expected discs to land on the blocked cells, got %v", match.Board)
+	}
+	if match.Board[5][4] != SLOT_EMPTY {
+		t.Fatal("expected the cells under a blocked one to stay empty")
+	}
+	if _, err := match.RegisterMove(Move{Col: 5}, "p1"); err == nil {
+		t.Fatal("expected an error for a column blocked at the top")
+	}
+	checkLineCounters(t, match.MatchND)
+}
+
+func TestMatch2D_Mask_Lines(t *testing.T) {
+	// a row of five with a hole in the middle
+	opts := MatchOpts{W: 5, H: 3, A: 2, Starts1: true, NoGravity: true, Mask: [][]bool{
+		{true, true, true, true, true},
+		{false, false, true, false, false},
+		{true, true, true, true, true},
+	}}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	if _, err := match.RegisterMove(Move{Row: 1, Col: 2}, "p1"); err == nil {
+		t.Fatal("expected an error for playing a blocked cell")
+	}
+	if res := playCols(t, match, []Move{{Row: 1, Col: 1}, {Row: 1, Col: 4}, {Row: 1, Col: 3}}); res != nil {
+		t.Fatalf("expected the line not to go through the blocked cell, got %v", res)
+	}
+	res := playCols(t, match, []Move{{Row: 1, Col: 0}})
+	if res["resType"] != RESULT_TYPE_DRAW || res["reason"] != DRAW_REASON_BOARD_FULL {
+		t.Fatalf("expected a full board once the playable cells are taken, got %v", res)
+	}
+
+	opts.Mask[1][1] = true
+	opts.Mask[1][3] = true
+	if _, err := NewMatch2D("p1", "p2", opts); err == nil {
+		t.Fatal("expected an error for a mask that leaves no line")
+	}
+}
+
+func TestMatch2D_Mask_NoMoveLeft(t *testing.T) {
+	// the cells under the blocked one can never be played
+	opts := MatchOpts{W: 4, H: 4, A: 3, Starts1: true, Mask: [][]bool{
+		make([]bool, 4),
+		{true, false, false, false},
+		make([]bool, 4),
+		make([]bool, 4),
+	}}
+	match, err := NewMatch2D("p1", "p2", opts)
+	if err != nil {
+		t.Fatal("unexpected err in match creation: ", err)
+	}
+	match.Started = true
+
+	cols := []Move{{Col: 2}, {Col: 3}, {Col: 1}, {Col: 1}, {Col: 1}, {Col: 1}, {Col: 2}, {Col: 0}, {Col: 3}, {Col: 2}, {Col: 2}, {Col: 3}}
+	if res := playCols(t, match, cols); res != nil {
+		t.Fatalf("unexpected gameover, got %v", res)
+	}
+	res := playCols(t, match, []Move{{Col: 3}})
+	if res["resType"] != RESULT_TYPE_DRAW || res["reason"] != DRAW_REASON_BOARD_FULL {
+		t.Fatalf("expected a draw once no move is left, got %v", res)
+	}
+	if match.Board[3][0] != SLOT_EMPTY || !match.Gameover || len(match.LegalMoves()) != 0 {
+		t.Fatalf("expected the game to end with the unreachable cells empty, got %v", match.Board)
+	}
+
+	opts.Mask[0] = []bool{true, true, true, true}
+	if _, err := NewMatch2D("p1", "p2", opts); err == nil {
+		t.Fatal("expected an error for a mask that leaves no cell to play")
+	}
+}
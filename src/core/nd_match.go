@@ -0,0 +1,1117 @@
+package core
+
+import (
+	"connectx/src/errs"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Slot int
+type RESULT_TYPE int
+
+const (
+	RESULT_TYPE_WON RESULT_TYPE = iota
+	RESULT_TYPE_DRAW
+	RESULT_TYPE_TIMEOUT
+	RESULT_TYPE_RESIGN
+)
+
+// DRAW_REASON tells how a drawn match came to be a draw. It goes in the "reason" field of draw results
+type DRAW_REASON int
+
+const (
+	// DRAW_REASON_BOARD_FULL is a draw where every cell was played
+	DRAW_REASON_BOARD_FULL DRAW_REASON = iota
+	// DRAW_REASON_NO_LINES_LEFT is a draw where neither player can complete a line anymore
+	DRAW_REASON_NO_LINES_LEFT
+	// DRAW_REASON_AGREEMENT is a draw offered by a player and accepted by the other
+	DRAW_REASON_AGREEMENT
+	// DRAW_REASON_REPETITION is a PopOut draw where the same position occurred three times
+	DRAW_REASON_REPETITION
+	// DRAW_REASON_EQUAL_SCORES is a scoring match where several players finished with the best score
+	DRAW_REASON_EQUAL_SCORES
+)
+
+// VARIANT is the rule set a match is played with
+type VARIANT int
+
+const (
+	VARIANT_CLASSIC VARIANT = iota
+	// VARIANT_POPOUT lets a player pop one of their own discs from the bottom of a stick,
+	// instead of dropping a disc
+	VARIANT_POPOUT
+)
+
+// NO_GRAVITY is the gravity axis of boards where discs stay in the cell they are played at
+const NO_GRAVITY = -1
+
+// MOVE_KIND tells what a move did to the board
+type MOVE_KIND int
+
+const (
+	MOVE_KIND_DROP MOVE_KIND = iota
+	MOVE_KIND_POP
+	// MOVE_KIND_SWAP is the pie rule's answer to the first move: the second player takes over
+	// the first player's disc, and the first player moves next with the other color
+	MOVE_KIND_SWAP
+)
+
+const (
+	SLOT_EMPTY Slot = iota
+	SLOT_PLAYER1
+	SLOT_PLAYER2
+	SLOT_PLAYER3
+	SLOT_PLAYER4
+	// SLOT_BLOCKED is a neutral cell nobody can play. Lines can't go through it, and discs stack
+	// on top of it
+	SLOT_BLOCKED
+)
+
+// MAX_PLAYERS is the number of seats of the largest matches. The player at seat i plays with
+// Slot(i+1)
+const MAX_PLAYERS = 4
+
+type Player struct {
+	// ID is empty until someone takes the seat
+	ID       string
+	TimeLeft int64
+	// Eliminated is set when the player resigned or ran out of time in a match that went on
+	// without them
+	Eliminated bool
+}
+
+type GameoverResult map[string]any
+
+// Elimination is a player leaving a match by resigning or running out of time
+type Elimination struct {
+	Seat   int
+	Reason RESULT_TYPE
+	// Ply is how many moves had been played when the player left
+	Ply int
+	At  time.Time
+}
+
+// PointND is a cell of an N-dimensional board, with one coordinate per axis
+type PointND []int
+type LineND []PointND
+
+type MoveND struct {
+	// Cell is where the disc landed, or the bottom cell it was popped from. Swaps hold the
+	// cell of the disc taken over
+	Cell PointND
+	Kind MOVE_KIND
+	// Seat is the seat of the mover, in the order of MatchND.Players. Since a swap exchanges
+	// the players of the first two seats, the first move of a swapped match counts as the swapper's
+	Seat int
+	// Completed holds the lines of A discs the move completed, in scoring matches
+	Completed    []LineND
+	RegisteredAt time.Time
+	// TimeSpent is the time charged to the mover's clock for this move, in milliseconds
+	TimeSpent int64
+}
+
+type MatchOptsND struct {
+	// Dims is the size of the board along each axis
+	Dims []int `json:"dims"`
+	// Gravity is the axis along which discs fall, towards coordinate 0, or NO_GRAVITY
+	Gravity int `json:"gravity"`
+	// AxisNames are used in error messages, e.g. "invalid column"
+	AxisNames []string `json:"-"`
+	A         int      `json:"a"`
+	// Starts1 tells whether the first seat moves first. Otherwise the second seat does, and
+	// turns follow the seat order from there
+	Starts1 bool `json:"starts1"`
+	// Players is the number of seats, from 2 to MAX_PLAYERS. 0 means 2
+	Players int `json:"players"`
+	// T0 is the initial time of each player, in milliseconds. 0 means untimed
+	T0 int64 `json:"t0"`
+	// TD is the increment added to the mover's clock after each move, in milliseconds
+	TD      int64   `json:"td"`
+	Variant VARIANT `json:"variant"`
+	// Exact makes only lines of exactly A discs win, as in Gomoku's exact-five rule. Otherwise
+	// longer lines (overlines) win too
+	Exact bool `json:"exact"`
+	// Wrap tells, for each axis, whether lines continue across its edges, as on a torus.
+	// A nil Wrap wraps no axis
+	Wrap []bool `json:"wrap"`
+	// Blocked tells, for each cell in the order of MatchND.Cells, whether it is blocked.
+	// A nil Blocked blocks no cell
+	Blocked []bool `json:"blocked"`
+	// Pie lets the second player swap after the first move, to take over the first player's disc
+	Pie bool `json:"pie"`
+	// Scoring plays on until the board is full, or until nobody can complete a line anymore. Each
+	// line of A discs scores a point, so a run of A+1 discs scores two, and the best score wins
+	Scoring bool `json:"scoring"`
+}
+
+// MatchND is the game engine behind every board shape. The board is an N-dimensional box
+// whose cells are stored flat, in row-major order. Match2D and Match3D are configurations of it.
+type MatchND struct {
+	Cells []Slot
+	// Players holds a player per seat. Turns follow the seat order, skipping the eliminated players
+	Players []Player
+	// Scores holds the score of each seat, in scoring matches
+	Scores    []int
+	Opts      MatchOptsND
+	Moves     []MoveND
+	StartedAt time.Time
+	Started   bool
+	Gameover  bool
+	// Result is the result that ended the match, once it is over
+	Result GameoverResult
+	// Eliminations holds the players who left the match, in order. The last one of a two-player
+	// match ended it
+	Eliminations []Elimination
+	// DrawOfferedBy is the ID of the player with a pending draw offer, if any
+	DrawOfferedBy string
+	// TakebackRequestedBy is the ID of the player with a pending takeback request, if any
+	TakebackRequestedBy string
+
+	mu        sync.Mutex
+	flagTimer *time.Timer
+	// turn is the seat of the player to move
+	turn int
+	// resumedAt is when play resumed after the last takeback or elimination
+	resumedAt time.Time
+	strides   []int
+	dirs      []PointND
+	lines     *lineTable
+	// lineCounts holds, for each line of the line table, how many discs each seat has on it,
+	// and then how many blocked cells
+	lineCounts [][MAX_PLAYERS + 1]int
+	// alive holds, for each seat, how many lines hold none of the other seats' discs
+	alive [MAX_PLAYERS]int
+	// discs is how many cells are taken, blocked cells included
+	discs int
+	// positions holds the key of every position of the match, the initial one included. Only
+	// PopOut matches, where positions can repeat, keep it
+	positions []string
+	// repetitions counts how many times each position of positions occurred
+	repetitions map[string]int
+}
+
+// NewMatchND creates a match with p1ID and p2ID in the first two seats. Empty IDs, like those
+// of the seats past the second, leave the seat to be taken with Join
+func NewMatchND(p1ID, p2ID string, opts MatchOptsND) (*MatchND, error) {
+	if len(opts.Dims) == 0 {
+		return nil, fmt.Errorf("invalid match options: the board needs at least one dimension")
+	}
+	if opts.Gravity != NO_GRAVITY && (opts.Gravity < 0 || opts.Gravity >= len(opts.Dims)) {
+		return nil, fmt.Errorf("invalid match options: gravity axis out of range")
+	}
+	if opts.Wrap != nil && len(opts.Wrap) != len(opts.Dims) {
+		return nil, fmt.Errorf("invalid match options: expected a wrap flag per dimension")
+	}
+	if !slices.Contains(opts.Wrap, true) {
+		opts.Wrap = nil
+	}
+	if opts.Gravity == NO_GRAVITY && opts.Variant == VARIANT_POPOUT {
+		return nil, fmt.Errorf("invalid match options: PopOut needs gravity")
+	}
+	if opts.Players == 0 {
+		opts.Players = 2
+	}
+	if opts.Players < 2 || opts.Players > MAX_PLAYERS {
+		return nil, fmt.Errorf("invalid match options: a match takes 2 to %d players", MAX_PLAYERS)
+	}
+	if opts.Players > 2 && opts.Variant == VARIANT_POPOUT {
+		return nil, fmt.Errorf("invalid match options: PopOut is played by two players")
+	}
+	if opts.Scoring && (opts.Variant == VARIANT_POPOUT || opts.Exact) {
+		return nil, fmt.Errorf("invalid match options: scoring is played without pops nor the exact rule")
+	}
+	if opts.Players > 2 && opts.Pie {
+		return nil, fmt.Errorf("invalid match options: the pie rule is for two-player matches")
+	}
+	if !slices.Contains(opts.Blocked, true) {
+		opts.Blocked = nil
+	}
+	if opts.Blocked != nil && opts.Variant == VARIANT_POPOUT {
+		return nil, fmt.Errorf("invalid match options: PopOut is played without blocked cells")
+	}
+	size := 1
+	longest := 0
+	for _, d := range opts.Dims {
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid match options: dimensions and alignment must be positive")
+		}
+		size *= d
+		longest = max(longest, d)
+	}
+	if opts.A <= 0 {
+		return nil, fmt.Errorf("invalid match options: dimensions and alignment must be positive")
+	}
+	if opts.A > longest {
+		return nil, fmt.Errorf("invalid match options: alignment must be less than or equal to some dimension")
+	}
+	if opts.Blocked != nil && len(opts.Blocked) != size {
+		return nil, fmt.Errorf("invalid match options: expected a blocked flag per cell")
+	}
+	strides := make([]int, len(opts.Dims))
+	stride := 1
+	for i := len(opts.Dims) - 1; i >= 0; i-- {
+		strides[i] = stride
+		stride *= opts.Dims[i]
+	}
+	lines := getLineTable(opts.Dims, opts.A, opts.Wrap)
+	players := make([]Player, opts.Players)
+	for i := range players {
+		players[i].TimeLeft = opts.T0
+	}
+	players[0].ID = p1ID
+	players[1].ID = p2ID
+	m := &MatchND{
+		Opts:       opts,
+		Players:    players,
+		Scores:     make([]int, opts.Players),
+		Cells:      make([]Slot, size),
+		Moves:      make([]MoveND, 0),
+		strides:    strides,
+		dirs:       lineDirections(len(opts.Dims)),
+		lines:      lines,
+		lineCounts: make([][MAX_PLAYERS + 1]int, len(lines.lines)),
+	}
+	for seat := range players {
+		m.alive[seat] = len(lines.lines)
+	}
+	for idx, blocked := range opts.Blocked {
+		if blocked {
+			m.setCell(idx, SLOT_BLOCKED)
+		}
+	}
+	if m.alive[0] == 0 {
+		return nil, fmt.Errorf("invalid match options: the blocked cells leave no line to play")
+	}
+	if m.full() {
+		return nil, fmt.Errorf("invalid match options: the blocked cells leave no cell to play")
+	}
+	if !opts.Starts1 {
+		m.turn = 1
+	}
+	if opts.Variant == VARIANT_POPOUT {
+		m.repetitions = map[string]int{}
+		m.recordPosition()
+	}
+	return m, nil
+}
+
+// lineDirections returns every direction a line can take on an n-dimensional board: the vectors
+// in {-1,0,1}^n whose first non zero component is positive, so that each line is counted once.
+// That is 4 directions in 2D, 13 in 3D and 40 in 4D
+func lineDirections(n int) []PointND {
+	var dirs []PointND
+	dir := make(PointND, n)
+	var gen func(axis int, positive bool)
+	gen = func(axis int, positive bool) {
+		if axis == n {
+			if positive {
+				dirs = append(dirs, append(PointND{}, dir...))
+			}
+			return
+		}
+		for _, v := range []int{0, 1, -1} {
+			if v == -1 && !positive {
+				continue
+			}
+			dir[axis] = v
+			gen(axis+1, positive || v == 1)
+		}
+		dir[axis] = 0
+	}
+	gen(0, false)
+	return dirs
+}
+
+// Engine returns the engine of a match. It lets the controllers and the hub handle every
+// board configuration the same way
+func (m *MatchND) Engine() *MatchND {
+	return m
+}
+
+func (m *MatchND) DTO(userModel DTOGetter) (any, error) {
+	return m.ToDTO(userModel)
+}
+
+type MatchNDDTO struct {
+	Cells []int `json:"cells"`
+	// Players holds a player per seat, nil for the seats nobody took yet
+	Players []*PlayerDTO
+	// Scores holds the score of each seat, in scoring matches
+	Scores    []int
+	Opts      MatchOptsND
+	Moves     []MoveND
+	StartedAt time.Time
+	Started   bool
+	Gameover  bool
+	// DrawOfferedBy is the ID of the player with a pending draw offer, if any
+	DrawOfferedBy string
+	// TakebackRequestedBy is the ID of the player with a pending takeback request, if any
+	TakebackRequestedBy string
+}
+
+func (m *MatchND) ToDTO(userModel DTOGetter) (*MatchNDDTO, error) {
+	players, err := m.playerDTOs(userModel)
+	if err != nil {
+		return nil, err
+	}
+	cells := make([]int, len(m.Cells))
+	for i, slot := range m.Cells {
+		cells[i] = int(slot)
+	}
+	return &MatchNDDTO{
+		Cells:     cells,
+		Players:   players,
+		Scores:    m.Scores,
+		Opts:      m.Opts,
+		Moves:     m.Moves,
+		StartedAt: m.StartedAt,
+		Started:   m.Started,
+		Gameover:  m.Gameover,
+
+		DrawOfferedBy:       m.DrawOfferedBy,
+		TakebackRequestedBy: m.TakebackRequestedBy,
+	}, nil
+}
+
+func (m *MatchND) playerDTOs(userModel DTOGetter) ([]*PlayerDTO, error) {
+	players := make([]*PlayerDTO, len(m.Players))
+	for i, p := range m.Players {
+		if p.ID == "" {
+			continue
+		}
+		dto, err := userModel.GetUserDTO(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		dto.TimeLeft = p.TimeLeft
+		dto.Eliminated = p.Eliminated
+		players[i] = dto
+	}
+	return players, nil
+}
+
+func (m *MatchND) index(p PointND) int {
+	i := 0
+	for axis, c := range p {
+		i += c * m.strides[axis]
+	}
+	return i
+}
+
+func (m *MatchND) inBounds(p PointND) bool {
+	for axis, c := range p {
+		if c < 0 || c >= m.Opts.Dims[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MatchND) wraps(axis int) bool {
+	return m.Opts.Wrap != nil && m.Opts.Wrap[axis]
+}
+
+// step moves p by sign*dir, wrapping around the axes that wrap. It reports whether p is
+// still on the board
+func (m *MatchND) step(p PointND, dir PointND, sign int) bool {
+	for axis := range p {
+		p[axis] += sign * dir[axis]
+		if m.wraps(axis) {
+			p[axis] = (p[axis] + m.Opts.Dims[axis]) % m.Opts.Dims[axis]
+		}
+	}
+	return m.inBounds(p)
+}
+
+func (m *MatchND) At(p PointND) Slot {
+	return m.Cells[m.index(p)]
+}
+
+// setCell puts s in the empty cell with index idx, keeping the line counters up to date
+func (m *MatchND) setCell(idx int, s Slot) {
+	m.Cells[idx] = s
+	m.discs++
+	who := int(s) - 1
+	for _, l := range m.lines.byCell[idx] {
+		counts := &m.lineCounts[l]
+		total := lineTotal(counts)
+		for seat := range m.Players {
+			//the line was alive for seat if it only held seat's discs
+			if seat != who && counts[seat] == total {
+				m.alive[seat]--
+			}
+		}
+		counts[who]++
+	}
+}
+
+// clearCell empties the cell with index idx, keeping the line counters up to date
+func (m *MatchND) clearCell(idx int) {
+	who := int(m.Cells[idx]) - 1
+	m.Cells[idx] = SLOT_EMPTY
+	if who < 0 {
+		return
+	}
+	m.discs--
+	for _, l := range m.lines.byCell[idx] {
+		counts := &m.lineCounts[l]
+		counts[who]--
+		total := lineTotal(counts)
+		for seat := range m.Players {
+			if seat != who && counts[seat] == total {
+				m.alive[seat]++
+			}
+		}
+	}
+}
+
+// lineTotal returns how many cells of a line are taken, given its counters
+func lineTotal(counts *[MAX_PLAYERS + 1]int) int {
+	return counts[0] + counts[1] + counts[2] + counts[3] + counts[4]
+}
+
+// completesLine reports whether the disc at idx is part of a full line of its owner
+func (m *MatchND) completesLine(idx int) bool {
+	who := int(m.Cells[idx]) - 1
+	if who < 0 {
+		return false
+	}
+	for _, l := range m.lines.byCell[idx] {
+		if m.lineCounts[l][who] == m.Opts.A {
+			return true
+		}
+	}
+	return false
+}
+
+// AliveLines returns how many lines the player with slot s can still complete, that is the
+// lines holding none of the other players' discs
+func (m *MatchND) AliveLines(s Slot) int {
+	return m.alive[s-1]
+}
+
+// AliveLinesThrough returns how many of the lines going through p the player with slot s can
+// still complete
+func (m *MatchND) AliveLinesThrough(p PointND, s Slot) int {
+	n := 0
+	for _, l := range m.lines.byCell[m.index(p)] {
+		if counts := &m.lineCounts[l]; lineTotal(counts) == counts[s-1] {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *MatchND) axisName(axis int) string {
+	if axis < len(m.Opts.AxisNames) {
+		return m.Opts.AxisNames[axis]
+	}
+	return fmt.Sprintf("coordinate %d", axis)
+}
+
+func (m *MatchND) getCurrPlayerID() string {
+	return m.Players[m.turn].ID
+}
+
+// nextTurn passes the turn to the next seat whose player is still in the match
+func (m *MatchND) nextTurn() {
+	for i := 1; i <= len(m.Players); i++ {
+		seat := (m.turn + i) % len(m.Players)
+		if !m.Players[seat].Eliminated {
+			m.turn = seat
+			return
+		}
+	}
+}
+
+// SeatOf returns the seat of pid, or -1 if pid is not a player of the match
+func (m *MatchND) SeatOf(pid string) int {
+	for i, p := range m.Players {
+		if p.ID == pid {
+			return i
+		}
+	}
+	return -1
+}
+
+// slotOf returns the slot of pid's discs
+func (m *MatchND) slotOf(pid string) Slot {
+	return Slot(m.SeatOf(pid) + 1)
+}
+
+func (m *MatchND) getPlayer(pid string) *Player {
+	if seat := m.SeatOf(pid); seat >= 0 && pid != "" {
+		return &m.Players[seat]
+	}
+	return nil
+}
+
+// GetEnemyID returns the ID of pid's opponent in a two-player match
+func (m *MatchND) GetEnemyID(pid string) string {
+	if m.getPlayer(pid) == nil {
+		return ""
+	}
+	return m.Players[1-m.SeatOf(pid)].ID
+}
+
+// OpponentIDs returns the IDs of the other seated players of pid's match, eliminated or not
+func (m *MatchND) OpponentIDs(pid string) []string {
+	var ids []string
+	for _, p := range m.Players {
+		if p.ID != "" && p.ID != pid {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// PlayerIDs returns the IDs of every seated player
+func (m *MatchND) PlayerIDs() []string {
+	return m.OpponentIDs("")
+}
+
+// Join seats pid at the first empty seat, and starts the match at the given time once every
+// seat is taken. It reports whether pid took a seat, which is false if pid already had one
+func (m *MatchND) Join(pid string, at time.Time) (bool, error) {
+	if m.getPlayer(pid) != nil {
+		return false, nil
+	}
+	seat := m.SeatOf("")
+	if seat < 0 {
+		return false, errs.ErrUnjoinable
+	}
+	m.Players[seat].ID = pid
+	if m.SeatOf("") < 0 {
+		m.Started = true
+		m.StartedAt = at
+	}
+	return true, nil
+}
+
+// eliminate takes pid out of the match, for the given reason, at the given time. The match ends
+// once a single player is left, who wins it. Otherwise it goes on, and if pid was to move,
+// the next player's clock starts at the given time
+func (m *MatchND) eliminate(pid string, reason RESULT_TYPE, at time.Time) GameoverResult {
+	seat := m.SeatOf(pid)
+	m.Players[seat].Eliminated = true
+	m.Eliminations = append(m.Eliminations, Elimination{Seat: seat, Reason: reason, Ply: len(m.Moves), At: at})
+	res := GameoverResult{"resType": reason, "loserID": pid}
+
+	left := -1
+	for i, p := range m.Players {
+		if !p.Eliminated {
+			if left >= 0 {
+				//at least two players left
+				if m.turn == seat {
+					m.nextTurn()
+					m.resumedAt = at
+				}
+				return res
+			}
+			left = i
+		}
+	}
+	m.Gameover = true
+	res["winnerID"] = m.Players[left].ID
+	m.Result = res
+	return res
+}
+
+// Resign takes pid out of the match at the given time. In a two-player match, this ends it with
+// pid as the loser
+func (m *MatchND) Resign(pid string, at time.Time) (GameoverResult, error) {
+	if m.Gameover {
+		return nil, fmt.Errorf("game is over")
+	}
+	if !m.Started {
+		return nil, fmt.Errorf("match has not started yet")
+	}
+	p := m.getPlayer(pid)
+	if p == nil {
+		return nil, fmt.Errorf("not a player of this match")
+	}
+	if p.Eliminated {
+		return nil, fmt.Errorf("you are out of this match")
+	}
+	return m.eliminate(pid, RESULT_TYPE_RESIGN, at), nil
+}
+
+// OfferDraw registers a draw offer from pid. The offer stays pending until the opponent
+// answers it, or until the opponent moves instead
+func (m *MatchND) OfferDraw(pid string) error {
+	if m.Gameover {
+		return fmt.Errorf("game is over")
+	}
+	if !m.Started {
+		return fmt.Errorf("match has not started yet")
+	}
+	if m.getPlayer(pid) == nil {
+		return fmt.Errorf("not a player of this match")
+	}
+	if len(m.Players) > 2 {
+		return fmt.Errorf("draw offers are only available in two-player matches")
+	}
+	if m.DrawOfferedBy != "" {
+		return fmt.Errorf("there is already a pending draw offer")
+	}
+	m.DrawOfferedBy = pid
+	return nil
+}
+
+func (m *MatchND) checkDrawOfferTo(pid string) error {
+	if m.Gameover {
+		return fmt.Errorf("game is over")
+	}
+	if m.DrawOfferedBy == "" || m.DrawOfferedBy != m.GetEnemyID(pid) {
+		return fmt.Errorf("no pending draw offer")
+	}
+	return nil
+}
+
+// AcceptDraw ends the match as a draw, if pid's opponent has a pending draw offer
+func (m *MatchND) AcceptDraw(pid string) (GameoverResult, error) {
+	if err := m.checkDrawOfferTo(pid); err != nil {
+		return nil, err
+	}
+	m.DrawOfferedBy = ""
+	m.Gameover = true
+	m.Result = GameoverResult{"resType": RESULT_TYPE_DRAW, "reason": DRAW_REASON_AGREEMENT}
+	return m.Result, nil
+}
+
+// DeclineDraw discards the pending draw offer of pid's opponent
+func (m *MatchND) DeclineDraw(pid string) error {
+	if err := m.checkDrawOfferTo(pid); err != nil {
+		return err
+	}
+	m.DrawOfferedBy = ""
+	return nil
+}
+
+// RequestTakeback registers pid's request to take back their last move. The request stays
+// pending until the opponent answers it, or until any player moves
+func (m *MatchND) RequestTakeback(pid string) error {
+	if m.Gameover {
+		return fmt.Errorf("game is over")
+	}
+	if !m.Started {
+		return fmt.Errorf("match has not started yet")
+	}
+	if m.getPlayer(pid) == nil {
+		return fmt.Errorf("not a player of this match")
+	}
+	if len(m.Players) > 2 {
+		return fmt.Errorf("takebacks are only available in two-player matches")
+	}
+	if m.TakebackRequestedBy != "" {
+		return fmt.Errorf("there is already a pending takeback request")
+	}
+	if m.takebackLen(pid) > len(m.Moves) {
+		return fmt.Errorf("no move to take back")
+	}
+	m.TakebackRequestedBy = pid
+	return nil
+}
+
+// takebackLen returns how many moves must be popped for pid to be on the move again. It is
+// more than len(m.Moves) if pid has not moved yet
+func (m *MatchND) takebackLen(pid string) int {
+	seat := m.SeatOf(pid)
+	for i := len(m.Moves) - 1; i >= 0; i-- {
+		if m.Moves[i].Seat == seat {
+			return len(m.Moves) - i
+		}
+	}
+	return len(m.Moves) + 1
+}
+
+func (m *MatchND) checkTakebackRequestTo(pid string) error {
+	if m.Gameover {
+		return fmt.Errorf("game is over")
+	}
+	if m.TakebackRequestedBy == "" || m.TakebackRequestedBy != m.GetEnemyID(pid) {
+		return fmt.Errorf("no pending takeback request")
+	}
+	return nil
+}
+
+// ApproveTakeback reverts the moves made since the last move of pid's opponent (included), and
+// gives the movers back the time they spent on them. The player to move is charged for the time
+// they thought until the approval, which no move gives back, before the clock restarts at it
+func (m *MatchND) ApproveTakeback(pid string, at time.Time) error {
+	if err := m.checkTakebackRequestTo(pid); err != nil {
+		return err
+	}
+	if m.Opts.T0 > 0 {
+		p := &m.Players[m.turn]
+		p.TimeLeft = max(p.TimeLeft-max(at.Sub(m.lastMoveAt()).Milliseconds(), 0), 0)
+	}
+	n := m.takebackLen(m.TakebackRequestedBy)
+	for range n {
+		m.undoMove()
+	}
+	m.TakebackRequestedBy = ""
+	m.resumedAt = at
+	return nil
+}
+
+// undoMove reverts the last move, and gives the mover back the time they spent on it. Undoing
+// the move that ended the match lets it go on
+func (m *MatchND) undoMove() {
+	move := m.Moves[len(m.Moves)-1]
+	m.Moves = m.Moves[:len(m.Moves)-1]
+	m.turn = move.Seat
+	switch move.Kind {
+	case MOVE_KIND_POP:
+		m.unpopStick(move.Cell, Slot(move.Seat+1))
+	case MOVE_KIND_SWAP:
+		//the swapper goes back to the second seat, on the move
+		m.Players[0], m.Players[1] = m.Players[1], m.Players[0]
+		m.turn = 1 - move.Seat
+	default:
+		m.clearCell(m.index(move.Cell))
+	}
+	if move.Kind != MOVE_KIND_SWAP {
+		m.forgetPosition()
+	}
+	m.Scores[move.Seat] -= len(move.Completed)
+	if m.Opts.T0 > 0 {
+		m.Players[m.turn].TimeLeft += move.TimeSpent - m.Opts.TD
+	}
+	m.Gameover = false
+	m.Result = nil
+}
+
+// DenyTakeback discards the pending takeback request of pid's opponent
+func (m *MatchND) DenyTakeback(pid string) error {
+	if err := m.checkTakebackRequestTo(pid); err != nil {
+		return err
+	}
+	m.TakebackRequestedBy = ""
+	return nil
+}
+
+// FlagFall eliminates the player to move if they have run out of time at the given time, which
+// ends two-player matches. It returns nil if the player to move still has time left.
+func (m *MatchND) FlagFall(at time.Time) GameoverResult {
+	if m.Gameover || !m.Started || m.Opts.T0 <= 0 {
+		return nil
+	}
+	if at.Sub(m.lastMoveAt()).Milliseconds() < m.Players[m.turn].TimeLeft {
+		return nil
+	}
+	return m.flagFell()
+}
+
+// flagFell eliminates the player to move, who ran out of time. The next player's clock starts
+// from the moment the flag fell, not from when it was noticed
+func (m *MatchND) flagFell() GameoverResult {
+	deadline := m.flagDeadline()
+	m.Players[m.turn].TimeLeft = 0
+	return m.eliminate(m.getCurrPlayerID(), RESULT_TYPE_TIMEOUT, deadline)
+}
+
+// flagDeadline returns the moment at which the player to move runs out of time.
+func (m *MatchND) flagDeadline() time.Time {
+	p := m.Players[m.turn]
+	return m.lastMoveAt().Add(time.Duration(p.TimeLeft) * time.Millisecond)
+}
+
+// ClockLeft returns how much time the player to move has left at the given time, in milliseconds.
+// It is meaningless in untimed matches
+func (m *MatchND) ClockLeft(at time.Time) int64 {
+	return m.flagDeadline().Sub(at).Milliseconds()
+}
+
+func (m *MatchND) lastMoveAt() time.Time {
+	at := m.StartedAt
+	if len(m.Moves) > 0 {
+		at = m.Moves[len(m.Moves)-1].RegisteredAt
+	}
+	if m.resumedAt.After(at) {
+		return m.resumedAt
+	}
+	return at
+}
+
+// chargeClock takes the time elapsed since the previous move (or since the start of the match)
+// off pid's clock, and adds the TD increment. It returns the time charged, and false if pid ran
+// out of time, leaving their clock to flagFell. Untimed matches are never charged.
+func (m *MatchND) chargeClock(pid string, at time.Time) (int64, bool) {
+	if m.Opts.T0 <= 0 {
+		return 0, true
+	}
+	p := m.getPlayer(pid)
+	elapsed := at.Sub(m.lastMoveAt()).Milliseconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	if elapsed >= p.TimeLeft {
+		return elapsed, false
+	}
+	p.TimeLeft += m.Opts.TD - elapsed
+	return elapsed, true
+}
+
+// landingCell returns the cell where a disc dropped at pos comes to rest, following gravity.
+// The disc falls from the top of the stick until it lands on a disc, a blocked cell or the
+// bottom. The coordinate of pos along the gravity axis is ignored. It returns nil if the top of
+// the stick is taken. Without gravity, the disc stays at pos, which must be empty
+func (m *MatchND) landingCell(pos PointND) PointND {
+	cell := append(PointND{}, pos...)
+	if m.Opts.Gravity == NO_GRAVITY {
+		if m.At(cell) != SLOT_EMPTY {
+			return nil
+		}
+		return cell
+	}
+	g := m.Opts.Gravity
+	cell[g] = m.Opts.Dims[g] - 1
+	if m.At(cell) != SLOT_EMPTY {
+		return nil
+	}
+	step := m.strides[g]
+	for idx := m.index(cell); cell[g] > 0 && m.Cells[idx-step] == SLOT_EMPTY; idx -= step {
+		cell[g]--
+	}
+	return cell
+}
+
+func (m *MatchND) getVictoryLine(cell PointND, dir PointND) LineND {
+	v := m.At(cell)
+	if v == SLOT_EMPTY {
+		return nil
+	}
+	line := LineND{cell}
+	//on wrapping boards a line can come back to its own cells
+	seen := map[int]bool{m.index(cell): true}
+	for _, sign := range []int{1, -1} {
+		p := append(PointND{}, cell...)
+		for m.step(p, dir, sign) && m.At(p) == v && !seen[m.index(p)] {
+			seen[m.index(p)] = true
+			line = append(line, append(PointND{}, p...))
+		}
+	}
+	if len(line) == m.Opts.A || (len(line) > m.Opts.A && !m.Opts.Exact) {
+		return line
+	}
+	return nil
+}
+
+// isGameover checks the move that landed at cell. The line counters tell whether it won, in
+// O(lines through the cell); only then are the winning lines traced to their full length.
+// The game is also drawn as soon as no player left can complete a line, before the board fills.
+// In PopOut, pops can open lines again and a full board only ends the game if the player to
+// move has nothing to pop.
+func (m *MatchND) isGameover(cell PointND) GameoverResult {
+	if m.Opts.Scoring {
+		return m.score(cell)
+	}
+	if m.completesLine(m.index(cell)) {
+		var lines []LineND
+		for _, dir := range m.dirs {
+			line := m.getVictoryLine(cell, dir)
+			if line != nil {
+				lines = append(lines, line)
+			}
+		}
+		//with the Exact rule, the completed lines may all be overlines
+		if lines != nil {
+			return GameoverResult{"resType": RESULT_TYPE_WON, "lines": lines}
+		}
+	}
+
+	if m.Opts.Variant == VARIANT_POPOUT {
+		if m.full() && !m.canPop(m.getCurrPlayerID()) {
+			return GameoverResult{"resType": RESULT_TYPE_DRAW, "reason": DRAW_REASON_BOARD_FULL}
+		}
+		return m.repetitionDraw()
+	}
+	if m.full() {
+		return GameoverResult{"resType": RESULT_TYPE_DRAW, "reason": DRAW_REASON_BOARD_FULL}
+	}
+	for seat, p := range m.Players {
+		if !p.Eliminated && m.alive[seat] > 0 {
+			return nil
+		}
+	}
+	return GameoverResult{"resType": RESULT_TYPE_DRAW, "reason": DRAW_REASON_NO_LINES_LEFT}
+}
+
+// full reports whether no disc can be placed anymore: every cell is taken, or, with gravity,
+// the cells left empty lie under blocked cells, where no disc can fall
+func (m *MatchND) full() bool {
+	if m.discs >= len(m.Cells) {
+		return true
+	}
+	g := m.Opts.Gravity
+	if g == NO_GRAVITY || m.Opts.Blocked == nil {
+		return false
+	}
+	for idx := range m.Cells {
+		//a stick, from its bottom cell
+		if idx/m.strides[g]%m.Opts.Dims[g] == 0 && m.landingCell(m.point(idx)) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// point returns the cell with index idx
+func (m *MatchND) point(idx int) PointND {
+	p := make(PointND, len(m.strides))
+	for axis, stride := range m.strides {
+		p[axis] = idx / stride
+		idx %= stride
+	}
+	return p
+}
+
+// score records the lines completed by the last move, which landed at cell. Scoring matches end
+// when the board is full or when no player left can complete a line, and the best score wins
+func (m *MatchND) score(cell PointND) GameoverResult {
+	idx := m.index(cell)
+	who := int(m.Cells[idx]) - 1
+	move := &m.Moves[len(m.Moves)-1]
+	for _, l := range m.lines.byCell[idx] {
+		//the lines through cell were one disc short before the move
+		if m.lineCounts[l][who] == m.Opts.A {
+			line := make(LineND, len(m.lines.lines[l]))
+			for i, c := range m.lines.lines[l] {
+				line[i] = m.point(c)
+			}
+			move.Completed = append(move.Completed, line)
+		}
+	}
+	m.Scores[who] += len(move.Completed)
+
+	if !m.full() {
+		for seat, p := range m.Players {
+			//the completed lines are still alive for their owner, and score once each
+			if !p.Eliminated && m.alive[seat] > m.Scores[seat] {
+				return nil
+			}
+		}
+	}
+	best, winners := -1, []int{}
+	for seat, p := range m.Players {
+		switch {
+		case p.Eliminated:
+		case m.Scores[seat] > best:
+			best, winners = m.Scores[seat], []int{seat}
+		case m.Scores[seat] == best:
+			winners = append(winners, seat)
+		}
+	}
+	if len(winners) > 1 {
+		return GameoverResult{"resType": RESULT_TYPE_DRAW, "reason": DRAW_REASON_EQUAL_SCORES, "scores": slices.Clone(m.Scores)}
+	}
+	return GameoverResult{"resType": RESULT_TYPE_WON, "winnerID": m.Players[winners[0]].ID, "scores": slices.Clone(m.Scores)}
+}
+
+// checkTurn checks that pid can move now
+func (m *MatchND) checkTurn(pid string) error {
+	if m.Gameover {
+		return fmt.Errorf("game is over")
+	}
+	if !m.Started {
+		return fmt.Errorf("match has not started yet")
+	}
+	if m.getCurrPlayerID() != pid {
+		return fmt.Errorf("not your turn")
+	}
+	return nil
+}
+
+// checkMove runs the checks shared by every kind of move of pid at pos
+func (m *MatchND) checkMove(pos PointND, pid string) error {
+	if m.Gameover {
+		return fmt.Errorf("game is over")
+	}
+	if !m.Started {
+		return fmt.Errorf("match has not started yet")
+	}
+	if len(pos) != len(m.Opts.Dims) {
+		return fmt.Errorf("invalid move. expected %d coordinates", len(m.Opts.Dims))
+	}
+	for axis, c := range pos {
+		if axis != m.Opts.Gravity && (c < 0 || c >= m.Opts.Dims[axis]) {
+			return fmt.Errorf("invalid %s", m.axisName(axis))
+		}
+	}
+	if m.getCurrPlayerID() != pid {
+		return fmt.Errorf("not your turn")
+	}
+	return nil
+}
+
+// recordMove adds move to the history once the board was updated, and lets the pending
+// offers expire
+func (m *MatchND) recordMove(move MoveND, pid string) {
+	if m.DrawOfferedBy != "" && m.DrawOfferedBy != pid {
+		//moving instead of answering lets the opponent's draw offer expire
+		m.DrawOfferedBy = ""
+	}
+	m.TakebackRequestedBy = ""
+	move.Seat = m.turn
+	m.Moves = append(m.Moves, move)
+	m.nextTurn()
+	//a swap leaves the board and the slot to move as they were
+	if m.Opts.Variant == VARIANT_POPOUT && move.Kind != MOVE_KIND_SWAP {
+		m.recordPosition()
+	}
+}
+
+// Play registers pid's move of dropping a disc at pos, at the given time
+func (m *MatchND) Play(pos PointND, at time.Time, pid string) (GameoverResult, error) {
+	if err := m.checkMove(pos, pid); err != nil {
+		return nil, err
+	}
+	cell := m.landingCell(pos)
+	if cell == nil && m.Opts.Gravity == NO_GRAVITY && m.At(pos) == SLOT_BLOCKED {
+		return nil, fmt.Errorf("invalid move. cell is blocked")
+	}
+	if cell == nil && m.Opts.Gravity == NO_GRAVITY {
+		return nil, fmt.Errorf("invalid move. cell is taken")
+	}
+	if cell == nil {
+		return nil, fmt.Errorf("invalid move. column is full")
+	}
+	spent, ok := m.chargeClock(pid, at)
+	if !ok {
+		return m.flagFell(), nil
+	}
+	m.setCell(m.index(cell), m.slotOf(pid))
+	m.recordMove(MoveND{Cell: cell, RegisteredAt: at, TimeSpent: spent}, pid)
+	res := m.isGameover(cell)
+	if res != nil {
+		m.Gameover = true
+		m.Result = res
+	}
+	return res, nil
+}
+
+// Swap registers pid's pie rule move, at the given time: instead of answering the first move,
+// the second player takes over its disc. The players of the first two seats are exchanged, clocks
+// included, so the first player moves next with the other color
+func (m *MatchND) Swap(pid string, at time.Time) (GameoverResult, error) {
+	if !m.Opts.Pie {
+		return nil, fmt.Errorf("invalid move. swapping is only allowed with the pie rule")
+	}
+	if err := m.checkTurn(pid); err != nil {
+		return nil, err
+	}
+	if len(m.Moves) != 1 {
+		return nil, fmt.Errorf("invalid move. you can only swap right after the first move")
+	}
+	spent, ok := m.chargeClock(pid, at)
+	if !ok {
+		return m.flagFell(), nil
+	}
+	m.Players[0], m.Players[1] = m.Players[1], m.Players[0]
+	m.turn = m.SeatOf(pid)
+	m.recordMove(MoveND{Cell: m.Moves[0].Cell, Kind: MOVE_KIND_SWAP, RegisteredAt: at, TimeSpent: spent}, pid)
+	return nil, nil
+}
@@ -0,0 +1,204 @@
+package core
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestLineDirections(t *testing.T) {
+	for n, want := range map[int]int{2: 4, 3: 13, 4: 40} {
+		if got := len(lineDirections(n)); got != want {
+			t.Errorf("expected %d directions in %dD, got %d", want, n, got)
+		}
+	}
+}
+
+func TestMatchND_Play_Win4D(t *testing.T) {
+	opts := MatchOptsND{Dims: []int{3, 3, 3, 3}, Gravity: 3, A: 3, Starts1: true}
+	match, err := NewMatchND("p1", "p2", opts)
+	if err != nil {
+		t.Fatal("unexpected err in match creation: ", err)
+	}
+	match.Started = true
+
+	// p1 builds a diagonal through the first three axes, p2 plays elsewhere
+	moves := []PointND{
+		{0, 0, 0, 0}, {0, 2, 0, 0},
+		{1, 1, 1, 0}, {0, 2, 1, 0},
+		{2, 2, 2, 0},
+	}
+	var res GameoverResult
+	for i, pos := range moves {
+		pid := "p1"
+		if i%2 != 0 {
+			pid = "p2"
+		}
+		res, err = match.Play(pos, time.Now(), pid)
+		if err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	if res == nil || res["resType"] != RESULT_TYPE_WON {
+		t.Fatalf("expected result type to be WON, got %v", res)
+	}
+}
+
+func TestMatchND_Play_Gravity(t *testing.T) {
+	opts := MatchOptsND{Dims: []int{3, 3}, Gravity: 1, A: 3, Starts1: true}
+	match, _ := NewMatchND("p1", "p2", opts)
+	match.Started = true
+
+	// the coordinate along the gravity axis is ignored
+	if _, err := match.Play(PointND{1, 2}, time.Now(), "p1"); err != nil {
+		t.Fatalf("unexpected error on move 1: %v", err)
+	}
+	if match.At(PointND{1, 0}) != SLOT_PLAYER1 {
+		t.Fatal("expected the disc to fall to coordinate 0 of the gravity axis")
+	}
+	if _, err := match.Play(PointND{3, 0}, time.Now(), "p2"); err == nil {
+		t.Fatal("expected an error for a coordinate out of the board, but got nil")
+	}
+}
+
+func TestMatch2D_RegisterMove_WinningLineCoordinates(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	moves := []Move{{Col: 0}, {Col: 0}, {Col: 1}, {Col: 1}, {Col: 2}, {Col: 2}, {Col: 3}}
+	var res GameoverResult
+	for i, move := range moves {
+		pid := "p1"
+		if i%2 != 0 {
+			pid = "p2"
+		}
+		res, _ = match.RegisterMove(move, pid)
+	}
+	lines, ok := res["lines"].([]Line)
+	if !ok || len(lines) != 1 {
+		t.Fatalf("expected one winning line, got %v", res["lines"])
+	}
+	for _, p := range lines[0] {
+		if p.Row != opts.H-1 {
+			t.Fatalf("expected the winning line to be on the bottom row, got %+v", lines[0])
+		}
+		if match.Board[p.Row][p.Col] != SLOT_PLAYER1 {
+			t.Fatalf("expected %+v to belong to p1", p)
+		}
+	}
+}
+
+func TestMatchND_Join(t *testing.T) {
+	opts := MatchOptsND{Dims: []int{6, 7}, Gravity: 0, A: 4, Starts1: true, Players: 3}
+	match, err := NewMatchND("p1", "", opts)
+	if err != nil {
+		t.Fatal("unexpected err in match creation: ", err)
+	}
+	if joined, err := match.Join("p2", time.Now()); !joined || err != nil {
+		t.Fatalf("expected p2 to take a seat, got %v, %v", joined, err)
+	}
+	if match.Started {
+		t.Fatal("expected the match to wait for its last seat")
+	}
+	if joined, err := match.Join("p2", time.Now()); joined || err != nil {
+		t.Fatalf("expected p2 to keep their seat, got %v, %v", joined, err)
+	}
+	if joined, err := match.Join("p3", time.Now()); !joined || err != nil {
+		t.Fatalf("expected p3 to take a seat, got %v, %v", joined, err)
+	}
+	if !match.Started || match.SeatOf("p3") != 2 {
+		t.Fatal("expected the match to start once every seat is taken")
+	}
+	if _, err := match.Join("p4", time.Now()); err == nil {
+		t.Fatal("expected an error for joining a full match")
+	}
+}
+
+func TestMatchND_Play_TurnRotation(t *testing.T) {
+	opts := MatchOptsND{Dims: []int{6, 7}, Gravity: 0, A: 4, Players: 3}
+	match, _ := NewMatchND("p1", "p2", opts)
+	match.Join("p3", time.Now())
+
+	// without Starts1, the second seat moves first
+	for i, pid := range []string{"p2", "p3", "p1", "p2"} {
+		if _, err := match.Play(PointND{0, i}, time.Now(), pid); err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	if _, err := match.Play(PointND{0, 4}, time.Now(), "p1"); err == nil {
+		t.Fatal("expected an error for playing out of turn")
+	}
+	if match.At(PointND{0, 1}) != SLOT_PLAYER3 || match.Moves[1].Seat != 2 {
+		t.Fatal("expected the second move to be p3's")
+	}
+	checkLineCounters(t, match)
+}
+
+func TestMatchND_Resign_Elimination(t *testing.T) {
+	opts := MatchOptsND{Dims: []int{6, 7}, Gravity: 0, A: 4, Starts1: true, Players: 3}
+	match, _ := NewMatchND("p1", "p2", opts)
+	match.Join("p3", time.Now())
+	match.Play(PointND{0, 0}, time.Now(), "p1")
+
+	res, err := match.Resign("p3", time.Now())
+	if err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if res["loserID"] != "p3" || res["winnerID"] != nil || match.Gameover {
+		t.Fatalf("expected the match to go on without p3, got %v", res)
+	}
+	if _, err := match.Resign("p3", time.Now()); err == nil {
+		t.Fatal("expected an error for resigning twice")
+	}
+	if _, err := match.Play(PointND{0, 1}, time.Now(), "p2"); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if match.getCurrPlayerID() != "p1" {
+		t.Fatalf("expected the turn to skip p3, got %s", match.getCurrPlayerID())
+	}
+
+	res, _ = match.Resign("p1", time.Now())
+	if !match.Gameover || res["winnerID"] != "p2" {
+		t.Fatalf("expected p2 to win as the last player left, got %v", res)
+	}
+}
+
+func TestMatchND_FlagFall_Elimination(t *testing.T) {
+	opts := MatchOptsND{Dims: []int{6, 7}, Gravity: 0, A: 4, Starts1: true, Players: 3, T0: 1000}
+	match, _ := NewMatchND("p1", "p2", opts)
+	start := time.Now()
+	match.Join("p3", start)
+
+	res := match.FlagFall(start.Add(1500 * time.Millisecond))
+	if res["loserID"] != "p1" || match.Gameover {
+		t.Fatalf("expected p1 to be eliminated, got %v", res)
+	}
+	// p2's clock starts when p1's flag fell, not when it was noticed
+	if res := match.FlagFall(start.Add(1900 * time.Millisecond)); res != nil {
+		t.Fatalf("expected p2 to have time left, got %v", res)
+	}
+	if _, err := match.Play(PointND{0, 0}, start.Add(1500*time.Millisecond), "p2"); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if spent := match.Moves[0].TimeSpent; spent != 500 {
+		t.Fatalf("expected p2 to be charged 500ms, got %d", spent)
+	}
+}
+
+func TestMatchND_LineCounters_FourPlayers(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	opts := MatchOptsND{Dims: []int{5, 6}, Gravity: 0, A: 3, Starts1: true, Players: 4}
+	for range 20 {
+		match, _ := NewMatchND("p1", "p2", opts)
+		match.Join("p3", time.Now())
+		match.Join("p4", time.Now())
+		for !match.Gameover {
+			pid := match.getCurrPlayerID()
+			if _, err := match.Play(PointND{0, rng.Intn(6)}, time.Now(), pid); err != nil {
+				continue
+			}
+			checkLineCounters(t, match)
+		}
+	}
+}
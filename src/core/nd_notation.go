@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// slotChars holds the character of each slot in position strings, indexed by Slot. Empty cells
+// are not written as such: runs of them are written as their length, like in chess FEN
+const slotChars = ".xoyz#"
+
+// SWAP_NOTATION is the notation of a pie rule swap, in the move lists of every board
+const SWAP_NOTATION = "s"
+
+// formatCells appends cells to sb, in the position string format
+func formatCells(sb *strings.Builder, cells []Slot) {
+	empty := 0
+	for _, s := range cells {
+		if s == SLOT_EMPTY {
+			empty++
+			continue
+		}
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+			empty = 0
+		}
+		sb.WriteByte(slotChars[s])
+	}
+	if empty > 0 {
+		sb.WriteString(strconv.Itoa(empty))
+	}
+}
+
+// parseCells parses n cells written by formatCells
+func parseCells(s string, n int) ([]Slot, error) {
+	cells := make([]Slot, 0, n)
+	for i := 0; i < len(s); {
+		j := i
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+		if j > i {
+			empty, _ := strconv.Atoi(s[i:j])
+			if empty == 0 || len(cells)+empty > n {
+				return nil, fmt.Errorf("invalid position. expected %d cells in %q", n, s)
+			}
+			cells = append(cells, make([]Slot, empty)...)
+			i = j
+			continue
+		}
+		slot := strings.IndexByte(slotChars, s[i])
+		if slot <= int(SLOT_EMPTY) {
+			return nil, fmt.Errorf("invalid position. unexpected %q", s[i])
+		}
+		cells = append(cells, Slot(slot))
+		i++
+	}
+	if len(cells) != n {
+		return nil, fmt.Errorf("invalid position. expected %d cells in %q", n, s)
+	}
+	return cells, nil
+}
+
+// parseSlot parses the side to move of a position string
+func parseSlot(s string) (Slot, error) {
+	slot := strings.Index(slotChars, s)
+	if len(s) != 1 || slot <= int(SLOT_EMPTY) || Slot(slot) == SLOT_BLOCKED {
+		return SLOT_EMPTY, fmt.Errorf("invalid position. unexpected side to move %q", s)
+	}
+	return Slot(slot), nil
+}
+
+// parseDims parses the dimensions of a position string, such as 7x6
+func parseDims(s string, n int) ([]int, error) {
+	parts := strings.Split(s, "x")
+	if len(parts) != n {
+		return nil, fmt.Errorf("invalid position. expected %d dimensions, got %q", n, s)
+	}
+	dims := make([]int, n)
+	for i, part := range parts {
+		d, err := strconv.Atoi(part)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid position. invalid dimension %q", part)
+		}
+		dims[i] = d
+	}
+	return dims, nil
+}
+
+// setPosition fills the board of a new match with cells, given in the order of Cells, and gives
+// the turn to the player with slot turn. Blocked cells must be the match's own. Discs can't float
+// on boards with gravity, and lines can't be complete already, except in scoring matches, where
+// they make up the scores. The position has no history, so Moves stays empty
+func (m *MatchND) setPosition(cells []Slot, turn Slot) error {
+	if int(turn) > len(m.Players) {
+		return fmt.Errorf("invalid position. no player %c in a %d-player match", slotChars[turn], len(m.Players))
+	}
+	g := m.Opts.Gravity
+	for idx, s := range cells {
+		if (s == SLOT_BLOCKED) != (m.Cells[idx] == SLOT_BLOCKED) {
+			return fmt.Errorf("invalid position. blocked cells don't match the board")
+		}
+		if s == SLOT_EMPTY || s == SLOT_BLOCKED {
+			continue
+		}
+		if int(s) > len(m.Players) {
+			return fmt.Errorf("invalid position. no player %c in a %d-player match", slotChars[s], len(m.Players))
+		}
+		if g != NO_GRAVITY && idx/m.strides[g]%m.Opts.Dims[g] > 0 && cells[idx-m.strides[g]] == SLOT_EMPTY {
+			return fmt.Errorf("invalid position. a disc floats above an empty cell")
+		}
+		m.setCell(idx, s)
+	}
+	for _, counts := range m.lineCounts {
+		for seat := range m.Players {
+			if counts[seat] < m.Opts.A {
+				continue
+			}
+			if !m.Opts.Scoring {
+				return fmt.Errorf("invalid position. a line is complete already")
+			}
+			m.Scores[seat]++
+		}
+	}
+	m.turn = int(turn) - 1
+	if m.repetitions != nil {
+		m.positions = nil
+		m.repetitions = map[string]int{}
+		m.recordPosition()
+	}
+	return nil
+}
+
+// parseCoords parses a move of the form 4,3 whose coordinates are counted from 1, and returns
+// them counted from 0
+func parseCoords(s string, n int) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("invalid move %q. expected %d coordinates", s, n)
+	}
+	coords := make([]int, n)
+	for i, part := range parts {
+		c, err := strconv.Atoi(part)
+		if err != nil || c < 1 {
+			return nil, fmt.Errorf("invalid move %q", s)
+		}
+		coords[i] = c - 1
+	}
+	return coords, nil
+}
+
+// formatCoords writes coords, counted from 0, as a move of the form 4,3 counted from 1
+func formatCoords(coords ...int) string {
+	parts := make([]string, len(coords))
+	for i, c := range coords {
+		parts[i] = strconv.Itoa(c + 1)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Pop registers pid's PopOut move of removing their own disc from the bottom of the stick at
+// pos, at the given time. The discs above it fall by one cell. The coordinate of pos along the
+// gravity axis is ignored
+func (m *MatchND) Pop(pos PointND, at time.Time, pid string) (GameoverResult, error) {
+	if m.Opts.Variant != VARIANT_POPOUT {
+		return nil, fmt.Errorf("invalid move. popping is only allowed in PopOut matches")
+	}
+	if err := m.checkMove(pos, pid); err != nil {
+		return nil, err
+	}
+	cell := append(PointND{}, pos...)
+	cell[m.Opts.Gravity] = 0
+	if m.At(cell) != m.slotOf(pid) {
+		return nil, fmt.Errorf("invalid move. you can only pop your own discs")
+	}
+	spent, ok := m.chargeClock(pid, at)
+	if !ok {
+		return m.flagFell(), nil
+	}
+	m.popStick(cell)
+	m.recordMove(MoveND{Cell: cell, Kind: MOVE_KIND_POP, RegisteredAt: at, TimeSpent: spent}, pid)
+	res := m.popResult(cell, pid)
+	if res == nil {
+		res = m.repetitionDraw()
+	}
+	if res != nil {
+		m.Gameover = true
+		m.Result = res
+	}
+	return res, nil
+}
+
+// popStick removes the disc at bottom, and lets the discs above it fall by one cell
+func (m *MatchND) popStick(bottom PointND) {
+	idx := m.index(bottom)
+	step := m.strides[m.Opts.Gravity]
+	m.clearCell(idx)
+	for k := 1; k < m.Opts.Dims[m.Opts.Gravity]; k++ {
+		s := m.Cells[idx+k*step]
+		if s == SLOT_EMPTY {
+			break
+		}
+		m.clearCell(idx + k*step)
+		m.setCell(idx+(k-1)*step, s)
+	}
+}
+
+// unpopStick undoes popStick: it lifts the discs of the stick by one cell and puts s back at bottom
+func (m *MatchND) unpopStick(bottom PointND, s Slot) {
+	idx := m.index(bottom)
+	step := m.strides[m.Opts.Gravity]
+	top := 0
+	for top < m.Opts.Dims[m.Opts.Gravity] && m.Cells[idx+top*step] != SLOT_EMPTY {
+		top++
+	}
+	for k := top - 1; k >= 0; k-- {
+		v := m.Cells[idx+k*step]
+		m.clearCell(idx + k*step)
+		m.setCell(idx+(k+1)*step, v)
+	}
+	m.setCell(idx, s)
+}
+
+// canPop reports whether pid has a disc at the bottom of some stick
+func (m *MatchND) canPop(pid string) bool {
+	s := m.slotOf(pid)
+	g := m.Opts.Gravity
+	for idx, v := range m.Cells {
+		if v == s && idx/m.strides[g]%m.Opts.Dims[g] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// popResult checks every disc of the stick a pop shifted, since the fall can complete lines for
+// both players at once. If it completes lines for the popping player, they win even if their
+// opponent got a line too. If it only completes lines for the opponent, the opponent wins.
+// Results of pops name the winner, as it is not always the mover
+func (m *MatchND) popResult(bottom PointND, pid string) GameoverResult {
+	lines := map[Slot][]LineND{}
+	seen := map[string]bool{}
+	for k := range m.Opts.Dims[m.Opts.Gravity] {
+		//a fresh cell each time, as the traced lines start with it
+		cell := append(PointND{}, bottom...)
+		cell[m.Opts.Gravity] = k
+		s := m.At(cell)
+		if s == SLOT_EMPTY {
+			break
+		}
+		if !m.completesLine(m.index(cell)) {
+			continue
+		}
+		for d, dir := range m.dirs {
+			line := m.getVictoryLine(cell, dir)
+			if line == nil {
+				continue
+			}
+			//the same line is traced from each of its discs in the stick
+			first := slices.MinFunc(line, func(a, b PointND) int { return m.index(a) - m.index(b) })
+			key := fmt.Sprint(d, m.index(first))
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			lines[s] = append(lines[s], line)
+		}
+	}
+
+	winnerID := pid
+	winner := m.slotOf(pid)
+	if lines[winner] == nil {
+		winnerID = m.GetEnemyID(pid)
+		winner = m.slotOf(winnerID)
+	}
+	if lines[winner] == nil {
+		return nil
+	}
+	return GameoverResult{"resType": RESULT_TYPE_WON, "lines": lines[winner], "winnerID": winnerID}
+}
+
+// positionKey identifies the current position: the board and the player to move
+func (m *MatchND) positionKey() string {
+	key := make([]byte, len(m.Cells)+1)
+	for i, s := range m.Cells {
+		key[i] = byte(s)
+	}
+	key[len(m.Cells)] = byte(m.slotOf(m.getCurrPlayerID()))
+	return string(key)
+}
+
+func (m *MatchND) recordPosition() {
+	key := m.positionKey()
+	m.positions = append(m.positions, key)
+	m.repetitions[key]++
+}
+
+// forgetPosition drops the last recorded position, when its move is taken back
+func (m *MatchND) forgetPosition() {
+	if len(m.positions) <= 1 {
+		return
+	}
+	key := m.positions[len(m.positions)-1]
+	m.positions = m.positions[:len(m.positions)-1]
+	m.repetitions[key]--
+}
+
+// repetitionDraw ends a PopOut match as a draw once the same position occurs a third time
+func (m *MatchND) repetitionDraw() GameoverResult {
+	if len(m.positions) == 0 || m.repetitions[m.positions[len(m.positions)-1]] < 3 {
+		return nil
+	}
+	return GameoverResult{"resType": RESULT_TYPE_DRAW, "reason": DRAW_REASON_REPETITION}
+}
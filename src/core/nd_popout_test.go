@@ -0,0 +1,155 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func playCols(t *testing.T, match *Match2D, moves []Move) GameoverResult {
+	var res GameoverResult
+	for i, move := range moves {
+		var err error
+		res, err = match.RegisterMove(move, match.getCurrPlayerID())
+		if err != nil {
+			t.Fatalf("unexpected error on move %d: %v", i, err)
+		}
+	}
+	return res
+}
+
+func TestMatch2D_Pop(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Variant: VARIANT_POPOUT}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	playCols(t, match, []Move{{Col: 0}, {Col: 0}, {Col: 0}})
+	if _, err := match.RegisterMove(Move{Col: 0, Kind: MOVE_KIND_POP}, "p2"); err == nil {
+		t.Fatal("expected an error for popping the opponent's disc")
+	}
+	if _, err := match.RegisterMove(Move{Col: 1, Kind: MOVE_KIND_POP}, "p2"); err == nil {
+		t.Fatal("expected an error for popping an empty column")
+	}
+	playCols(t, match, []Move{{Col: 1}, {Col: 0, Kind: MOVE_KIND_POP}})
+
+	want := []Slot{SLOT_PLAYER2, SLOT_PLAYER1, SLOT_EMPTY}
+	for i, s := range want {
+		if got := match.Board[opts.H-1-i][0]; got != s {
+			t.Errorf("expected %v at height %d of column 0, got %v", s, i, got)
+		}
+	}
+	if match.Moves[len(match.Moves)-1].Kind != MOVE_KIND_POP {
+		t.Error("expected the last move to be a pop")
+	}
+}
+
+func TestMatch2D_Pop_ClassicMatch(t *testing.T) {
+	match, _ := NewMatch2D("p1", "p2", MatchOpts{W: 7, H: 6, A: 4, Starts1: true})
+	match.Started = true
+	playCols(t, match, []Move{{Col: 0}, {Col: 1}})
+	if _, err := match.RegisterMove(Move{Col: 0, Kind: MOVE_KIND_POP}, "p1"); err == nil {
+		t.Fatal("expected an error for popping in a classic match")
+	}
+}
+
+func TestMatch2D_Pop_OpponentWins(t *testing.T) {
+	opts := MatchOpts{W: 4, H: 4, A: 4, Starts1: true, Variant: VARIANT_POPOUT}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	// p2 fills the bottom row but p1's disc in column 0, then covers it
+	playCols(t, match, []Move{{Col: 0}, {Col: 1}, {Col: 1}, {Col: 2}, {Col: 2}, {Col: 3}, {Col: 3}, {Col: 0}})
+	res := playCols(t, match, []Move{{Col: 0, Kind: MOVE_KIND_POP}})
+
+	if res["resType"] != RESULT_TYPE_WON || res["winnerID"] != "p2" {
+		t.Fatalf("expected p2 to win, got %v", res)
+	}
+	want := []Line{{{Row: 3, Col: 0}, {Row: 3, Col: 1}, {Row: 3, Col: 2}, {Row: 3, Col: 3}}}
+	if !reflect.DeepEqual(res["lines"], want) {
+		t.Fatalf("expected lines %v, got %v", want, res["lines"])
+	}
+}
+
+func TestMatchND_Pop_BothPlayersAlign(t *testing.T) {
+	opts := MatchOptsND{Dims: []int{4, 4}, Gravity: 0, A: 4, Starts1: true, Variant: VARIANT_POPOUT}
+	match, _ := NewMatchND("p1", "p2", opts)
+	match.Started = true
+
+	// popping column 0 lets p2 complete row 0 and p1 complete row 1
+	for _, c := range []struct {
+		p PointND
+		s Slot
+	}{
+		{PointND{0, 0}, SLOT_PLAYER1}, {PointND{1, 0}, SLOT_PLAYER2}, {PointND{2, 0}, SLOT_PLAYER1},
+		{PointND{0, 1}, SLOT_PLAYER2}, {PointND{0, 2}, SLOT_PLAYER2}, {PointND{0, 3}, SLOT_PLAYER2},
+		{PointND{1, 1}, SLOT_PLAYER1}, {PointND{1, 2}, SLOT_PLAYER1}, {PointND{1, 3}, SLOT_PLAYER1},
+	} {
+		match.setCell(match.index(c.p), c.s)
+	}
+
+	res, err := match.Pop(PointND{0, 0}, time.Now(), "p1")
+	if err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if res["resType"] != RESULT_TYPE_WON || res["winnerID"] != "p1" {
+		t.Fatalf("expected the popping player to win, got %v", res)
+	}
+	lines := res["lines"].([]LineND)
+	if len(lines) != 1 || lines[0][0][0] != 1 {
+		t.Fatalf("expected p1's row to be the only line, got %v", lines)
+	}
+}
+
+func TestMatch2D_Pop_Repetition(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Variant: VARIANT_POPOUT}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+
+	// each cycle comes back to the empty board with p1 to move
+	cycle := []Move{{Col: 0}, {Col: 1}, {Col: 0, Kind: MOVE_KIND_POP}, {Col: 1, Kind: MOVE_KIND_POP}}
+	if res := playCols(t, match, cycle); res != nil {
+		t.Fatalf("expected the game to go on after the second occurrence, got %v", res)
+	}
+	res := playCols(t, match, cycle)
+	if res["resType"] != RESULT_TYPE_DRAW || res["reason"] != DRAW_REASON_REPETITION {
+		t.Fatalf("expected a draw by repetition, got %v", res)
+	}
+}
+
+func TestMatch2D_Pop_NoEarlyDraw(t *testing.T) {
+	// a classic match would be a dead draw after two moves, but pops can open the line again
+	opts := MatchOpts{W: 3, H: 1, A: 3, Starts1: true, Variant: VARIANT_POPOUT}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+	if res := playCols(t, match, []Move{{Col: 0}, {Col: 1}}); res != nil {
+		t.Fatalf("expected the game to go on, got %v", res)
+	}
+	// the board is full, and p2 has a disc to pop
+	if res := playCols(t, match, []Move{{Col: 2}}); res != nil {
+		t.Fatalf("expected the game to go on on a full board, got %v", res)
+	}
+}
+
+func TestMatch2D_Pop_Takeback(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, Variant: VARIANT_POPOUT}
+	match, _ := NewMatch2D("p1", "p2", opts)
+	match.Started = true
+	playCols(t, match, []Move{{Col: 0}, {Col: 0}, {Col: 0}, {Col: 3}, {Col: 0, Kind: MOVE_KIND_POP}})
+
+	if err := match.RequestTakeback("p1"); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	if err := match.ApproveTakeback("p2", time.Now()); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	want := []Slot{SLOT_PLAYER1, SLOT_PLAYER2, SLOT_PLAYER1, SLOT_EMPTY}
+	for i, s := range want {
+		if got := match.Board[opts.H-1-i][0]; got != s {
+			t.Errorf("expected %v at height %d of column 0, got %v", s, i, got)
+		}
+	}
+	checkLineCounters(t, match.MatchND)
+	if len(match.positions) != len(match.Moves)+1 {
+		t.Fatalf("expected %d recorded positions, got %d", len(match.Moves)+1, len(match.positions))
+	}
+}
@@ -0,0 +1,665 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Record is a game record, in the spirit of chess PGN: tag headers describing the match, then its
+// moves with their timestamps, comments and variations, then its result. Its text form is
+//
+//	[Game "2D"]
+//	[P1 "alice"]
+//	[P2 "bob"]
+//	[W "7"]
+//	...
+//	[Result "1-0"]
+//
+//	1. 4 {[%at 2025-08-01T12:00:03Z] the usual opening} 4 {[%at 2025-08-01T12:00:05Z]}
+//	2. 5 (3 {a quieter line}) 3 ... 1-0
+//
+// Move numbers are written at the start of each round of turns, and ignored when parsing. The
+// closing braces and the backslashes of comments are escaped with a backslash
+type Record struct {
+	Tags []Tag
+	// Comment is the comment written before the first move
+	Comment string
+	Moves   []RecordMove
+	// Result is the result written after the moves, like the Result tag
+	Result string
+}
+
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// RecordMove is a move of a record, in the move notation of its board. Players leaving the
+// match are written between the moves, as R or T and their seat, counted from 1, for a
+// resignation or a timeout
+type RecordMove struct {
+	Move string
+	// At is when the move was registered. It is zero if the record doesn't say
+	At      time.Time
+	Comment string
+	// Variations holds alternatives to the move, each played from the position before it
+	Variations [][]RecordMove
+}
+
+const (
+	// RESIGN_NOTATION is the notation of a resignation in record move lists, followed by the seat
+	RESIGN_NOTATION = "R"
+	// TIMEOUT_NOTATION is the notation of a timeout in record move lists, followed by the seat
+	TIMEOUT_NOTATION = "T"
+)
+
+// RESULT_UNFINISHED is the result of a match that is not over
+const RESULT_UNFINISHED = "*"
+
+// Tag returns the value of the tag with the given name, or "" if there is none
+func (r *Record) Tag(name string) string {
+	for _, t := range r.Tags {
+		if t.Name == name {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+// SetTag sets the value of the tag with the given name, adding it after the others if needed
+func (r *Record) SetTag(name, value string) {
+	for i, t := range r.Tags {
+		if t.Name == name {
+			r.Tags[i].Value = value
+			return
+		}
+	}
+	r.Tags = append(r.Tags, Tag{Name: name, Value: value})
+}
+
+// recordLineWidth is the width the move list is wrapped at
+const recordLineWidth = 80
+
+// String returns the text form of the record
+func (r *Record) String() string {
+	var sb strings.Builder
+	for _, t := range r.Tags {
+		fmt.Fprintf(&sb, "[%s %s]\n", t.Name, strconv.Quote(t.Value))
+	}
+	sb.WriteByte('\n')
+
+	var tokens []string
+	if r.Comment != "" {
+		tokens = append(tokens, "{"+escapeComment(r.Comment)+"}")
+	}
+	players := 2
+	for i := 3; r.Tag(fmt.Sprintf("P%d", i)) != ""; i++ {
+		players = i
+	}
+	tokens = appendRecordMoves(tokens, r.Moves, 0, players)
+	result := r.Result
+	if result == "" {
+		result = RESULT_UNFINISHED
+	}
+	tokens = append(tokens, result)
+
+	width := 0
+	for _, token := range tokens {
+		if width > 0 && width+1+len(token) > recordLineWidth {
+			sb.WriteByte('\n')
+			width = 0
+		} else if width > 0 {
+			sb.WriteByte(' ')
+			width++
+		}
+		sb.WriteString(token)
+		width += len(token)
+	}
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+// appendRecordMoves appends the tokens of moves to tokens. ply is how many moves were played
+// before the first one, to number the rounds of turns of players
+func appendRecordMoves(tokens []string, moves []RecordMove, ply int, players int) []string {
+	if ply%players != 0 && len(moves) > 0 {
+		tokens = append(tokens, fmt.Sprintf("%d...", ply/players+1))
+	}
+	for _, move := range moves {
+		out := isOutNotation(move.Move)
+		if !out && ply%players == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d.", ply/players+1))
+		}
+		tokens = append(tokens, move.Move)
+		var comment []string
+		if !move.At.IsZero() {
+			comment = append(comment, "[%at "+move.At.Format(time.RFC3339Nano)+"]")
+		}
+		if move.Comment != "" {
+			comment = append(comment, escapeComment(move.Comment))
+		}
+		if comment != nil {
+			tokens = append(tokens, "{"+strings.Join(comment, " ")+"}")
+		}
+		for _, variation := range move.Variations {
+			tokens = append(tokens, "(")
+			tokens = appendRecordMoves(tokens, variation, ply, players)
+			tokens = append(tokens, ")")
+		}
+		if !out {
+			ply++
+		}
+	}
+	return tokens
+}
+
+// commentEscaper escapes the braces ending comments, and the backslashes escaping them
+var commentEscaper = strings.NewReplacer(`\`, `\\`, "}", `\}`)
+
+// escapeComment escapes comment to write it between braces
+func escapeComment(comment string) string {
+	return commentEscaper.Replace(comment)
+}
+
+// commentEnd returns the index of the brace ending the comment that s starts with, or -1. It
+// skips the escaped braces
+func commentEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeComment undoes escapeComment. Other backslashes are kept as they are
+func unescapeComment(comment string) string {
+	var sb strings.Builder
+	for i := 0; i < len(comment); i++ {
+		if comment[i] == '\\' && i+1 < len(comment) && (comment[i+1] == '\\' || comment[i+1] == '}') {
+			i++
+		}
+		sb.WriteByte(comment[i])
+	}
+	return sb.String()
+}
+
+// isOutNotation reports whether token is a resignation or a timeout
+func isOutNotation(token string) bool {
+	_, _, ok := parseOutNotation(token)
+	return ok
+}
+
+// parseOutNotation parses a resignation or a timeout, and returns its reason and seat
+func parseOutNotation(token string) (RESULT_TYPE, int, bool) {
+	if len(token) < 2 {
+		return 0, 0, false
+	}
+	seat, err := strconv.Atoi(token[1:])
+	if err != nil || seat < 1 || seat > MAX_PLAYERS {
+		return 0, 0, false
+	}
+	switch token[:1] {
+	case RESIGN_NOTATION:
+		return RESULT_TYPE_RESIGN, seat - 1, true
+	case TIMEOUT_NOTATION:
+		return RESULT_TYPE_TIMEOUT, seat - 1, true
+	}
+	return 0, 0, false
+}
+
+var (
+	tagRegexp        = regexp.MustCompile(`^\[(\w+)\s+("(?:[^"\\]|\\.)*")\]$`)
+	moveNumberRegexp = regexp.MustCompile(`^\d+\.+$`)
+	resultRegexp     = regexp.MustCompile(`^(\*|[\d/]+(-[\d/]+)+)$`)
+	atRegexp         = regexp.MustCompile(`\[%at ([^\]]*)\]`)
+)
+
+// ParseRecord parses the text form of a record. It only checks the syntax: ImportRecord2D and
+// ImportRecord3D check that the moves can be played
+func ParseRecord(s string) (*Record, error) {
+	r := &Record{}
+	lines := strings.Split(s, "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "[") {
+			break
+		}
+		m := tagRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("invalid record. invalid tag %s", line)
+		}
+		value, err := strconv.Unquote(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid record. invalid tag %s", line)
+		}
+		r.Tags = append(r.Tags, Tag{Name: m[1], Value: value})
+	}
+	if err := r.parseMoves(strings.Join(lines[i:], "\n")); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseMoves parses the move list of a record, up to its result
+func (r *Record) parseMoves(s string) error {
+	//stack holds the line being parsed, after the lines it is a variation of
+	stack := []*[]RecordMove{&r.Moves}
+	pending := ""
+	addComment := func(comment string) error {
+		var at time.Time
+		if m := atRegexp.FindStringSubmatch(comment); m != nil {
+			var err error
+			if at, err = time.Parse(time.RFC3339Nano, m[1]); err != nil {
+				return fmt.Errorf("invalid record. invalid time %q", m[1])
+			}
+			comment = atRegexp.ReplaceAllString(comment, "")
+		}
+		comment = strings.TrimSpace(comment)
+		line := stack[len(stack)-1]
+		switch {
+		case len(*line) > 0:
+			last := &(*line)[len(*line)-1]
+			if !at.IsZero() {
+				last.At = at
+			}
+			last.Comment = strings.TrimSpace(last.Comment + " " + comment)
+		case len(stack) == 1:
+			r.Comment = strings.TrimSpace(r.Comment + " " + comment)
+		default:
+			pending = strings.TrimSpace(pending + " " + comment)
+		}
+		return nil
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '{':
+			end := commentEnd(s[i:])
+			if end < 0 {
+				return fmt.Errorf("invalid record. unterminated comment")
+			}
+			if err := addComment(unescapeComment(s[i+1 : i+end])); err != nil {
+				return err
+			}
+			i += end + 1
+		case c == ';':
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s) - i
+			}
+			if err := addComment(s[i+1 : i+end]); err != nil {
+				return err
+			}
+			i += end
+		case c == '(':
+			line := stack[len(stack)-1]
+			if len(*line) == 0 {
+				return fmt.Errorf("invalid record. variation before any move")
+			}
+			stack = append(stack, &[]RecordMove{})
+			i++
+		case c == ')':
+			if len(stack) == 1 {
+				return fmt.Errorf("invalid record. unexpected )")
+			}
+			variation := *stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			line := *stack[len(stack)-1]
+			line[len(line)-1].Variations = append(line[len(line)-1].Variations, variation)
+			i++
+		default:
+			end := i
+			for end < len(s) && !unicode.IsSpace(rune(s[end])) && !strings.ContainsRune("{}();", rune(s[end])) {
+				end++
+			}
+			token := s[i:end]
+			i = end
+			switch {
+			case moveNumberRegexp.MatchString(token):
+			case resultRegexp.MatchString(token):
+				if len(stack) > 1 {
+					return fmt.Errorf("invalid record. result inside a variation")
+				}
+				r.Result = token
+			case r.Result != "":
+				return fmt.Errorf("invalid record. move %s after the result", token)
+			default:
+				line := stack[len(stack)-1]
+				*line = append(*line, RecordMove{Move: token, Comment: pending})
+				pending = ""
+			}
+		}
+	}
+	if len(stack) > 1 {
+		return fmt.Errorf("invalid record. unterminated variation")
+	}
+	return nil
+}
+
+// ResultNotation returns the result of the match in record notation: the points of each seat
+// separated by dashes, such as 1-0 or 1/2-1/2. The winner gets 1, and players sharing a draw or
+// the best score split it. Eliminated players get 0. It is RESULT_UNFINISHED until the match is over
+func (m *MatchND) ResultNotation() string {
+	if !m.Gameover || m.Result == nil {
+		return RESULT_UNFINISHED
+	}
+	var winners []int
+	switch {
+	case m.Result["winnerID"] != nil:
+		winners = []int{m.SeatOf(m.Result["winnerID"].(string))}
+	case m.Result["reason"] == DRAW_REASON_EQUAL_SCORES:
+		best := -1
+		for seat, p := range m.Players {
+			switch {
+			case p.Eliminated:
+			case m.Scores[seat] > best:
+				best, winners = m.Scores[seat], []int{seat}
+			case m.Scores[seat] == best:
+				winners = append(winners, seat)
+			}
+		}
+	case m.Result["resType"] == RESULT_TYPE_WON:
+		//lines completed by the mover
+		winners = []int{m.Moves[len(m.Moves)-1].Seat}
+	default:
+		for seat, p := range m.Players {
+			if !p.Eliminated {
+				winners = append(winners, seat)
+			}
+		}
+	}
+	points := make([]string, len(m.Players))
+	for seat := range points {
+		points[seat] = "0"
+	}
+	for _, seat := range winners {
+		points[seat] = "1"
+		if len(winners) > 1 {
+			points[seat] = fmt.Sprintf("1/%d", len(winners))
+		}
+	}
+	return strings.Join(points, "-")
+}
+
+// drawReasonNotations holds the Termination tag of each DRAW_REASON
+var drawReasonNotations = []string{"board full", "no lines left", "agreement", "repetition", "scores"}
+
+// TerminationNotation returns how the match ended, for the Termination tag of its record
+func (m *MatchND) TerminationNotation() string {
+	if !m.Gameover || m.Result == nil {
+		return "unterminated"
+	}
+	switch m.Result["resType"] {
+	case RESULT_TYPE_WON:
+		if m.Opts.Scoring {
+			return "scores"
+		}
+		return "line"
+	case RESULT_TYPE_DRAW:
+		return drawReasonNotations[m.Result["reason"].(DRAW_REASON)]
+	case RESULT_TYPE_TIMEOUT:
+		return "time forfeit"
+	}
+	return "resignation"
+}
+
+// newRecord returns a record of the match with the tags shared by every board, around the tags of
+// the board. Each move is written with format, in the move notation of the board
+func (m *MatchND) newRecord(game string, boardTags []Tag, format func(move MoveND) string) *Record {
+	r := &Record{Tags: []Tag{{Name: "Game", Value: game}}}
+	ids := make([]string, len(m.Players))
+	for seat, p := range m.Players {
+		ids[seat] = p.ID
+	}
+	//the players are written in their seats at the start, which the swap of the moves changes
+	if len(m.Moves) > 1 && m.Moves[1].Kind == MOVE_KIND_SWAP {
+		ids[0], ids[1] = ids[1], ids[0]
+	}
+	for seat, id := range ids {
+		r.SetTag(fmt.Sprintf("P%d", seat+1), id)
+	}
+	r.Tags = append(r.Tags, boardTags...)
+	starts := 1
+	if !m.Opts.Starts1 {
+		starts = 2
+	}
+	r.SetTag("Starts", strconv.Itoa(starts))
+	timeControl := "-"
+	if m.Opts.T0 > 0 {
+		timeControl = fmt.Sprintf("%d+%d", m.Opts.T0, m.Opts.TD)
+	}
+	r.SetTag("TimeControl", timeControl)
+	if m.Started {
+		r.SetTag("Start", m.StartedAt.Format(time.RFC3339Nano))
+	}
+	r.Result = m.ResultNotation()
+	r.SetTag("Result", r.Result)
+	r.SetTag("Termination", m.TerminationNotation())
+
+	outs := m.Eliminations
+	writeOuts := func(ply int) {
+		for len(outs) > 0 && outs[0].Ply == ply {
+			notation := RESIGN_NOTATION
+			if outs[0].Reason == RESULT_TYPE_TIMEOUT {
+				notation = TIMEOUT_NOTATION
+			}
+			r.Moves = append(r.Moves, RecordMove{Move: fmt.Sprintf("%s%d", notation, outs[0].Seat+1), At: outs[0].At})
+			outs = outs[1:]
+		}
+	}
+	for i, move := range m.Moves {
+		writeOuts(i)
+		r.Moves = append(r.Moves, RecordMove{Move: format(move), At: move.RegisteredAt})
+	}
+	writeOuts(len(m.Moves))
+	return r
+}
+
+// recordOpts reads the options shared by every board from the tags of r into opts
+func recordOpts(r *Record, opts *MatchOptsND) error {
+	switch r.Tag("Starts") {
+	case "", "1":
+		opts.Starts1 = true
+	case "2":
+	default:
+		return fmt.Errorf("invalid record. invalid Starts tag %q", r.Tag("Starts"))
+	}
+	if tc := r.Tag("TimeControl"); tc != "" && tc != "-" {
+		if _, err := fmt.Sscanf(tc, "%d+%d", &opts.T0, &opts.TD); err != nil {
+			return fmt.Errorf("invalid record. invalid TimeControl tag %q", tc)
+		}
+	}
+	opts.Players = 2
+	for r.Tag(fmt.Sprintf("P%d", opts.Players+1)) != "" {
+		opts.Players++
+	}
+	return nil
+}
+
+// recordInt reads the integer tag with the given name
+func recordInt(r *Record, name string) (int, error) {
+	n, err := strconv.Atoi(r.Tag(name))
+	if err != nil {
+		return 0, fmt.Errorf("invalid record. invalid %s tag %q", name, r.Tag(name))
+	}
+	return n, nil
+}
+
+// recordRules returns the rules listed in the Rules tag of r, such as "pie scoring"
+func recordRules(r *Record) map[string]bool {
+	rules := map[string]bool{}
+	for _, rule := range strings.Fields(r.Tag("Rules")) {
+		rules[rule] = true
+	}
+	return rules
+}
+
+// formatRules writes the rules that are set, for the Rules tag of a record
+func formatRules(rules []string, set ...bool) string {
+	var names []string
+	for i, rule := range rules {
+		if set[i] {
+			names = append(names, rule)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// recordReplay plays records on fresh matches of one board
+type recordReplay[M EngineMatch] struct {
+	// newMatch returns a match seated and started as in the record
+	newMatch func() (M, error)
+	// playMove registers a move written in the move notation of the board
+	playMove func(m M, notation string, at time.Time, pid string) (GameoverResult, error)
+}
+
+// replay plays moves on m, after prefix, which was played on it already, and checks the
+// variations of each move on matches of their own. The first move that can't be played is
+// reported with its number
+func (rp recordReplay[M]) replay(m M, prefix []RecordMove, moves []RecordMove) error {
+	for i, move := range moves {
+		for _, variation := range move.Variations {
+			vm, err := rp.newMatch()
+			if err != nil {
+				return err
+			}
+			//the moves leading to the variation were checked already
+			line := append(slices.Clip(prefix), moves[:i]...)
+			for _, move := range line {
+				if err := rp.play(vm, move); err != nil {
+					return err
+				}
+			}
+			if err := rp.replay(vm, line, variation); err != nil {
+				return err
+			}
+		}
+		if err := rp.play(m, move); err != nil {
+			return fmt.Errorf("invalid record. move %d (%s): %w", len(prefix)+i+1, move.Move, err)
+		}
+	}
+	return nil
+}
+
+// play plays a move of a record on m: a resignation, a timeout, or a move of the board
+func (rp recordReplay[M]) play(m M, move RecordMove) error {
+	e := m.Engine()
+	if e.Gameover {
+		return fmt.Errorf("game is over")
+	}
+	reason, seat, ok := parseOutNotation(move.Move)
+	if !ok {
+		_, err := rp.playMove(m, move.Move, move.At, e.getCurrPlayerID())
+		return err
+	}
+	if seat >= len(e.Players) {
+		return fmt.Errorf("no such seat")
+	}
+	if reason == RESULT_TYPE_RESIGN {
+		_, err := e.Resign(e.Players[seat].ID, move.At)
+		return err
+	}
+	if seat != e.turn || e.FlagFall(move.At) == nil {
+		return fmt.Errorf("the player still had time")
+	}
+	return nil
+}
+
+// importRecord replays r, and returns the match it records. A match drawn by agreement is
+// drawn after its last move, and the result of the moves must be the record's
+func (rp recordReplay[M]) importRecord(r *Record) (M, error) {
+	var zero M
+	m, err := rp.newMatch()
+	if err != nil {
+		return zero, err
+	}
+	if err := rp.replay(m, nil, r.Moves); err != nil {
+		return zero, err
+	}
+	e := m.Engine()
+	if !e.Gameover && r.Tag("Termination") == drawReasonNotations[DRAW_REASON_AGREEMENT] {
+		if err := e.OfferDraw(e.Players[0].ID); err != nil {
+			return zero, fmt.Errorf("invalid record. %w", err)
+		}
+		if _, err := e.AcceptDraw(e.Players[1].ID); err != nil {
+			return zero, fmt.Errorf("invalid record. %w", err)
+		}
+	}
+	for _, result := range []string{r.Result, r.Tag("Result")} {
+		if result != "" && result != e.ResultNotation() {
+			return zero, fmt.Errorf("invalid record. expected result %s, the moves give %s", result, e.ResultNotation())
+		}
+	}
+	if t := r.Tag("Termination"); t != "" && t != e.TerminationNotation() {
+		return zero, fmt.Errorf("invalid record. expected termination %s, the moves give %s", t, e.TerminationNotation())
+	}
+	return m, nil
+}
+
+// seatRecordPlayers seats the players of r on m, and starts it at the time of the Start tag
+func seatRecordPlayers(m *MatchND, r *Record) error {
+	start := time.Time{}
+	if s := r.Tag("Start"); s != "" {
+		var err error
+		if start, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return fmt.Errorf("invalid record. invalid Start tag %q", s)
+		}
+	}
+	for seat := range m.Players {
+		id := r.Tag(fmt.Sprintf("P%d", seat+1))
+		if id == "" {
+			return fmt.Errorf("invalid record. missing P%d tag", seat+1)
+		}
+		if _, err := m.Join(id, start); err != nil {
+			return fmt.Errorf("invalid record. %w", err)
+		}
+	}
+	if !m.Started {
+		return fmt.Errorf("invalid record. players must be different")
+	}
+	return nil
+}
+
+// maskSlots returns the cells of a stretch of a mask, with SLOT_BLOCKED for its blocked cells,
+// to write it like the cells of a position
+func maskSlots(mask []bool) []Slot {
+	slots := make([]Slot, len(mask))
+	for i, blocked := range mask {
+		if blocked {
+			slots[i] = SLOT_BLOCKED
+		}
+	}
+	return slots
+}
+
+// parseMask parses n cells of a mask written with maskSlots
+func parseMask(s string, n int) ([]bool, error) {
+	slots, err := parseCells(s, n)
+	if err != nil {
+		return nil, err
+	}
+	mask := make([]bool, n)
+	for i, slot := range slots {
+		if slot != SLOT_EMPTY && slot != SLOT_BLOCKED {
+			return nil, fmt.Errorf("invalid mask. unexpected %q", slotChars[slot])
+		}
+		mask[i] = slot == SLOT_BLOCKED
+	}
+	return mask, nil
+}
@@ -0,0 +1,234 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+)
+
+// IllegalMoveError reports the first move of a move list that can't be played
+type IllegalMoveError struct {
+	// Ply is the index of the move in the move list
+	Ply int
+	Err error
+}
+
+func (e *IllegalMoveError) Error() string {
+	return fmt.Sprintf("illegal move %d: %v", e.Ply+1, e.Err)
+}
+
+func (e *IllegalMoveError) Unwrap() error {
+	return e.Err
+}
+
+// Replay steps through the moves of a match, forward and back, on a match of its own where the
+// players are seated as P1, P2 and so on. Stored moves don't tell when play paused for takebacks,
+// so the moves are played without clocks: they keep their timestamps, but nobody runs out of time.
+// The players who left the match are taken out of it at their ply, once the moves before it are
+// played
+type Replay[M EngineMatch, Mv any] struct {
+	// Match is the match at the current ply. It must not be played on
+	Match M
+	moves []Mv
+	// outs holds the players who left the match, in the order they left
+	outs     []Elimination
+	ply      int
+	newMatch func() (M, error)
+	play     func(m M, move Mv) error
+}
+
+// Replay2D steps through the moves of a 2D match
+type Replay2D = Replay[*Match2D, Move]
+
+// Replay3D steps through the moves of a 3D match
+type Replay3D = Replay[*Match3D, Move3D]
+
+// replayIDs returns the IDs of the players of a replay, one per seat
+func replayIDs(players int) []string {
+	ids := make([]string, max(players, 2))
+	for i := range ids {
+		ids[i] = fmt.Sprintf("P%d", i+1)
+	}
+	return ids
+}
+
+// newReplay checks that moves can be played, with the players in outs leaving at their ply, and
+// returns a replay of them at ply 0. If a move can't be played, the replay holds the moves before
+// it, and an IllegalMoveError reports it
+func newReplay[M EngineMatch, Mv any](moves []Mv, outs []Elimination, newMatch func() (M, error), play func(m M, move Mv) error) (*Replay[M, Mv], error) {
+	r := &Replay[M, Mv]{moves: moves, outs: outs, newMatch: newMatch, play: play}
+	m, err := r.start()
+	if err != nil {
+		return nil, err
+	}
+	for i, move := range moves {
+		if err := play(m, move); err != nil {
+			r.moves = moves[:i]
+			r.outs = slices.DeleteFunc(slices.Clone(outs), func(out Elimination) bool { return out.Ply > i })
+			err = &IllegalMoveError{Ply: i, Err: err}
+			r.Match, _ = r.start()
+			return r, err
+		}
+		if err := r.leave(m, i+1); err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range outs {
+		if out.Ply < 0 || out.Ply > len(moves) {
+			return nil, fmt.Errorf("invalid elimination. no ply %d", out.Ply)
+		}
+	}
+	r.Match, err = r.start()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// start returns a match of its own at ply 0
+func (r *Replay[M, Mv]) start() (M, error) {
+	m, err := r.newMatch()
+	if err != nil {
+		return m, err
+	}
+	return m, r.leave(m, 0)
+}
+
+// leave takes the players who left after ply moves out of m
+func (r *Replay[M, Mv]) leave(m M, ply int) error {
+	e := m.Engine()
+	for _, out := range r.outs {
+		if out.Ply != ply {
+			continue
+		}
+		switch {
+		case out.Seat < 0 || out.Seat >= len(e.Players):
+			return fmt.Errorf("invalid elimination. no seat %d", out.Seat+1)
+		case e.Gameover:
+			return fmt.Errorf("invalid elimination. game is over at ply %d", ply)
+		case e.Players[out.Seat].Eliminated:
+			return fmt.Errorf("invalid elimination. seat %d is out already", out.Seat+1)
+		}
+		e.eliminate(e.Players[out.Seat].ID, out.Reason, out.At)
+	}
+	return nil
+}
+
+// step plays the move at ply on m, and takes out the players who left after it
+func (r *Replay[M, Mv]) step(m M, ply int) {
+	//the moves and the eliminations were checked when the replay was created
+	r.play(m, r.moves[ply])
+	r.leave(m, ply+1)
+}
+
+// NewReplay2D returns a replay of a 2D match played with opts, at ply 0, where the players in
+// outs, the Eliminations of the match, leave it. See newReplay for moves that can't be played
+func NewReplay2D(opts MatchOpts, moves []Move, outs []Elimination) (*Replay2D, error) {
+	opts.T0, opts.TD = 0, 0
+	ids := replayIDs(opts.Players)
+	return newReplay(moves, outs,
+		func() (*Match2D, error) {
+			m, err := NewMatch2D(ids[0], ids[1], opts)
+			if err != nil {
+				return nil, err
+			}
+			return m, seatReplayPlayers(m.MatchND, ids)
+		},
+		func(m *Match2D, move Move) error {
+			_, err := m.RegisterMove(move, m.getCurrPlayerID())
+			return err
+		})
+}
+
+// NewReplay3D returns a replay of a 3D match played with opts, at ply 0, where the players in
+// outs, the Eliminations of the match, leave it. See newReplay for moves that can't be played
+func NewReplay3D(opts MatchOpts3D, moves []Move3D, outs []Elimination) (*Replay3D, error) {
+	opts.T0, opts.TD = 0, 0
+	ids := replayIDs(opts.Players)
+	return newReplay(moves, outs,
+		func() (*Match3D, error) {
+			m, err := NewMatch3D(ids[0], ids[1], opts)
+			if err != nil {
+				return nil, err
+			}
+			return m, seatReplayPlayers(m.MatchND, ids)
+		},
+		func(m *Match3D, move Move3D) error {
+			_, err := m.RegisterMove(move, m.getCurrPlayerID())
+			return err
+		})
+}
+
+// seatReplayPlayers seats the players past the second, and starts the match
+func seatReplayPlayers(m *MatchND, ids []string) error {
+	for _, id := range ids[2:] {
+		if _, err := m.Join(id, m.StartedAt); err != nil {
+			return err
+		}
+	}
+	m.Started = true
+	return nil
+}
+
+// Len returns how many moves can be played
+func (r *Replay[M, Mv]) Len() int {
+	return len(r.moves)
+}
+
+// Ply returns how many moves were played on Match
+func (r *Replay[M, Mv]) Ply() int {
+	return r.ply
+}
+
+// Forward plays the next move. It returns false at the end of the moves
+func (r *Replay[M, Mv]) Forward() bool {
+	if r.ply >= len(r.moves) {
+		return false
+	}
+	r.step(r.Match, r.ply)
+	r.ply++
+	return true
+}
+
+// Back takes back the last move, and lets the players who left after it back in. It returns
+// false at ply 0
+func (r *Replay[M, Mv]) Back() bool {
+	if r.ply == 0 {
+		return false
+	}
+	if slices.ContainsFunc(r.outs, func(out Elimination) bool { return out.Ply == r.ply }) {
+		//undoing a move doesn't undo eliminations: the match is played again up to the ply before
+		r.Match, _ = r.At(r.ply - 1)
+	} else {
+		r.Match.Engine().undoMove()
+	}
+	r.ply--
+	return true
+}
+
+// Seek goes forward or back to the given ply
+func (r *Replay[M, Mv]) Seek(ply int) error {
+	if ply < 0 || ply > len(r.moves) {
+		return fmt.Errorf("invalid ply. expected 0 to %d", len(r.moves))
+	}
+	for r.ply < ply && r.Forward() {
+	}
+	for r.ply > ply && r.Back() {
+	}
+	return nil
+}
+
+// At returns a match of its own at the given ply, leaving the replay where it is
+func (r *Replay[M, Mv]) At(ply int) (M, error) {
+	var zero M
+	if ply < 0 || ply > len(r.moves) {
+		return zero, fmt.Errorf("invalid ply. expected 0 to %d", len(r.moves))
+	}
+	m, err := r.start()
+	if err != nil {
+		return zero, err
+	}
+	for i := range ply {
+		r.step(m, i)
+	}
+	return m, nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestReplay2D(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 1000}
+	moves, _ := ParseMoves2D(opts, "4455667")
+	r, err := NewReplay2D(opts, moves, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Len() != 7 || r.Ply() != 0 {
+		t.Fatalf("expected a replay of 7 moves at ply 0, got %d at %d", r.Len(), r.Ply())
+	}
+	for r.Forward() {
+	}
+	if !r.Match.Gameover || r.Match.ResultNotation() != "1-0" {
+		t.Fatal("expected the last move to win")
+	}
+	if !r.Back() || r.Match.Gameover || r.Match.Board[5][6] != SLOT_EMPTY {
+		t.Fatal("expected going back to take the winning move back")
+	}
+	if err := r.Seek(2); err != nil {
+		t.Fatalf("unexpected error seeking: %v", err)
+	}
+	if got := r.Match.Position(); got != "7x6 4 7/7/7/7/3o3/3x3 x" {
+		t.Fatalf("unexpected position at ply 2: %s", got)
+	}
+	m, _ := r.At(6)
+	if m.Notation() != "445566" || r.Ply() != 2 {
+		t.Fatal("expected At to leave the replay where it was")
+	}
+	if err := r.Seek(8); err == nil {
+		t.Fatal("expected an error seeking past the moves")
+	}
+}
+
+func TestReplay_IllegalMove(t *testing.T) {
+	opts := MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	moves, _ := ParseMoves2D(opts, "44444444")
+	r, err := NewReplay2D(opts, moves, nil)
+	var illegal *IllegalMoveError
+	if !errors.As(err, &illegal) || illegal.Ply != 6 {
+		t.Fatalf("expected the seventh move to be illegal, got %v", err)
+	}
+	if r.Len() != 6 {
+		t.Fatalf("expected the replay to hold the moves before it, got %d", r.Len())
+	}
+
+	opts3D := MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, Players: 3}
+	moves3D, _ := ParseMoves3D(opts3D, "1,1 2,2 3,3 1,1")
+	r3D, err := NewReplay3D(opts3D, moves3D, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r3D.Seek(4)
+	if r3D.Match.Board[0][0][1] != SLOT_PLAYER1 {
+		t.Fatal("expected the seats to take turns")
+	}
+}
+
+func TestReplay2D_Eliminations(t *testing.T) {
+	opts := MatchOpts{W: 9, H: 7, A: 4, Starts1: true, Players: 3}
+	match, _ := NewMatch2D("P1", "P2", opts)
+	match.Join("P3", match.StartedAt)
+	match.Started = true
+	moves, _ := ParseMoves2D(opts, "123")
+	playCols(t, match, moves)
+	// P2 leaves in the middle of the match, and the others take turns
+	if _, err := match.Resign("P2", match.StartedAt); err != nil {
+		t.Fatalf("unexpected error resigning: %v", err)
+	}
+	moves, _ = ParseMoves2D(opts, "4567")
+	playCols(t, match, moves)
+
+	r, err := NewReplay2D(opts, match.moves(), match.Eliminations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r.Seek(r.Len())
+	if r.Match.Position() != match.Position() || !r.Match.Players[1].Eliminated {
+		t.Fatalf("expected the replay to end like the match, got %s", r.Match.Position())
+	}
+	r.Seek(3)
+	if r.Match.Position() != "9x7 4 9/9/9/9/9/9/xoy6 x" || !r.Match.Players[1].Eliminated {
+		t.Fatalf("expected P2 out after the third move, got %s", r.Match.Position())
+	}
+	if !r.Back() || r.Match.Players[1].Eliminated || r.Match.Turn() != 2 {
+		t.Fatal("expected going back to let P2 back in")
+	}
+
+	// an elimination must be of a seat still in the match
+	outs := append(slices.Clone(match.Eliminations), Elimination{Seat: 1, Ply: 5})
+	if _, err := NewReplay2D(opts, match.moves(), outs); err == nil {
+		t.Fatal("expected an error for a seat eliminated twice")
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Copy returns a copy of the match for bots and analysis, to play and take back moves on by the
+// rules of the match. The copy is untimed, and has no pending offers nor requests. It shares
+// nothing with m but the line table
+func (m *MatchND) Copy() *MatchND {
+	c := &MatchND{
+		Cells:        slices.Clone(m.Cells),
+		Players:      slices.Clone(m.Players),
+		Scores:       slices.Clone(m.Scores),
+		Opts:         m.Opts,
+		Moves:        slices.Clone(m.Moves),
+		StartedAt:    m.StartedAt,
+		Started:      true,
+		Gameover:     m.Gameover,
+		Result:       m.Result,
+		Eliminations: slices.Clone(m.Eliminations),
+		turn:         m.turn,
+		strides:      m.strides,
+		dirs:         m.dirs,
+		lines:        m.lines,
+		lineCounts:   slices.Clone(m.lineCounts),
+		alive:        m.alive,
+		discs:        m.discs,
+		positions:    slices.Clone(m.positions),
+		repetitions:  maps.Clone(m.repetitions),
+	}
+	c.Opts.T0, c.Opts.TD = 0, 0
+	return c
+}
+
+// Turn returns the seat of the player to move
+func (m *MatchND) Turn() int {
+	return m.turn
+}
+
+// LegalMoves returns the moves the player to move can make: a drop per stick that is not full,
+// with the cell where the disc would land, or every empty cell without gravity, then the pops of
+// PopOut matches and the pie rule swap. It returns nil once the match is over
+func (m *MatchND) LegalMoves() []MoveND {
+	if m.Gameover {
+		return nil
+	}
+	var moves []MoveND
+	g := m.Opts.Gravity
+	for idx, s := range m.Cells {
+		if g == NO_GRAVITY {
+			if s == SLOT_EMPTY {
+				moves = append(moves, MoveND{Cell: m.point(idx)})
+			}
+			continue
+		}
+		//one drop per stick, found from its bottom cell
+		if idx/m.strides[g]%m.Opts.Dims[g] != 0 {
+			continue
+		}
+		if cell := m.landingCell(m.point(idx)); cell != nil {
+			moves = append(moves, MoveND{Cell: cell})
+		}
+		if m.Opts.Variant == VARIANT_POPOUT && s == Slot(m.turn+1) {
+			moves = append(moves, MoveND{Cell: m.point(idx), Kind: MOVE_KIND_POP})
+		}
+	}
+	if m.Opts.Pie && len(m.Moves) == 1 {
+		moves = append(moves, MoveND{Cell: m.Moves[0].Cell, Kind: MOVE_KIND_SWAP})
+	}
+	return moves
+}
+
+// ApplyMove makes move for the player to move, like Play, Pop or Swap would. It is meant for
+// copies, where moves are taken back with UndoMove
+func (m *MatchND) ApplyMove(move MoveND) (GameoverResult, error) {
+	pid := m.getCurrPlayerID()
+	switch move.Kind {
+	case MOVE_KIND_POP:
+		return m.Pop(move.Cell, time.Time{}, pid)
+	case MOVE_KIND_SWAP:
+		return m.Swap(pid, time.Time{})
+	}
+	return m.Play(move.Cell, time.Time{}, pid)
+}
+
+// UndoMove takes back the last move of a copy, which ApplyMove made
+func (m *MatchND) UndoMove() error {
+	if len(m.Moves) == 0 {
+		return fmt.Errorf("no move to take back")
+	}
+	m.undoMove()
+	return nil
+}
+
+// OpenLines fills counts, which has A+1 elements, with how many lines hold k discs of seat for
+// each k, among the lines that seat can still complete
+func (m *MatchND) OpenLines(seat int, counts []int) {
+	clear(counts)
+	for l := range m.lineCounts {
+		c := &m.lineCounts[l]
+		if lineTotal(c) == c[seat] {
+			counts[c[seat]]++
+		}
+	}
+}
+
+// Threats returns the empty cells that would complete a line of A discs for seat, were seat to
+// play them. With gravity, a disc dropped in the stick of such a cell may land below it
+func (m *MatchND) Threats(seat int) []PointND {
+	var cells []PointND
+	seen := map[int]bool{}
+	for l := range m.lineCounts {
+		c := &m.lineCounts[l]
+		if c[seat] != m.Opts.A-1 || lineTotal(c) != c[seat] {
+			continue
+		}
+		for _, idx := range m.lines.lines[l] {
+			if m.Cells[idx] == SLOT_EMPTY && !seen[idx] {
+				seen[idx] = true
+				cells = append(cells, m.point(idx))
+			}
+		}
+	}
+	return cells
+}
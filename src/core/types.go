@@ -5,8 +5,35 @@ type PlayerDTO struct {
 	TimeLeft int64  `json:"timeLeft"`
 	Nick     string `json:"nick"`
 	ImgURL   string `json:"imgUrl"`
+	// Eliminated tells whether the player resigned or ran out of time in a match that went on
+	Eliminated bool `json:"eliminated"`
+	// Bot is set when a server-side bot plays the seat
+	Bot *BotDTO `json:"bot,omitempty"`
 }
 
 type DTOGetter interface {
 	GetUserDTO(userID string) (*PlayerDTO, error)
 }
+
+// BOT_LEVEL is the difficulty of a server-side bot
+type BOT_LEVEL int
+
+const (
+	BOT_LEVEL_BEGINNER BOT_LEVEL = iota
+	BOT_LEVEL_EASY
+	BOT_LEVEL_MEDIUM
+	BOT_LEVEL_HARD
+	BOT_LEVEL_EXPERT
+)
+
+// BotOpts asks for a match against server-side bots, which take every seat but the creator's
+type BotOpts struct {
+	Level BOT_LEVEL `json:"level"`
+}
+
+// BotDTO describes the bot playing a seat
+type BotDTO struct {
+	Level BOT_LEVEL `json:"level"`
+	// Name is the name of the level, such as "easy"
+	Name string `json:"name"`
+}
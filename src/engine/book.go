@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// bookMagic starts every book file, with its version
+const bookMagic = "CXB1"
+
+// Book holds the scores of the positions of standard Connect Four with up to Depth discs, which
+// the solver would take the longest on. Mirror images share an entry.
+//
+// A book file is bookMagic, the depth in a byte, the count of entries in 4 bytes, and then the
+// entries by increasing key, each a key in 7 bytes and a score in a byte. Integers are little
+// endian
+type Book struct {
+	Depth  int
+	scores map[uint64]int8
+}
+
+// Len returns how many positions the book holds
+func (b *Book) Len() int {
+	return len(b.scores)
+}
+
+func (b *Book) lookup(p *c4Position) (int, bool) {
+	if b == nil || p.moves > b.Depth {
+		return 0, false
+	}
+	score, ok := b.scores[p.canonicalKey()]
+	return int(score), ok
+}
+
+// GenerateBook solves every position with up to depth discs, and returns their book. The
+// deepest positions are solved first, so that the shallower ones are looked up from them.
+// progress, if set, is called after each depth with the number of discs and of positions
+func GenerateBook(depth int, progress func(depth, positions int)) (*Book, error) {
+	if depth < 0 || depth >= c4Cells {
+		return nil, fmt.Errorf("invalid book depth")
+	}
+	book := &Book{Depth: depth, scores: make(map[uint64]int8)}
+	//levels[d] holds the positions with d discs, one per mirror pair
+	levels := [][]c4Position{{{}}}
+	for d := 1; d <= depth; d++ {
+		seen := make(map[uint64]bool)
+		var level []c4Position
+		for _, p := range levels[d-1] {
+			for col := range c4W {
+				if !p.canPlay(col) {
+					continue
+				}
+				move := p.columnMove(col)
+				if p.wins(move) {
+					continue
+				}
+				child := p
+				child.play(move)
+				if key := child.canonicalKey(); !seen[key] {
+					seen[key] = true
+					level = append(level, child)
+				}
+			}
+		}
+		levels = append(levels, level)
+	}
+
+	s := &Solver{Book: book}
+	for d := depth; d >= 0; d-- {
+		scores := make([]int8, len(levels[d]))
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for range runtime.GOMAXPROCS(0) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					scores[i] = int8(s.run(0).solve(levels[d][i]))
+				}
+			}()
+		}
+		for i := range levels[d] {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+		//the book is only written between depths, while no goroutine reads it
+		for i, p := range levels[d] {
+			book.scores[p.canonicalKey()] = scores[i]
+		}
+		if progress != nil {
+			progress(d, len(levels[d]))
+		}
+	}
+	return book, nil
+}
+
+// WriteTo writes the book file
+func (b *Book) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, len(bookMagic)+5)
+	buf = append(buf, bookMagic...)
+	buf = append(buf, byte(b.Depth))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(b.scores)))
+	bw.Write(buf)
+	var entry [8]byte
+	for _, key := range slices.Sorted(maps.Keys(b.scores)) {
+		binary.LittleEndian.PutUint64(entry[:], key)
+		entry[7] = byte(b.scores[key])
+		bw.Write(entry[:])
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(len(buf) + 8*len(b.scores)), nil
+}
+
+// ReadBook reads a book file
+func ReadBook(r io.Reader) (*Book, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(bookMagic)+5)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("invalid book: %v", err)
+	}
+	if string(header[:len(bookMagic)]) != bookMagic {
+		return nil, fmt.Errorf("invalid book: not a book file")
+	}
+	b := &Book{Depth: int(header[len(bookMagic)])}
+	n := binary.LittleEndian.Uint32(header[len(bookMagic)+1:])
+	b.scores = make(map[uint64]int8, n)
+	var entry [8]byte
+	for range n {
+		if _, err := io.ReadFull(br, entry[:]); err != nil {
+			return nil, fmt.Errorf("invalid book: %v", err)
+		}
+		score := int8(entry[7])
+		entry[7] = 0
+		b.scores[binary.LittleEndian.Uint64(entry[:])] = score
+	}
+	return b, nil
+}
+
+// LoadBook reads the book file at path
+func LoadBook(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadBook(f)
+}
+
+// Save writes the book file at path
+func (b *Book) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := b.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"connectx/src/core"
+	"connectx/src/errs"
+	"math/rand/v2"
+	"time"
+)
+
+// botLevel is how well a bot plays at a difficulty level. The levels were calibrated against each
+// other with Calibrate2D and Calibrate3D, see calibration.md
+type botLevel struct {
+	// name names the level, and nick is the nickname of its bots
+	name, nick string
+	// depth is the MaxDepth of the 2D searches, 0 for no limit
+	depth int
+	// tableBits is the TableBits of the 2D searches, which keep fewer positions the shallower
+	// they are
+	tableBits int
+	// playouts is the Iterations of the 3D searches, 0 for no limit
+	playouts int
+	// think is the longest a bot thinks on a move, even with time to spare
+	think time.Duration
+	// scoreNoise is the Noise of the 2D searches, and valueNoise that of the 3D ones
+	scoreNoise int64
+	valueNoise float64
+	// blunder is the odds that the bot misses the threats of a move: it searches a single ply in
+	// 2D, and skips the tactical checks in 3D
+	blunder float64
+	// solve tells whether the bot plays standard Connect Four with the Solver, when it has one
+	solve bool
+}
+
+var botLevels = []botLevel{
+	core.BOT_LEVEL_BEGINNER: {name: "beginner", nick: "Pip", depth: 2, tableBits: 10, playouts: 100,
+		think: 100 * time.Millisecond, scoreNoise: 40, valueNoise: 0.3, blunder: 0.5},
+	core.BOT_LEVEL_EASY: {name: "easy", nick: "Dot", depth: 3, tableBits: 12, playouts: 300,
+		think: 200 * time.Millisecond, scoreNoise: 15, valueNoise: 0.15, blunder: 0.25},
+	core.BOT_LEVEL_MEDIUM: {name: "medium", nick: "Quad", depth: 6, tableBits: 16, playouts: 2000,
+		think: 500 * time.Millisecond, scoreNoise: 4, valueNoise: 0.05, blunder: 0.08},
+	core.BOT_LEVEL_HARD: {name: "hard", nick: "Gauss", depth: 10, tableBits: 18, playouts: 10000,
+		think: time.Second},
+	core.BOT_LEVEL_EXPERT: {name: "expert", nick: "Euler", tableBits: 20, think: 3 * time.Second, solve: true},
+}
+
+// Bot plays a seat at a difficulty level: with the alpha-beta Searcher on 2D boards, and with
+// MCTS on 3D ones. A bot plays a seat of a single match, and thinks on a move at a time
+type Bot struct {
+	Level    core.BOT_LEVEL
+	searcher Searcher
+	mcts     MCTS
+	// rng rolls the blunders
+	rng *rand.Rand
+	// solver, if set, plays the standard boards at the levels that solve them
+	solver *Solver
+}
+
+// NewBot returns a bot of the given level. solver may be nil, and is shared with other bots
+func NewBot(level core.BOT_LEVEL, solver *Solver) *Bot {
+	l := botLevels[level]
+	seed := uint64(time.Now().UnixNano())
+	b := &Bot{
+		Level:    level,
+		searcher: Searcher{MaxDepth: l.depth, TableBits: l.tableBits, Noise: l.scoreNoise, Seed: seed},
+		mcts:     MCTS{Iterations: l.playouts, Seed: seed, Noise: l.valueNoise},
+		rng:      rand.New(rand.NewPCG(seed, 1)),
+	}
+	if l.solve {
+		b.solver = solver
+	}
+	return b
+}
+
+// Name returns the name of the level of the bot
+func (b *Bot) Name() string {
+	return botLevels[b.Level].name
+}
+
+// Nick returns the nickname of the bot, which is that of its level
+func (b *Bot) Nick() string {
+	return botLevels[b.Level].nick
+}
+
+// Budget returns how long the bot can think on its move in m at the given time, by its clock
+// and its level
+func (b *Bot) Budget(m *core.MatchND, at time.Time) time.Duration {
+	return ClockBudget(m, at, botLevels[b.Level].think)
+}
+
+// Move2D returns the move of the bot in m, thinking at most budget. On standard boards, a bot with
+// a solver gives it half the budget first, and only searches if it runs out of time
+func (b *Bot) Move2D(m *core.Match2D, budget time.Duration) (core.Move, error) {
+	//the solver doesn't weigh the pie rule swap
+	if b.solver != nil && Solvable(m.Opts) && !(m.Opts.Pie && len(m.Moves) == 1) {
+		start := time.Now()
+		col, _, err := b.solver.BestMove(m, budget/2)
+		if err == nil {
+			return core.Move{Col: col}, nil
+		}
+		if err != errs.ErrTimeout {
+			return core.Move{}, err
+		}
+		budget = max(budget-time.Since(start), time.Millisecond)
+	}
+	b.searcher.MaxDepth = botLevels[b.Level].depth
+	if b.blunders() {
+		b.searcher.MaxDepth = 1
+	}
+	res, err := b.searcher.Search(m, budget)
+	return res.Move, err
+}
+
+// Move3D returns the move of the bot in m, thinking at most budget
+func (b *Bot) Move3D(m *core.Match3D, budget time.Duration) (core.Move3D, error) {
+	b.mcts.Unsafe = b.blunders()
+	res, err := b.mcts.Search(m, budget)
+	return res.Move, err
+}
+
+// blunders rolls whether the bot misses the threats of its next move
+func (b *Bot) blunders() bool {
+	return b.rng.Float64() < botLevels[b.Level].blunder
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"connectx/src/core"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Calibration is the score matrix of bot levels played against each other
+type Calibration struct {
+	Levels []core.BOT_LEVEL
+	// Games is how many games each pair of levels played, each level starting half of them
+	Games int
+	// Scores[i][j] is the share of the points Levels[i] scored against Levels[j], a win being
+	// worth a point and a draw half a point
+	Scores [][]float64
+}
+
+// String returns the matrix as a markdown table, a row per level
+func (c Calibration) String() string {
+	var b strings.Builder
+	b.WriteString("| |")
+	for _, l := range c.Levels {
+		fmt.Fprintf(&b, " %s |", botLevels[l].name)
+	}
+	b.WriteString("\n|---|")
+	b.WriteString(strings.Repeat("---|", len(c.Levels)))
+	for i, l := range c.Levels {
+		fmt.Fprintf(&b, "\n| %s |", botLevels[l].name)
+		for j := range c.Levels {
+			if i == j {
+				b.WriteString(" - |")
+			} else {
+				fmt.Fprintf(&b, " %.2f |", c.Scores[i][j])
+			}
+		}
+	}
+	return b.String()
+}
+
+// Calibrate2D plays games matches with opts between every pair of levels, and returns the score
+// matrix. Each level thinks on a move for its think time times scale, so that calibrating takes
+// less time than playing at full strength. The matches are untimed, and for two players. The
+// bots of standard boards share a Solver, like on the server, without a book
+func Calibrate2D(opts core.MatchOpts, levels []core.BOT_LEVEL, games int, scale float64) (Calibration, error) {
+	opts.Starts1, opts.T0, opts.TD, opts.Players, opts.Bot = true, 0, 0, 2, nil
+	var solver *Solver
+	if Solvable(opts) {
+		solver = &Solver{}
+	}
+	return calibrate(levels, games, solver, func(bots [2]*Bot) (string, error) {
+		m, err := core.NewMatch2D("0", "1", opts)
+		if err != nil {
+			return "", err
+		}
+		m.Started = true
+		for {
+			pid := m.Players[m.Turn()].ID
+			bot := bots[pid[0]-'0']
+			move, err := bot.Move2D(m, thinkTime(bot, scale))
+			if err != nil {
+				return "", err
+			}
+			var res core.GameoverResult
+			if move.Kind == core.MOVE_KIND_SWAP {
+				res, err = m.Swap(pid, time.Now())
+			} else {
+				res, err = m.RegisterMove(move, pid)
+			}
+			if err != nil {
+				return "", fmt.Errorf("bot played an illegal move %+v: %v", move, err)
+			}
+			if res != nil {
+				return winnerOf(res, pid), nil
+			}
+		}
+	})
+}
+
+// Calibrate3D is Calibrate2D for 3D matches
+func Calibrate3D(opts core.MatchOpts3D, levels []core.BOT_LEVEL, games int, scale float64) (Calibration, error) {
+	opts.Starts1, opts.T0, opts.TD, opts.Players, opts.Bot = true, 0, 0, 2, nil
+	return calibrate(levels, games, nil, func(bots [2]*Bot) (string, error) {
+		m, err := core.NewMatch3D("0", "1", opts)
+		if err != nil {
+			return "", err
+		}
+		m.Started = true
+		for {
+			pid := m.Players[m.Turn()].ID
+			bot := bots[pid[0]-'0']
+			move, err := bot.Move3D(m, thinkTime(bot, scale))
+			if err != nil {
+				return "", err
+			}
+			var res core.GameoverResult
+			if move.Kind == core.MOVE_KIND_SWAP {
+				res, err = m.Swap(pid, time.Now())
+			} else {
+				res, err = m.RegisterMove(move, pid)
+			}
+			if err != nil {
+				return "", fmt.Errorf("bot played an illegal move %+v: %v", move, err)
+			}
+			if res != nil {
+				return winnerOf(res, pid), nil
+			}
+		}
+	})
+}
+
+func thinkTime(bot *Bot, scale float64) time.Duration {
+	return max(time.Duration(float64(botLevels[bot.Level].think)*scale), time.Millisecond)
+}
+
+// calibrate fills the score matrix of levels with the results of play, which plays a match
+// between two bots with solver, whose IDs are "0" for the first one, who starts, and "1". It
+// returns the ID of the winner, or "" for a draw
+func calibrate(levels []core.BOT_LEVEL, games int, solver *Solver, play func(bots [2]*Bot) (string, error)) (Calibration, error) {
+	for _, l := range levels {
+		if l < core.BOT_LEVEL_BEGINNER || int(l) >= len(botLevels) {
+			return Calibration{}, fmt.Errorf("invalid bot level")
+		}
+	}
+	c := Calibration{Levels: levels, Games: games, Scores: make([][]float64, len(levels))}
+	for i := range c.Scores {
+		c.Scores[i] = make([]float64, len(levels))
+	}
+	for i := range levels {
+		for j := i + 1; j < len(levels); j++ {
+			var points [2]float64
+			for g := range games {
+				//the levels take turns starting
+				first, second := i, j
+				if g%2 == 1 {
+					first, second = j, i
+				}
+				winnerID, err := play([2]*Bot{NewBot(levels[first], solver), NewBot(levels[second], solver)})
+				if err != nil {
+					return Calibration{}, err
+				}
+				switch {
+				case winnerID == "":
+					points[0] += 0.5
+					points[1] += 0.5
+				case (winnerID == "0") == (first == i):
+					points[0]++
+				default:
+					points[1]++
+				}
+			}
+			if games > 0 {
+				c.Scores[i][j] = points[0] / float64(games)
+				c.Scores[j][i] = points[1] / float64(games)
+			}
+		}
+	}
+	return c, nil
+}
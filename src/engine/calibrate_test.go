@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"connectx/src/core"
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+)
+
+var calibrateFlag = flag.Bool("calibrate", false, "plays the bot levels against each other, and writes calibration.md")
+
+func TestCalibrate2D(t *testing.T) {
+	opts := core.MatchOpts{W: 5, H: 4, A: 4}
+	levels := []core.BOT_LEVEL{core.BOT_LEVEL_BEGINNER, core.BOT_LEVEL_EXPERT}
+	c, err := Calibrate2D(opts, levels, 4, 0.02)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Scores[0][1]+c.Scores[1][0] != 1 {
+		t.Fatalf("expected the points of a pair to sum to 1, got %v", c.Scores)
+	}
+	if c.Scores[1][0] <= c.Scores[0][1] {
+		t.Fatalf("expected expert to outscore beginner, got\n%v", c)
+	}
+}
+
+func TestCalibrate3D(t *testing.T) {
+	opts := core.MatchOpts3D{R: 3, C: 3, H: 3, A: 3}
+	levels := []core.BOT_LEVEL{core.BOT_LEVEL_BEGINNER, core.BOT_LEVEL_EASY}
+	c, err := Calibrate3D(opts, levels, 2, 0.02)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Scores[0][1]+c.Scores[1][0] != 1 {
+		t.Fatalf("expected the points of a pair to sum to 1, got %v", c.Scores)
+	}
+}
+
+// TestCalibrate_Levels records the score matrices of every level in calibration.md. It takes
+// a while, so it only runs with -calibrate
+func TestCalibrate_Levels(t *testing.T) {
+	if !*calibrateFlag {
+		t.Skip("run with -calibrate to calibrate the levels")
+	}
+	levels := []core.BOT_LEVEL{core.BOT_LEVEL_BEGINNER, core.BOT_LEVEL_EASY, core.BOT_LEVEL_MEDIUM,
+		core.BOT_LEVEL_HARD, core.BOT_LEVEL_EXPERT}
+	const games, scale = 20, 0.1
+	c2, err := Calibrate2D(core.MatchOpts{W: 7, H: 6, A: 4}, levels, games, scale)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c3, err := Calibrate3D(core.MatchOpts3D{R: 4, C: 4, H: 4, A: 4}, levels, games, scale)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	doc := fmt.Sprintf(`# Bot level calibration
+
+Written by `+"`go test ./src/engine -run TestCalibrate_Levels -calibrate`"+`. Each cell is the share of
+the points the level of the row scored against the level of the column, over %d games of which
+each level started half, a win being worth a point and a draw half a point. Each level thought
+for %v of its think time. On 7x6 boards, the expert bots had a solver without a book.
+
+## 7x6 Connect Four
+
+%v
+
+## 4x4x4 with gravity
+
+%v
+`, games, scale, c2, c3)
+	if err := os.WriteFile("calibration.md", []byte(doc), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package engine
+
+import (
+	"connectx/src/core"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultIterations is how many playouts MCTS runs when it has neither Iterations nor a budget
+const defaultIterations = 10000
+
+// Result3D is the outcome of a search of a 3D match
+type Result3D struct {
+	Move core.Move3D
+	// Value is the mean playout score of Move for the player who searched, from 0 for a loss to 1
+	// for a win. Forced moves are found without playouts: winning moves are worth 1, and lone
+	// moves that don't lose on the spot are worth 0.5
+	Value float64
+	// Playouts is how many playouts were run
+	Playouts int
+}
+
+// MCTS searches 3D matches with Monte Carlo tree search, selecting moves by UCT and scoring them
+// with random playouts to the end of the match. Each worker grows a tree of its own, on a copy
+// of the match, and the trees are merged at the root, where the most visited move is played.
+//
+// The search is tactically safe: it takes a win on the spot, and otherwise only tries the
+// moves after which the next player can't win on the spot, if there are any
+type MCTS struct {
+	// Iterations limits how many playouts are run, across workers. 0 leaves it to the budget
+	Iterations int
+	// Workers is how many goroutines run playouts. 0 means runtime.GOMAXPROCS
+	Workers int
+	// Exploration is the UCT exploration constant. 0 means √2
+	Exploration float64
+	// Seed seeds the random playouts, worker by worker
+	Seed uint64
+	// Noise weakens the play: the move is picked by its mean value, raised by up to Noise at
+	// random, instead of by its visits. 0 plays the most visited move
+	Noise float64
+	// Unsafe skips the check for the moves that let the next player win on the spot, as if the
+	// threats went unseen. Playouts may still find them
+	Unsafe bool
+}
+
+// mctsNode is a position of the tree, reached by move
+type mctsNode struct {
+	move core.MoveND
+	// moverID is the ID of the player who made move
+	moverID  string
+	children []*mctsNode
+	// untried holds the moves not expanded into children yet
+	untried []core.MoveND
+	visits  float64
+	// score sums the playout scores for the mover: 1 for a win and 0.5 for a draw
+	score float64
+	// over is set when move ended the match, which winnerID won, unless it was a draw
+	over     bool
+	winnerID string
+}
+
+// Search returns the best move it finds for the player to move in m, within budget and
+// Iterations. A budget of 0 leaves the search to Iterations alone
+func (s *MCTS) Search(m *core.Match3D, budget time.Duration) (Result3D, error) {
+	if m.Gameover {
+		return Result3D{}, fmt.Errorf("game is over")
+	}
+	if !m.Started {
+		return Result3D{}, fmt.Errorf("match has not started yet")
+	}
+	nd := m.MatchND.Copy()
+	moves := nd.LegalMoves()
+	if len(moves) == 0 {
+		return Result3D{}, fmt.Errorf("no legal move")
+	}
+	if move, ok := winningMove(nd, moves); ok {
+		return Result3D{Move: m.BoardMove(move), Value: 1}, nil
+	}
+	if !s.Unsafe {
+		moves = safeMoves(nd, moves)
+	}
+	if len(moves) == 1 {
+		return Result3D{Move: m.BoardMove(moves[0]), Value: 0.5}, nil
+	}
+
+	iterations := int64(s.Iterations)
+	var deadline time.Time
+	if budget > 0 {
+		deadline = time.Now().Add(budget)
+	} else if iterations <= 0 {
+		iterations = defaultIterations
+	}
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	c := s.Exploration
+	if c <= 0 {
+		c = math.Sqrt2
+	}
+
+	var playouts atomic.Int64
+	roots := make([]*mctsNode, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := range roots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(s.Seed, uint64(w)))
+			t := mctsTree{nd: nd.Copy(), rng: rng, c: c}
+			roots[w], errs[w] = t.expandAll(moves)
+			for errs[w] == nil && (iterations <= 0 || playouts.Add(1) <= iterations) &&
+				(deadline.IsZero() || time.Now().Before(deadline)) {
+				errs[w] = t.iterate(roots[w])
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return Result3D{}, err
+		}
+	}
+
+	//the children of every root are in the order of moves
+	best, bestVisits, bestScore := 0, -1.0, 0.0
+	bestNoisy := math.Inf(-1)
+	rng := rand.New(rand.NewPCG(s.Seed, uint64(workers)))
+	total := 0.0
+	for i := range moves {
+		visits, score := 0.0, 0.0
+		for _, root := range roots {
+			visits += root.children[i].visits
+			score += root.children[i].score
+		}
+		total += visits
+		if s.Noise > 0 {
+			if visits > 0 {
+				if noisy := score/visits + s.Noise*rng.Float64(); noisy > bestNoisy {
+					best, bestVisits, bestScore, bestNoisy = i, visits, score, noisy
+				}
+			}
+		} else if visits > bestVisits {
+			best, bestVisits, bestScore = i, visits, score
+		}
+	}
+	res := Result3D{Move: m.BoardMove(moves[best]), Value: 0.5, Playouts: int(total)}
+	if bestVisits > 0 {
+		res.Value = bestScore / bestVisits
+	}
+	return res, nil
+}
+
+// mctsTree is the state of a worker
+type mctsTree struct {
+	nd  *core.MatchND
+	rng *rand.Rand
+	c   float64
+}
+
+// expandAll returns a root with a child per move, in order
+func (t *mctsTree) expandAll(moves []core.MoveND) (*mctsNode, error) {
+	root := &mctsNode{}
+	for _, move := range moves {
+		child, err := t.expand(move)
+		if err != nil {
+			return nil, err
+		}
+		root.children = append(root.children, child)
+		t.nd.UndoMove()
+	}
+	return root, nil
+}
+
+// expand plays move, and returns the node it leads to. It fails if move can't be played, which
+// the moves of LegalMoves always can
+func (t *mctsTree) expand(move core.MoveND) (*mctsNode, error) {
+	moverID := t.nd.Players[t.nd.Turn()].ID
+	res, err := t.nd.ApplyMove(move)
+	if err != nil {
+		return nil, fmt.Errorf("move %v of the search: %w", move, err)
+	}
+	n := &mctsNode{move: move, moverID: moverID}
+	if res != nil {
+		n.over, n.winnerID = true, winnerOf(res, moverID)
+	} else {
+		n.untried = t.nd.LegalMoves()
+	}
+	return n, nil
+}
+
+// iterate runs a playout: it selects a path down the tree by UCT, expands its last node,
+// plays randomly from there to the end of the match, and scores the path with the result
+func (t *mctsTree) iterate(root *mctsNode) error {
+	path := []*mctsNode{root}
+	n := root
+	for !n.over && len(n.untried) == 0 && len(n.children) > 0 {
+		n = t.selectChild(n)
+		t.nd.ApplyMove(n.move)
+		path = append(path, n)
+	}
+	if !n.over && len(n.untried) > 0 {
+		i := t.rng.IntN(len(n.untried))
+		move := n.untried[i]
+		n.untried[i] = n.untried[len(n.untried)-1]
+		n.untried = n.untried[:len(n.untried)-1]
+		child, err := t.expand(move)
+		if err != nil {
+			for range len(path) - 1 {
+				t.nd.UndoMove()
+			}
+			return err
+		}
+		n.children = append(n.children, child)
+		n = child
+		path = append(path, n)
+	}
+	winnerID, draw := n.winnerID, n.winnerID == ""
+	if !n.over {
+		winnerID, draw = t.playout()
+	}
+	for _, p := range path {
+		p.visits++
+		if draw {
+			p.score += 0.5
+		} else if p.moverID == winnerID {
+			p.score++
+		}
+	}
+	for range len(path) - 1 {
+		t.nd.UndoMove()
+	}
+	return nil
+}
+
+// selectChild returns the child of n with the best UCT value, trying unvisited children first
+func (t *mctsTree) selectChild(n *mctsNode) *mctsNode {
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	logVisits := math.Log(n.visits)
+	for _, child := range n.children {
+		if child.visits == 0 {
+			return child
+		}
+		v := child.score/child.visits + t.c*math.Sqrt(logVisits/child.visits)
+		if v > bestValue {
+			best, bestValue = child, v
+		}
+	}
+	return best
+}
+
+// playout drops discs at random until the match ends, takes them back, and returns the ID of
+// the winner, or reports a draw
+func (t *mctsTree) playout() (string, bool) {
+	var moves []core.MoveND
+	for _, move := range t.nd.LegalMoves() {
+		if move.Kind == core.MOVE_KIND_DROP {
+			moves = append(moves, move)
+		}
+	}
+	played := 0
+	defer func() {
+		for range played {
+			t.nd.UndoMove()
+		}
+	}()
+	noGravity := t.nd.Opts.Gravity == core.NO_GRAVITY
+	for len(moves) > 0 {
+		i := t.rng.IntN(len(moves))
+		moverID := t.nd.Players[t.nd.Turn()].ID
+		res, err := t.nd.ApplyMove(moves[i])
+		if err == nil {
+			played++
+		}
+		//a full stick takes no more drops, and a cell without gravity takes a single one
+		if err != nil || noGravity {
+			moves[i] = moves[len(moves)-1]
+			moves = moves[:len(moves)-1]
+		}
+		if res == nil {
+			continue
+		}
+		winnerID := winnerOf(res, moverID)
+		return winnerID, winnerID == ""
+	}
+	return "", true
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"connectx/src/core"
+	"testing"
+	"time"
+)
+
+// newMatch3D returns a started match where the moves in notation were played
+func newMatch3D(t *testing.T, opts core.MatchOpts3D, notation string) *core.Match3D {
+	t.Helper()
+	match, err := core.NewMatch3D("p1", "p2", opts)
+	if err != nil {
+		t.Fatal("unexpected err in match creation: ", err)
+	}
+	match.Started = true
+	moves, err := core.ParseMoves3D(opts, notation)
+	if err != nil {
+		t.Fatal("unexpected err parsing moves: ", err)
+	}
+	for _, move := range moves {
+		if _, err := match.RegisterMove(move, match.Players[match.Turn()].ID); err != nil {
+			t.Fatalf("unexpected err playing %+v: %v", move, err)
+		}
+	}
+	return match
+}
+
+func TestMCTS_Search_TakesWin(t *testing.T) {
+	opts := core.MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true}
+	match := newMatch3D(t, opts, "1,1 2,1 1,2 2,2 1,3 2,3")
+	s := MCTS{Iterations: 100}
+	res, err := s.Search(match, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Move.Row != 0 || res.Move.Col != 3 || res.Value != 1 {
+		t.Fatalf("expected a win at 1,4, got %+v", res)
+	}
+}
+
+func TestMCTS_Search_BlocksLoss(t *testing.T) {
+	opts := core.MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true}
+	match := newMatch3D(t, opts, "1,1 4,4 1,2 4,3 1,3")
+	s := MCTS{Iterations: 100}
+	res, err := s.Search(match, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Move.Row != 0 || res.Move.Col != 3 {
+		t.Fatalf("expected a block at 1,4, got %+v", res.Move)
+	}
+}
+
+func TestMCTS_Search_Iterations(t *testing.T) {
+	opts := core.MatchOpts3D{R: 4, C: 4, H: 4, A: 4, Starts1: true, Gravity: core.GRAVITY_3D_NONE}
+	match := newMatch3D(t, opts, "2,2,2")
+	s := MCTS{Iterations: 2000, Workers: 2, Seed: 7}
+	res, err := s.Search(match, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Playouts != 2000 {
+		t.Fatalf("expected 2000 playouts, got %d", res.Playouts)
+	}
+	if match.Board[res.Move.Row][res.Move.Col][res.Move.H] != core.SLOT_EMPTY {
+		t.Fatalf("expected a move on an empty cell, got %+v", res.Move)
+	}
+}
+
+func TestMCTS_Search_Budget(t *testing.T) {
+	opts := core.MatchOpts3D{R: 10, C: 10, H: 10, A: 5, Starts1: true, Players: 3}
+	match, err := core.NewMatch3D("p1", "p2", opts)
+	if err != nil {
+		t.Fatal("unexpected err in match creation: ", err)
+	}
+	match.Join("p3", time.Now())
+	var s MCTS
+	start := time.Now()
+	res, err := s.Search(match, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the search to stop near its budget, took %v", elapsed)
+	}
+	if _, err := match.RegisterMove(res.Move, "p1"); err != nil {
+		t.Fatalf("the bot played an illegal move %+v: %v", res.Move, err)
+	}
+}
+
+func TestMCTS_Search_NoMove(t *testing.T) {
+	opts := core.MatchOpts3D{R: 1, C: 1, H: 4, A: 2, Starts1: true}
+	match := newMatch3D(t, opts, "1,1 1,1 1,1 1,1")
+	if !match.Gameover {
+		t.Fatal("expected the full board to end the match")
+	}
+	//a position the rules would have ended
+	match.Gameover = false
+	s := MCTS{Iterations: 100}
+	if _, err := s.Search(match, 0); err == nil {
+		t.Fatal("expected an error for a position without moves")
+	}
+}
@@ -0,0 +1,563 @@
+// Package engine holds the bots that play against humans on the server, on top of the core
+// rules. Bots search copies of the match, so they never touch the match being played
+package engine
+
+import (
+	"connectx/src/core"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// WIN_SCORE is the score of a position won on the spot. Positions won in n plies score
+// WIN_SCORE-n, so that faster wins score better, and lost positions score the opposite
+const WIN_SCORE = 1 << 48
+
+const (
+	// maxPly bounds the depth of the search, for PopOut matches which can go on forever
+	maxPly = 128
+	// forcedScore is the lowest score of a forced win
+	forcedScore = WIN_SCORE - maxPly
+	// checkEvery is how many nodes are searched between deadline checks
+	checkEvery = 1024
+	// defaultTableBits sizes the transposition table when Searcher.TableBits is 0
+	defaultTableBits = 20
+	// clockMargin is how much of the clock ClockBudget keeps in reserve, in milliseconds
+	clockMargin = 200
+)
+
+// bound tells how a transposition table score relates to the exact score of its position
+type bound uint8
+
+const (
+	boundExact bound = iota
+	// boundLower is a score that failed high: the exact score is at least this much
+	boundLower
+	// boundUpper is a score that failed low: the exact score is at most this much
+	boundUpper
+)
+
+type ttEntry struct {
+	key   uint64
+	score int64
+	// move is the best move found, as a moveKey, or -1
+	move  int32
+	depth int16
+	bound bound
+}
+
+// Result is the outcome of a search
+type Result struct {
+	Move core.Move
+	// Score is the score of Move for the player who searched: positive is good for them, and
+	// beyond WIN_SCORE-Depth it is a forced win
+	Score int64
+	// Depth is the depth of the last completed iteration, in plies
+	Depth int
+	// Nodes is how many positions were searched
+	Nodes int
+}
+
+// Searcher searches 2D matches with negamax and alpha-beta pruning, by iterative deepening
+// until its time budget runs out. Moves are tried from the center of the board out, after the
+// best move stored in the transposition table. In matches of more than two players, the
+// searcher plays paranoid: it assumes every opponent plays against it.
+//
+// A Searcher keeps its transposition table from one search to the next, and must not be used
+// by several goroutines at once
+type Searcher struct {
+	// MaxDepth limits the depth of the search, in plies. 0 searches as deep as the budget allows
+	MaxDepth int
+	// TableBits sets the size of the transposition table to 1<<TableBits entries. 0 means 20
+	TableBits int
+	// Noise weakens the play: when the move is picked, the score of each root move is raised by
+	// up to Noise at random. 0 plays the best move
+	Noise int64
+	// Seed seeds the noise
+	Seed uint64
+
+	table []ttEntry
+	// opts are the options the table and the keys were made for
+	opts     core.MatchOptsND
+	cellKeys [][core.MAX_PLAYERS]uint64
+	turnKeys [core.MAX_PLAYERS]uint64
+	pieKey   uint64
+	// center ranks each cell by its distance from the center of the board
+	center []int
+	// weights holds the evaluation weight of an open line with k discs
+	weights []int64
+
+	rootID   string
+	deadline time.Time
+	nodes    int
+	stopped  bool
+	// err is the error that stopped the search, if any
+	err error
+	// near marks the cells near discs, for the moves of boards without gravity
+	near    []int
+	nearGen int
+	rng     *rand.Rand
+}
+
+// Search returns the best move it finds for the player to move in m, within budget. A budget
+// of 0 leaves the depth to MaxDepth alone. The move is the best one of the deepest completed
+// iteration, and the first iteration always completes
+func (s *Searcher) Search(m *core.Match2D, budget time.Duration) (Result, error) {
+	if m.Gameover {
+		return Result{}, fmt.Errorf("game is over")
+	}
+	if !m.Started {
+		return Result{}, fmt.Errorf("match has not started yet")
+	}
+	res, move, err := s.search(m.MatchND.Copy(), budget)
+	if err != nil {
+		return Result{}, err
+	}
+	res.Move = m.BoardMove(move)
+	return res, nil
+}
+
+// ClockBudget returns how long the player to move in m can think at the given time: a share of
+// their clock, as if the rest of the board was to be played, plus most of the increment. It is
+// never more than limit, which is the budget of untimed matches, nor less than a millisecond
+func ClockBudget(m *core.MatchND, at time.Time, limit time.Duration) time.Duration {
+	if m.Opts.T0 <= 0 {
+		return limit
+	}
+	left := m.ClockLeft(at)
+	//the moves still to play, one in every len(m.Players) empty cells
+	moves := max(int64(empties(m)/len(m.Players)), 1)
+	budget := left/(moves+2) + m.Opts.TD*3/4
+	//a margin for the latency of the network, and for the search to wind up
+	budget = min(budget, left/2, left-clockMargin)
+	//a budget of 0 would lift the time limit
+	return min(max(time.Duration(budget)*time.Millisecond, time.Millisecond), limit)
+}
+
+// search runs the iterative deepening on nd, which is a copy of the match
+func (s *Searcher) search(nd *core.MatchND, budget time.Duration) (Result, core.MoveND, error) {
+	s.prepare(nd)
+	if id := nd.Players[nd.Turn()].ID; id != s.rootID {
+		//the paranoid scores of matches of more than two players depend on who searches
+		clear(s.table)
+		s.rootID = id
+	}
+	s.nodes, s.stopped, s.err = 0, false, nil
+	s.deadline = time.Time{}
+	if budget > 0 {
+		s.deadline = time.Now().Add(budget)
+	}
+	maxDepth := s.MaxDepth
+	if maxDepth <= 0 || maxDepth > maxPly {
+		maxDepth = maxPly
+	}
+	//without pops, no game lasts longer than its empty cells, plus a swap
+	if nd.Opts.Variant != core.VARIANT_POPOUT {
+		maxDepth = min(maxDepth, empties(nd)+1)
+	}
+
+	moves := nd.LegalMoves()
+	if len(moves) == 0 {
+		return Result{}, core.MoveND{}, fmt.Errorf("no legal move")
+	}
+	res := Result{Score: -WIN_SCORE}
+	best := moves[0]
+	h := s.hash(nd)
+	for depth := 1; depth <= maxDepth; depth++ {
+		score, move, ok := s.root(nd, h, depth)
+		if s.err != nil {
+			return Result{}, core.MoveND{}, s.err
+		}
+		if !ok {
+			break
+		}
+		res.Score, res.Depth, best = score, depth, move
+		if score >= forcedScore || score <= -forcedScore {
+			break
+		}
+	}
+	res.Nodes = s.nodes
+	return res, best, nil
+}
+
+// root searches the moves of the root position to the given depth. It reports false if the
+// deadline or an error stopped the search before it completed. The deadline doesn't stop depth 1
+func (s *Searcher) root(nd *core.MatchND, h uint64, depth int) (int64, core.MoveND, bool) {
+	if depth == 1 {
+		//the first iteration completes, to always have a move
+		deadline := s.deadline
+		s.deadline = time.Time{}
+		defer func() { s.deadline = deadline }()
+	}
+	alpha := int64(-WIN_SCORE - 1)
+	var best core.MoveND
+	//the move picked with noise, its score, and its score with noise
+	var picked core.MoveND
+	pickedScore, pickedNoisy := int64(0), int64(-WIN_SCORE-1)
+	for _, move := range s.orderedMoves(nd, s.tableMove(h)) {
+		var score int64
+		if s.Noise > 0 {
+			//the moves are picked by their exact scores, which a narrower window doesn't give
+			score = s.child(nd, h, move, depth, 0, -WIN_SCORE-1, WIN_SCORE+1)
+		} else {
+			score = s.child(nd, h, move, depth, 0, alpha, WIN_SCORE+1)
+		}
+		if s.stopped {
+			return 0, core.MoveND{}, false
+		}
+		if score > alpha {
+			alpha, best = score, move
+		}
+		if s.Noise > 0 {
+			if noisy := score + s.rng.Int64N(s.Noise+1); noisy > pickedNoisy {
+				picked, pickedScore, pickedNoisy = move, score, noisy
+			}
+		}
+	}
+	s.store(h, alpha, s.moveKey(nd, best), depth, 0, boundExact)
+	if s.Noise > 0 {
+		return pickedScore, picked, true
+	}
+	return alpha, best, true
+}
+
+// negamax returns the score of nd for the player to move, searched to the given depth. Scores
+// outside of (alpha, beta) are bounds
+func (s *Searcher) negamax(nd *core.MatchND, h uint64, depth, ply int, alpha, beta int64) int64 {
+	s.nodes++
+	if s.nodes%checkEvery == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	if s.stopped {
+		return 0
+	}
+	e := &s.table[h&uint64(len(s.table)-1)]
+	ttMove := int32(-1)
+	if e.key == h {
+		ttMove = e.move
+		if int(e.depth) >= depth {
+			score := fromTable(e.score, ply)
+			switch {
+			case e.bound == boundExact,
+				e.bound == boundLower && score >= beta,
+				e.bound == boundUpper && score <= alpha:
+				return score
+			}
+		}
+	}
+	if depth == 0 {
+		return s.evaluate(nd)
+	}
+
+	alpha0 := alpha
+	best, bestMove := int64(-WIN_SCORE-1), int32(-1)
+	for _, move := range s.orderedMoves(nd, ttMove) {
+		score := s.child(nd, h, move, depth, ply, alpha, beta)
+		if s.stopped {
+			return 0
+		}
+		if score > best {
+			best, bestMove = score, s.moveKey(nd, move)
+		}
+		alpha = max(alpha, score)
+		if alpha >= beta {
+			break
+		}
+	}
+	if bestMove < 0 {
+		//no move left, which the rules end as a draw
+		return 0
+	}
+	b := boundExact
+	if best <= alpha0 {
+		b = boundUpper
+	} else if best >= beta {
+		b = boundLower
+	}
+	s.store(h, best, bestMove, depth, ply, b)
+	return best
+}
+
+// child plays move on nd, and returns its score for the player who made it, searched to the
+// given depth
+func (s *Searcher) child(nd *core.MatchND, h uint64, move core.MoveND, depth, ply int, alpha, beta int64) int64 {
+	moverID := nd.Players[nd.Turn()].ID
+	turn := nd.Turn()
+	res, err := nd.ApplyMove(move)
+	if err != nil {
+		//the moves come from LegalMoves, so this is a bug: the search stops on it
+		s.err, s.stopped = fmt.Errorf("move %v of the search: %w", move, err), true
+		return 0
+	}
+	defer nd.UndoMove()
+	if res != nil {
+		return s.resultScore(res, moverID, ply+1)
+	}
+	if move.Kind == core.MOVE_KIND_DROP {
+		h ^= s.cellKeys[s.index(nd, move.Cell)][turn] ^ s.turnKeys[turn] ^ s.turnKeys[nd.Turn()]
+		if nd.Opts.Pie && len(nd.Moves) == 1 {
+			h ^= s.pieKey
+		}
+	} else {
+		h = s.hash(nd)
+	}
+	//teammates take turns without a change of sign, in the paranoid search
+	if s.onRootTeam(moverID) == s.onRootTeam(nd.Players[nd.Turn()].ID) {
+		return s.negamax(nd, h, depth-1, ply+1, alpha, beta)
+	}
+	return -s.negamax(nd, h, depth-1, ply+1, -beta, -alpha)
+}
+
+func (s *Searcher) onRootTeam(pid string) bool {
+	return pid == s.rootID
+}
+
+// resultScore returns the score of a match that ended ply plies from the root, for the player
+// with moverID who ended it
+func (s *Searcher) resultScore(res core.GameoverResult, moverID string, ply int) int64 {
+	winnerID := winnerOf(res, moverID)
+	if winnerID == "" {
+		return 0
+	}
+	if s.onRootTeam(winnerID) == s.onRootTeam(moverID) {
+		return WIN_SCORE - int64(ply)
+	}
+	return -WIN_SCORE + int64(ply)
+}
+
+// evaluate scores nd for the player to move, by the lines each player can still complete:
+// the more discs such a line holds, the more it weighs
+func (s *Searcher) evaluate(nd *core.MatchND) int64 {
+	counts := make([]int, nd.Opts.A+1)
+	var score int64
+	for seat, p := range nd.Players {
+		if p.Eliminated {
+			continue
+		}
+		nd.OpenLines(seat, counts)
+		var v int64
+		for k := 1; k < len(counts); k++ {
+			v += s.weights[k] * int64(counts[k])
+		}
+		if s.onRootTeam(p.ID) {
+			score += v
+		} else {
+			score -= v
+		}
+	}
+	if !s.onRootTeam(nd.Players[nd.Turn()].ID) {
+		score = -score
+	}
+	return score
+}
+
+// toTable makes a forced win score relative to the position it is stored for, since the same
+// position can be reached at different plies
+func toTable(score int64, ply int) int64 {
+	switch {
+	case score >= forcedScore:
+		return score + int64(ply)
+	case score <= -forcedScore:
+		return score - int64(ply)
+	}
+	return score
+}
+
+// fromTable undoes toTable
+func fromTable(score int64, ply int) int64 {
+	switch {
+	case score >= forcedScore:
+		return score - int64(ply)
+	case score <= -forcedScore:
+		return score + int64(ply)
+	}
+	return score
+}
+
+// store keeps the result of a search in the transposition table, unless the entry holds a
+// deeper search of the same position
+func (s *Searcher) store(h uint64, score int64, move int32, depth, ply int, b bound) {
+	e := &s.table[h&uint64(len(s.table)-1)]
+	if e.key == h && int(e.depth) > depth {
+		return
+	}
+	*e = ttEntry{key: h, score: toTable(score, ply), move: move, depth: int16(depth), bound: b}
+}
+
+// tableMove returns the best move stored for the position with key h, or -1
+func (s *Searcher) tableMove(h uint64) int32 {
+	if e := &s.table[h&uint64(len(s.table)-1)]; e.key == h {
+		return e.move
+	}
+	return -1
+}
+
+// prepare makes the transposition table, the keys and the move order for the options of nd,
+// keeping those of the previous search if they are the same
+func (s *Searcher) prepare(nd *core.MatchND) {
+	bits := s.TableBits
+	if bits <= 0 {
+		bits = defaultTableBits
+	}
+	if len(s.table) != 1<<bits {
+		s.table = make([]ttEntry, 1<<bits)
+	}
+	if s.rng == nil {
+		s.rng = rand.New(rand.NewPCG(s.Seed, 0))
+	}
+	if s.cellKeys != nil && sameOpts(s.opts, nd.Opts) {
+		return
+	}
+	s.opts = nd.Opts
+	clear(s.table)
+	rng := rand.New(rand.NewPCG(1, 2))
+	s.cellKeys = make([][core.MAX_PLAYERS]uint64, len(nd.Cells))
+	for i := range s.cellKeys {
+		for j := range s.cellKeys[i] {
+			s.cellKeys[i][j] = rng.Uint64()
+		}
+	}
+	for j := range s.turnKeys {
+		s.turnKeys[j] = rng.Uint64()
+	}
+	s.pieKey = rng.Uint64()
+
+	h, w := nd.Opts.Dims[0], nd.Opts.Dims[1]
+	s.center = make([]int, len(nd.Cells))
+	for idx := range s.center {
+		//doubled distances, to stay on integers on boards of even size
+		dr, dc := abs(2*(idx/w)-(h-1)), abs(2*(idx%w)-(w-1))
+		if nd.Opts.Gravity != core.NO_GRAVITY {
+			//only the column matters to drops
+			dr = 0
+		}
+		s.center[idx] = max(dr, dc)*4 + min(dr, dc)
+	}
+	s.near = make([]int, len(nd.Cells))
+	s.nearGen = 0
+
+	//a line with one more disc outweighs several with one less
+	s.weights = make([]int64, nd.Opts.A+1)
+	for k := 1; k <= nd.Opts.A; k++ {
+		s.weights[k] = 1
+		for range k - 1 {
+			s.weights[k] *= 3
+		}
+	}
+}
+
+// sameOpts tells whether matches played with a and b have the same board
+func sameOpts(a, b core.MatchOptsND) bool {
+	return slices.Equal(a.Dims, b.Dims) && a.Gravity == b.Gravity && a.A == b.A &&
+		a.Variant == b.Variant && a.Exact == b.Exact && a.Pie == b.Pie && a.Scoring == b.Scoring &&
+		slices.Equal(a.Wrap, b.Wrap) && slices.Equal(a.Blocked, b.Blocked)
+}
+
+// hash returns the key of nd in the transposition table
+func (s *Searcher) hash(nd *core.MatchND) uint64 {
+	var h uint64
+	for idx, c := range nd.Cells {
+		if c != core.SLOT_EMPTY && c != core.SLOT_BLOCKED {
+			h ^= s.cellKeys[idx][c-1]
+		}
+	}
+	h ^= s.turnKeys[nd.Turn()]
+	if nd.Opts.Pie && len(nd.Moves) == 1 {
+		h ^= s.pieKey
+	}
+	return h
+}
+
+func (s *Searcher) index(nd *core.MatchND, cell core.PointND) int {
+	return cell[0]*nd.Opts.Dims[1] + cell[1]
+}
+
+// moveKey packs move in an int32, for the transposition table
+func (s *Searcher) moveKey(nd *core.MatchND, move core.MoveND) int32 {
+	return int32(s.index(nd, move.Cell)*3 + int(move.Kind))
+}
+
+// orderedMoves returns the moves to search in nd: the move of the transposition table first, then
+// the drops from the center of the board out, and then the pops and the swap. Without gravity,
+// only the cells near discs are tried, unless the board has none
+func (s *Searcher) orderedMoves(nd *core.MatchND, ttMove int32) []core.MoveND {
+	moves := nd.LegalMoves()
+	if nd.Opts.Gravity == core.NO_GRAVITY {
+		moves = s.nearMoves(nd, moves)
+	}
+	rank := func(move core.MoveND) int {
+		switch {
+		case s.moveKey(nd, move) == ttMove:
+			return -1
+		case move.Kind != core.MOVE_KIND_DROP:
+			return len(s.center)*4 + s.center[s.index(nd, move.Cell)]
+		}
+		return s.center[s.index(nd, move.Cell)]
+	}
+	slices.SortStableFunc(moves, func(a, b core.MoveND) int { return rank(a) - rank(b) })
+	return moves
+}
+
+// nearMoves keeps the moves within two cells of a disc, counting across the wrapping edges, or
+// all of them if none is
+func (s *Searcher) nearMoves(nd *core.MatchND, moves []core.MoveND) []core.MoveND {
+	h, w := nd.Opts.Dims[0], nd.Opts.Dims[1]
+	wrapH := len(nd.Opts.Wrap) > 0 && nd.Opts.Wrap[0]
+	wrapW := len(nd.Opts.Wrap) > 1 && nd.Opts.Wrap[1]
+	s.nearGen++
+	found := false
+	for idx, c := range nd.Cells {
+		if c == core.SLOT_EMPTY || c == core.SLOT_BLOCKED {
+			continue
+		}
+		found = true
+		for dr := -2; dr <= 2; dr++ {
+			r := idx/w + dr
+			if wrapH {
+				r = (r + h) % h
+			}
+			if r < 0 || r >= h {
+				continue
+			}
+			for dc := -2; dc <= 2; dc++ {
+				c := idx%w + dc
+				if wrapW {
+					c = (c + w) % w
+				}
+				if c >= 0 && c < w {
+					s.near[r*w+c] = s.nearGen
+				}
+			}
+		}
+	}
+	var near []core.MoveND
+	for _, move := range moves {
+		if s.near[s.index(nd, move.Cell)] == s.nearGen {
+			near = append(near, move)
+		}
+	}
+	if !found || len(near) == 0 {
+		//the blocked cells can leave every empty cell far from the discs
+		return moves
+	}
+	return near
+}
+
+// empties returns how many cells of nd are empty
+func empties(nd *core.MatchND) int {
+	n := 0
+	for _, c := range nd.Cells {
+		if c == core.SLOT_EMPTY {
+			n++
+		}
+	}
+	return n
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"connectx/src/core"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newMatch2D returns a started match where the moves in notation were played
+func newMatch2D(t *testing.T, opts core.MatchOpts, notation string) *core.Match2D {
+	t.Helper()
+	match, err := core.NewMatch2D("p1", "p2", opts)
+	if err != nil {
+		t.Fatal("unexpected err in match creation: ", err)
+	}
+	for i := 3; i <= opts.Players; i++ {
+		match.Join(fmt.Sprintf("p%d", i), time.Now())
+	}
+	match.Started = true
+	moves, err := core.ParseMoves2D(opts, notation)
+	if err != nil {
+		t.Fatal("unexpected err parsing moves: ", err)
+	}
+	for _, move := range moves {
+		if _, err := match.RegisterMove(move, match.Players[match.Turn()].ID); err != nil {
+			t.Fatalf("unexpected err playing %+v: %v", move, err)
+		}
+	}
+	return match
+}
+
+func TestSearcher_Search_TakesWin(t *testing.T) {
+	match := newMatch2D(t, core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}, "445566")
+	var s Searcher
+	res, err := s.Search(match, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Move.Col != 2 && res.Move.Col != 6 {
+		t.Fatalf("expected a winning drop in column 3 or 7, got %+v", res.Move)
+	}
+	if res.Score != WIN_SCORE-1 {
+		t.Fatalf("expected a win in one ply, got score %d", res.Score)
+	}
+}
+
+func TestSearcher_Search_BlocksLoss(t *testing.T) {
+	match := newMatch2D(t, core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}, "41414")
+	s := Searcher{MaxDepth: 4}
+	res, err := s.Search(match, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Move.Col != 3 {
+		t.Fatalf("expected a block in column 4, got %+v", res.Move)
+	}
+}
+
+func TestSearcher_Search_SolvesTicTacToe(t *testing.T) {
+	opts := core.MatchOpts{W: 3, H: 3, A: 3, Starts1: true, NoGravity: true}
+	var s Searcher
+	res, err := s.Search(newMatch2D(t, opts, ""), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Score != 0 || res.Depth != 10 {
+		t.Fatalf("expected a draw searched to the end, got score %d at depth %d", res.Score, res.Depth)
+	}
+
+	//an edge answer to the center loses to a double threat, unlike a corner one
+	res, err = s.Search(newMatch2D(t, opts, "2,2 1,2"), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Score < forcedScore {
+		t.Fatalf("expected a forced win after an edge answer, got score %d", res.Score)
+	}
+}
+
+func TestSearcher_Search_Budget(t *testing.T) {
+	opts := core.MatchOpts{W: 15, H: 15, A: 5, Starts1: true, NoGravity: true}
+	match := newMatch2D(t, opts, "8,8 8,9 9,9")
+	var s Searcher
+	start := time.Now()
+	res, err := s.Search(match, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the search to stop near its budget, took %v", elapsed)
+	}
+	if res.Depth < 1 || match.Board[res.Move.Row][res.Move.Col] != core.SLOT_EMPTY {
+		t.Fatalf("expected a legal move, got %+v at depth %d", res.Move, res.Depth)
+	}
+}
+
+func TestSearcher_Search_Variants(t *testing.T) {
+	for _, opts := range []core.MatchOpts{
+		{W: 7, H: 6, A: 4, Starts1: true, Variant: core.VARIANT_POPOUT},
+		{W: 7, H: 6, A: 4, Starts1: true, Pie: true},
+		{W: 7, H: 6, A: 4, Starts1: true, Scoring: true},
+		{W: 7, H: 6, A: 4, Starts1: true, WrapW: true, Exact: true},
+		{W: 9, H: 7, A: 4, Starts1: true, Players: 3},
+	} {
+		match := newMatch2D(t, opts, "4")
+		s := Searcher{MaxDepth: 5, TableBits: 12}
+		//the bot plays both sides until the end
+		for !match.Gameover && len(match.Moves) < 30 {
+			res, err := s.Search(match, 0)
+			if err != nil {
+				t.Fatalf("%+v: unexpected error: %v", opts, err)
+			}
+			if _, err := match.RegisterMove(res.Move, match.Players[match.Turn()].ID); err != nil {
+				t.Fatalf("%+v: the bot played an illegal move %+v: %v", opts, res.Move, err)
+			}
+		}
+	}
+}
+
+func TestClockBudget(t *testing.T) {
+	start := time.Now()
+	untimed := newMatch2D(t, core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}, "")
+	if got := ClockBudget(untimed.MatchND, start, time.Second); got != time.Second {
+		t.Fatalf("expected the limit in untimed matches, got %v", got)
+	}
+	timed := newMatch2D(t, core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true, T0: 60000, TD: 1000}, "")
+	timed.StartedAt = start
+	//21 moves left, so a 23rd of the minute plus 3/4 of the increment
+	if got := ClockBudget(timed.MatchND, start, time.Minute); got != (60000/23+750)*time.Millisecond {
+		t.Fatalf("unexpected budget %v", got)
+	}
+	if got := ClockBudget(timed.MatchND, start.Add(59900*time.Millisecond), time.Minute); got != time.Millisecond {
+		t.Fatalf("expected the least budget in time trouble, got %v", got)
+	}
+}
+
+func TestSearcher_Search_Noise(t *testing.T) {
+	opts := core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+	cols := map[int]bool{}
+	for seed := range uint64(20) {
+		s := Searcher{MaxDepth: 3, Noise: 30, Seed: seed}
+		res, err := s.Search(newMatch2D(t, opts, ""), 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cols[res.Move.Col] = true
+
+		//noise never outweighs a win
+		res, err = s.Search(newMatch2D(t, opts, "445566"), 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Score != WIN_SCORE-1 {
+			t.Fatalf("expected a win with seed %d, got %+v", seed, res)
+		}
+	}
+	if len(cols) < 2 {
+		t.Fatalf("expected noise to vary the opening move, got columns %v", cols)
+	}
+}
+
+func TestSearcher_Search_FarCells(t *testing.T) {
+	// the only cells left to play are far from the disc
+	opts := core.MatchOpts{W: 7, H: 3, A: 2, Starts1: true, NoGravity: true, Mask: [][]bool{
+		{true, true, true, false, false, false, false},
+		{false, true, true, false, false, false, false},
+		{true, true, true, false, false, false, false},
+	}}
+	match := newMatch2D(t, opts, "")
+	if _, err := match.RegisterMove(core.Move{Row: 1, Col: 0}, "p1"); err != nil {
+		t.Fatal("unexpected err: ", err)
+	}
+	s := Searcher{MaxDepth: 3, TableBits: 12}
+	res, err := s.Search(match, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := match.RegisterMove(res.Move, "p2"); err != nil {
+		t.Fatalf("the bot played an illegal move %+v: %v", res.Move, err)
+	}
+}
+
+func TestSearcher_Search_NoMove(t *testing.T) {
+	opts := core.MatchOpts{W: 4, H: 4, A: 3, Starts1: true, Mask: [][]bool{
+		make([]bool, 4),
+		{true, false, false, false},
+		make([]bool, 4),
+		make([]bool, 4),
+	}}
+	match := newMatch2D(t, opts, "3422223143344")
+	//a position the rules would have ended
+	match.Gameover = false
+	var s Searcher
+	if _, err := s.Search(match, time.Second); err == nil {
+		t.Fatal("expected an error for a position without moves")
+	}
+}
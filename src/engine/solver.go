@@ -0,0 +1,543 @@
+package engine
+
+import (
+	"connectx/src/core"
+	"connectx/src/errs"
+	"fmt"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The solver plays standard Connect Four: 7 columns of 6 rows, where 4 in a row wins. Its boards
+// are uint64 bitsets of 7 bits per column, bottom-up, whose top bit is always empty, like the
+// columns of core.Bitboard2D
+const (
+	c4W, c4H = 7, 6
+	c4Cells  = c4W * c4H
+	// c4Min and c4Max bound the scores of the positions that are not won on the spot
+	c4Min = -c4Cells/2 + 3
+	c4Max = (c4Cells+1)/2 - 3
+	// defaultSolverBits sizes the transposition table when Solver.TableBits is 0
+	defaultSolverBits = 23
+)
+
+var (
+	// c4Bottom has the bottom cell of every column, and c4Board every cell
+	c4Bottom = bottomRow()
+	c4Board  = c4Bottom * (1<<c4H - 1)
+)
+
+func bottomRow() uint64 {
+	var b uint64
+	for col := range c4W {
+		b |= 1 << (col * (c4H + 1))
+	}
+	return b
+}
+
+func columnBits(col int) uint64 {
+	return (1<<c4H - 1) << (col * (c4H + 1))
+}
+
+// OUTCOME is how a position ends with perfect play, for the player to move
+type OUTCOME int
+
+const (
+	OUTCOME_LOSS OUTCOME = iota
+	OUTCOME_DRAW
+	OUTCOME_WIN
+)
+
+// Solution is the exact value of a position for the player to move
+type Solution struct {
+	Outcome OUTCOME `json:"outcome"`
+	// Plies is how many plies are left until the win or the loss, with perfect play: the winner
+	// wins as fast as they can, and the loser loses as late. It is 0 for draws
+	Plies int `json:"plies"`
+}
+
+// solution returns the solution of a score of the solver for a position with moves discs. A
+// score s > 0 means the player to move wins with their disc number 44-2s or 43-2s, whichever
+// they play; s < 0 means the same for their opponent
+func solution(score, moves int) Solution {
+	switch {
+	case score == 0:
+		return Solution{Outcome: OUTCOME_DRAW}
+	case score > 0:
+		return Solution{Outcome: OUTCOME_WIN, Plies: winningDisc(score, moves+1) - moves}
+	}
+	return Solution{Outcome: OUTCOME_LOSS, Plies: winningDisc(-score, moves) - moves}
+}
+
+// winningDisc returns the number of the disc that wins with score s, which has the parity of n
+func winningDisc(s, n int) int {
+	if d := c4Cells + 2 - 2*s; d%2 == n%2 {
+		return d
+	}
+	return c4Cells + 1 - 2*s
+}
+
+// after returns the solution a move leading to the position of sol keeps for its mover
+func (sol Solution) after() Solution {
+	switch sol.Outcome {
+	case OUTCOME_WIN:
+		return Solution{Outcome: OUTCOME_LOSS, Plies: sol.Plies + 1}
+	case OUTCOME_LOSS:
+		return Solution{Outcome: OUTCOME_WIN, Plies: sol.Plies + 1}
+	}
+	return sol
+}
+
+// Better tells whether sol is better than o for the player to move: wins beat draws, which beat
+// losses, faster wins beat slower ones, and slower losses beat faster ones
+func (sol Solution) Better(o Solution) bool {
+	if sol.Outcome != o.Outcome {
+		return sol.Outcome > o.Outcome
+	}
+	switch sol.Outcome {
+	case OUTCOME_WIN:
+		return sol.Plies < o.Plies
+	case OUTCOME_LOSS:
+		return sol.Plies > o.Plies
+	}
+	return false
+}
+
+// c4Position is a position of standard Connect Four
+type c4Position struct {
+	// cur holds the discs of the player to move, and mask every disc
+	cur, mask uint64
+	moves     int
+}
+
+// key identifies the position: cur+mask sets the bit above each column, and the discs of the
+// player to move below it. No column carries into the next one
+func (p *c4Position) key() uint64 {
+	return p.cur + p.mask
+}
+
+func (p *c4Position) canPlay(col int) bool {
+	return p.mask&(1<<(col*(c4H+1)+c4H-1)) == 0
+}
+
+// columnMove returns the cell a drop in col lands on
+func (p *c4Position) columnMove(col int) uint64 {
+	return (p.mask + 1<<(col*(c4H+1))) & columnBits(col)
+}
+
+// play drops a disc of the player to move on the cell of move
+func (p *c4Position) play(move uint64) {
+	p.cur ^= p.mask
+	p.mask |= move
+	p.moves++
+}
+
+// possible returns the cells the player to move can drop on
+func (p *c4Position) possible() uint64 {
+	return (p.mask + c4Bottom) & c4Board
+}
+
+// wins tells whether move wins on the spot for the player to move
+func (p *c4Position) wins(move uint64) bool {
+	return winningCells(p.cur, p.mask)&move != 0
+}
+
+func (p *c4Position) canWinNext() bool {
+	return winningCells(p.cur, p.mask)&p.possible() != 0
+}
+
+// nonLosingMoves returns the moves after which the opponent can't win on the spot, assuming the
+// player to move can't win on the spot: the lone block of a threat if there is one, and none if
+// there are two, and never the cell under a threat
+func (p *c4Position) nonLosingMoves() uint64 {
+	moves := p.possible()
+	threats := winningCells(p.cur^p.mask, p.mask)
+	if forced := moves & threats; forced != 0 {
+		if forced&(forced-1) != 0 {
+			return 0
+		}
+		moves = forced
+	}
+	return moves &^ (threats >> 1)
+}
+
+// moveScore ranks move by how many cells it makes winning for the player to move
+func (p *c4Position) moveScore(move uint64) int {
+	return bits.OnesCount64(winningCells(p.cur|move, p.mask))
+}
+
+// winningCells returns the empty cells that complete a line of 4 for the player with discs pos
+func winningCells(pos, mask uint64) uint64 {
+	//vertical lines only grow upwards
+	r := (pos << 1) & (pos << 2) & (pos << 3)
+	for _, shift := range [3]int{c4H + 1, c4H, c4H + 2} {
+		p := (pos << shift) & (pos << (2 * shift))
+		r |= p & (pos << (3 * shift))
+		r |= p & (pos >> shift)
+		p = (pos >> shift) & (pos >> (2 * shift))
+		r |= p & (pos << shift)
+		r |= p & (pos >> (3 * shift))
+	}
+	return r & (c4Board ^ mask)
+}
+
+// mirror returns b with its columns in reverse order
+func mirror(b uint64) uint64 {
+	var m uint64
+	for col := range c4W {
+		m |= (b >> (col * (c4H + 1)) & (1<<(c4H+1) - 1)) << ((c4W - 1 - col) * (c4H + 1))
+	}
+	return m
+}
+
+// canonicalKey returns the smaller of the keys of the position and of its mirror image, which
+// have the same solution
+func (p *c4Position) canonicalKey() uint64 {
+	return min(p.key(), mirror(p.key()))
+}
+
+// Solvable tells whether matches with opts are standard Connect Four, which the Solver solves
+func Solvable(opts core.MatchOpts) bool {
+	return opts.W == c4W && opts.H == c4H && opts.A == 4 && opts.Variant == core.VARIANT_CLASSIC &&
+		!opts.NoGravity && !opts.Exact && !opts.WrapW && !opts.WrapH && !opts.Scoring &&
+		opts.Players <= 2 && opts.Mask == nil && opts.RandomMask == nil
+}
+
+// positionOf returns the position of m. The swaps of the pie rule are skipped, since they change
+// who plays each color but not the board
+func positionOf(m *core.Match2D) (c4Position, error) {
+	var p c4Position
+	if !Solvable(m.Opts) {
+		return p, fmt.Errorf("the solver only plays 7x6 boards with 4 in a row and classic rules")
+	}
+	for _, move := range m.Moves {
+		if move.Kind == core.MOVE_KIND_SWAP {
+			continue
+		}
+		col := move.Cell[1]
+		if !p.canPlay(col) {
+			return p, fmt.Errorf("invalid move. column is full")
+		}
+		p.play(p.columnMove(col))
+	}
+	return p, nil
+}
+
+// Solver solves the positions of standard Connect Four, exactly, by negamax with alpha-beta
+// pruning on null windows. Only the moves that don't lose on the spot are searched, the ones that
+// make the most threats first. Openings take it the longest, so it looks them up in Book when
+// there is one.
+//
+// A Solver can be used by several goroutines at once, which share its transposition table
+type Solver struct {
+	Book *Book
+	// TableBits sets the size of the transposition table to 1<<TableBits entries. 0 means 23
+	TableBits int
+
+	once sync.Once
+	// table holds entries of a key, shifted left by 8 bits, and a bound. Each entry is a single
+	// word, so that the goroutines can share the table without locks
+	table []atomic.Uint64
+}
+
+// solveRun is the state of a single solve
+type solveRun struct {
+	*Solver
+	deadline time.Time
+	nodes    int
+	stopped  bool
+}
+
+func (s *Solver) run(budget time.Duration) *solveRun {
+	s.once.Do(func() {
+		bits := s.TableBits
+		if bits <= 0 {
+			bits = defaultSolverBits
+		}
+		s.table = make([]atomic.Uint64, 1<<bits)
+	})
+	r := &solveRun{Solver: s}
+	if budget > 0 {
+		r.deadline = time.Now().Add(budget)
+	}
+	return r
+}
+
+// Solve returns the solution of m for the player to move. The pie rule swap is not taken into
+// account. It returns errs.ErrTimeout if it found none within budget, a budget of 0 being
+// unlimited
+func (s *Solver) Solve(m *core.Match2D, budget time.Duration) (Solution, error) {
+	if m.Gameover {
+		return Solution{}, fmt.Errorf("game is over")
+	}
+	p, err := positionOf(m)
+	if err != nil {
+		return Solution{}, err
+	}
+	return s.run(budget).solution(p)
+}
+
+// Hints returns the solution each column of m leaves to the player to move, nil for the full
+// columns. It returns errs.ErrTimeout if it didn't solve them all within budget, a budget of 0
+// being unlimited
+func (s *Solver) Hints(m *core.Match2D, budget time.Duration) ([]*Solution, error) {
+	if m.Gameover {
+		return nil, fmt.Errorf("game is over")
+	}
+	p, err := positionOf(m)
+	if err != nil {
+		return nil, err
+	}
+	return s.run(budget).hints(p)
+}
+
+// BestMove returns the best column of m for the player to move and its solution. Among equally
+// good columns, it picks the one nearest the center
+func (s *Solver) BestMove(m *core.Match2D, budget time.Duration) (int, Solution, error) {
+	hints, err := s.Hints(m, budget)
+	if err != nil {
+		return 0, Solution{}, err
+	}
+	best := -1
+	for _, col := range centerOut() {
+		if hints[col] != nil && (best < 0 || hints[col].Better(*hints[best])) {
+			best = col
+		}
+	}
+	return best, *hints[best], nil
+}
+
+// centerOut returns the columns from the center of the board out
+func centerOut() [c4W]int {
+	var cols [c4W]int
+	for i := range cols {
+		cols[i] = c4W/2 + (1-2*(i%2))*(i+1)/2
+	}
+	return cols
+}
+
+func (r *solveRun) hints(p c4Position) ([]*Solution, error) {
+	hints := make([]*Solution, c4W)
+	for _, col := range centerOut() {
+		if !p.canPlay(col) {
+			continue
+		}
+		move := p.columnMove(col)
+		var sol Solution
+		switch {
+		case p.wins(move):
+			sol = Solution{Outcome: OUTCOME_WIN, Plies: 1}
+		case p.moves+1 == c4Cells:
+			sol = Solution{Outcome: OUTCOME_DRAW}
+		default:
+			child := p
+			child.play(move)
+			after, err := r.solution(child)
+			if err != nil {
+				return nil, err
+			}
+			sol = after.after()
+		}
+		hints[col] = &sol
+	}
+	return hints, nil
+}
+
+// solution solves p, which must not be over
+func (r *solveRun) solution(p c4Position) (Solution, error) {
+	score := r.solve(p)
+	if r.stopped {
+		return Solution{}, errs.ErrTimeout
+	}
+	return solution(score, p.moves), nil
+}
+
+// solve returns the score of p, narrowing its bounds down with null window searches
+func (r *solveRun) solve(p c4Position) int {
+	if p.canWinNext() {
+		return (c4Cells + 1 - p.moves) / 2
+	}
+	lo, hi := -(c4Cells-p.moves)/2, (c4Cells+1-p.moves)/2
+	for lo < hi && !r.stopped {
+		//search near 0 first, where most scores are
+		med := lo + (hi-lo)/2
+		if med <= 0 && lo/2 < med {
+			med = lo / 2
+		} else if med >= 0 && hi/2 > med {
+			med = hi / 2
+		}
+		if score := r.negamax(p, med, med+1); score <= med {
+			hi = score
+		} else {
+			lo = score
+		}
+	}
+	return lo
+}
+
+// negamax returns the score of p, which the player to move can't win on the spot. Scores
+// outside of (alpha, beta) are bounds
+func (r *solveRun) negamax(p c4Position, alpha, beta int) int {
+	r.nodes++
+	if r.nodes%checkEvery == 0 && !r.deadline.IsZero() && time.Now().After(r.deadline) {
+		r.stopped = true
+	}
+	if r.stopped {
+		return 0
+	}
+	next := p.nonLosingMoves()
+	if next == 0 {
+		return -(c4Cells - p.moves) / 2
+	}
+	if p.moves >= c4Cells-2 {
+		return 0
+	}
+	//the opponent can't win on their next move
+	if lo := -(c4Cells - 2 - p.moves) / 2; alpha < lo {
+		if alpha = lo; alpha >= beta {
+			return alpha
+		}
+	}
+	//the player to move can't win on their next move
+	hi := (c4Cells - 1 - p.moves) / 2
+	key := p.key()
+	if b, ok := r.load(key); ok {
+		if b > c4Max-c4Min+1 {
+			if lo := b + 2*c4Min - c4Max - 2; alpha < lo {
+				if alpha = lo; alpha >= beta {
+					return alpha
+				}
+			}
+		} else {
+			hi = b + c4Min - 1
+		}
+	}
+	if beta > hi {
+		if beta = hi; alpha >= beta {
+			return beta
+		}
+	}
+	if score, ok := r.Book.lookup(&p); ok {
+		return score
+	}
+
+	var moves [c4W]uint64
+	var ranks [c4W]int
+	n := 0
+	for _, col := range centerOut() {
+		move := next & columnBits(col)
+		if move == 0 {
+			continue
+		}
+		//insertion sort by rank, stable for the center-out order
+		rank := p.moveScore(move)
+		i := n
+		for ; i > 0 && ranks[i-1] < rank; i-- {
+			moves[i], ranks[i] = moves[i-1], ranks[i-1]
+		}
+		moves[i], ranks[i] = move, rank
+		n++
+	}
+	for _, move := range moves[:n] {
+		child := p
+		child.play(move)
+		score := -r.negamax(child, -beta, -alpha)
+		if r.stopped {
+			return 0
+		}
+		if score >= beta {
+			r.save(key, score+c4Max-2*c4Min+2)
+			return score
+		}
+		alpha = max(alpha, score)
+	}
+	r.save(key, alpha-c4Min+1)
+	return alpha
+}
+
+// load returns the bound stored for the position with key. Upper bounds u are stored as
+// u-c4Min+1, and lower bounds l as l+c4Max-2*c4Min+2, so that both fit in a byte, above 0
+func (s *Solver) load(key uint64) (int, bool) {
+	e := s.table[mix(key)>>(64-bits.Len(uint(len(s.table)-1)))].Load()
+	if e>>8 != key || e&0xff == 0 {
+		return 0, false
+	}
+	return int(e & 0xff), true
+}
+
+func (s *Solver) save(key uint64, b int) {
+	s.table[mix(key)>>(64-bits.Len(uint(len(s.table)-1)))].Store(key<<8 | uint64(b))
+}
+
+// mix spreads the bits of key over the index of the table
+func mix(key uint64) uint64 {
+	return key * 0x9e3779b97f4a7c15
+}
+
+// MoveAnalysis is the verdict of the solver on a drop of a match
+type MoveAnalysis struct {
+	// Ply is the index of the drop among the moves of the match
+	Ply int `json:"ply"`
+	Col int `json:"col"`
+	// Best is the solution of the position for the player who dropped, which the best move keeps,
+	// and Played the solution the drop kept for them. They are nil when the solver ran out of time
+	Best   *Solution `json:"best"`
+	Played *Solution `json:"played"`
+	// Mistake tells whether the drop turned a win into a draw or a loss, or a draw into a loss
+	Mistake bool `json:"mistake"`
+}
+
+// Analyze returns the analysis of every drop of m. The positions are solved from the last one
+// back, since the later ones help with the earlier ones, within budget in all; a budget of 0
+// being unlimited. The earliest drops may be left unsolved
+func (s *Solver) Analyze(m *core.Match2D, budget time.Duration) ([]MoveAnalysis, error) {
+	if _, err := positionOf(m); err != nil {
+		return nil, err
+	}
+	var analysis []MoveAnalysis
+	//positions[i] is the position before the drop of analysis[i], and ended[i] tells whether the
+	//drop ended the match
+	var positions []c4Position
+	var ended []bool
+	var p c4Position
+	for ply, move := range m.Moves {
+		if move.Kind == core.MOVE_KIND_SWAP {
+			continue
+		}
+		col := move.Cell[1]
+		drop := p.columnMove(col)
+		analysis = append(analysis, MoveAnalysis{Ply: ply, Col: col})
+		positions = append(positions, p)
+		ended = append(ended, p.wins(drop) || p.moves+1 == c4Cells)
+		p.play(drop)
+	}
+
+	r := s.run(budget)
+	//after is the solution of the position after the drop being analyzed, for the next player
+	var after *Solution
+	if len(positions) > 0 && !ended[len(ended)-1] {
+		if sol, err := r.solution(p); err == nil {
+			after = &sol
+		}
+	}
+	for i := len(positions) - 1; i >= 0; i-- {
+		a := &analysis[i]
+		switch {
+		case positions[i].wins(positions[i].columnMove(a.Col)):
+			a.Played = &Solution{Outcome: OUTCOME_WIN, Plies: 1}
+		case ended[i]:
+			a.Played = &Solution{Outcome: OUTCOME_DRAW}
+		case after != nil:
+			played := after.after()
+			a.Played = &played
+		}
+		after = nil
+		if sol, err := r.solution(positions[i]); err == nil {
+			a.Best, after = &sol, &sol
+		}
+		a.Mistake = a.Best != nil && a.Played != nil && a.Played.Outcome < a.Best.Outcome
+	}
+	return analysis, nil
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"bytes"
+	"connectx/src/core"
+	"connectx/src/errs"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+var standard = core.MatchOpts{W: 7, H: 6, A: 4, Starts1: true}
+
+func TestSolver_Solve(t *testing.T) {
+	var s Solver
+	for _, tc := range []struct {
+		notation string
+		want     Solution
+	}{
+		{"445566", Solution{Outcome: OUTCOME_WIN, Plies: 1}},
+		//an open three can only be blocked on one side
+		{"44556", Solution{Outcome: OUTCOME_LOSS, Plies: 2}},
+		{"4455661", Solution{Outcome: OUTCOME_LOSS, Plies: 2}},
+	} {
+		sol, err := s.Solve(newMatch2D(t, standard, tc.notation), 0)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.notation, err)
+		}
+		if sol != tc.want {
+			t.Errorf("%q: expected %+v, got %+v", tc.notation, tc.want, sol)
+		}
+	}
+}
+
+// TestSolver_Solve_MatchesSearcher checks the solver against full-depth searches of random
+// positions
+func TestSolver_Solve_MatchesSearcher(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	var s Solver
+	for n := range 20 {
+		m := newMatch2D(t, standard, "")
+		for len(m.Moves) < 22+n%10 && !m.Gameover {
+			if col := rng.IntN(7); m.Board[0][col] == core.SLOT_EMPTY {
+				m.RegisterMove(core.Move{Col: col}, m.Players[m.Turn()].ID)
+			}
+		}
+		if m.Gameover {
+			continue
+		}
+		sol, err := s.Solve(m, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var searcher Searcher
+		res, _ := searcher.Search(m, 0)
+		want := Solution{Outcome: OUTCOME_DRAW}
+		if res.Score >= forcedScore {
+			want = Solution{Outcome: OUTCOME_WIN, Plies: int(WIN_SCORE - res.Score)}
+		} else if res.Score <= -forcedScore {
+			want = Solution{Outcome: OUTCOME_LOSS, Plies: int(WIN_SCORE + res.Score)}
+		}
+		if sol != want {
+			t.Errorf("%d moves: expected %+v, got %+v", len(m.Moves), want, sol)
+		}
+	}
+}
+
+func TestSolver_BestMove(t *testing.T) {
+	var s Solver
+	m := newMatch2D(t, standard, "445566")
+	hints, err := s.Hints(m, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for col, hint := range hints {
+		//the open three wins on either side, and two plies later otherwise
+		want := Solution{Outcome: OUTCOME_WIN, Plies: 3}
+		if col == 2 || col == 6 {
+			want.Plies = 1
+		}
+		if hint == nil || *hint != want {
+			t.Errorf("column %d: expected %+v, got %+v", col, want, hint)
+		}
+	}
+	col, sol, err := s.BestMove(m, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if col != 2 || sol != (Solution{Outcome: OUTCOME_WIN, Plies: 1}) {
+		t.Fatalf("expected the central win, got column %d with %+v", col, sol)
+	}
+}
+
+func TestSolver_Solve_Errors(t *testing.T) {
+	var s Solver
+	if _, err := s.Solve(newMatch2D(t, standard, ""), 50*time.Millisecond); err != errs.ErrTimeout {
+		t.Fatalf("expected a timeout on the empty board, got %v", err)
+	}
+	opts := standard
+	opts.W = 8
+	if _, err := s.Solve(newMatch2D(t, opts, ""), 0); err == nil {
+		t.Fatal("expected an error on a board of 8 columns")
+	}
+}
+
+func TestBook(t *testing.T) {
+	p, err := positionOf(newMatch2D(t, standard, "43"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	//a made up score, to tell the book from a search
+	book := &Book{Depth: 2, scores: map[uint64]int8{p.canonicalKey(): 5}}
+	var buf bytes.Buffer
+	if _, err := book.WriteTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.Len() != len(bookMagic)+5+8 {
+		t.Fatalf("expected a single entry, got %d bytes", buf.Len())
+	}
+	read, err := ReadBook(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if read.Depth != 2 || read.Len() != 1 {
+		t.Fatalf("expected the book back, got depth %d with %d positions", read.Depth, read.Len())
+	}
+
+	//the mirror image is looked up too
+	s := Solver{Book: read}
+	sol, err := s.Solve(newMatch2D(t, standard, "45"), time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := solution(5, 2); sol != want {
+		t.Fatalf("expected %+v from the book, got %+v", want, sol)
+	}
+
+	if _, err := ReadBook(bytes.NewReader([]byte("not a book"))); err == nil {
+		t.Fatal("expected an error reading a file that is not a book")
+	}
+	if _, err := GenerateBook(c4Cells, nil); err == nil {
+		t.Fatal("expected an error for a book deeper than the board")
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"connectx/src/core"
+)
+
+// winnerOf returns the ID of the winner of res, the result of a move of the player with moverID,
+// or "" if res is not a win. Pops and scoring matches name the winner, who is not always the mover
+func winnerOf(res core.GameoverResult, moverID string) string {
+	if res == nil || res["resType"] != core.RESULT_TYPE_WON {
+		return ""
+	}
+	if winnerID, ok := res["winnerID"].(string); ok {
+		return winnerID
+	}
+	return moverID
+}
+
+// winningMove returns a move among moves that wins on the spot for the player to move in nd
+func winningMove(nd *core.MatchND, moves []core.MoveND) (core.MoveND, bool) {
+	pid := nd.Players[nd.Turn()].ID
+	for _, move := range moves {
+		res, err := nd.ApplyMove(move)
+		if err != nil {
+			continue
+		}
+		nd.UndoMove()
+		if winnerOf(res, pid) == pid {
+			return move, true
+		}
+	}
+	return core.MoveND{}, false
+}
+
+// safeMoves returns the moves among moves after which the next player can't win on the spot,
+// which block their threats when there are any. If every move loses, it returns them all
+func safeMoves(nd *core.MatchND, moves []core.MoveND) []core.MoveND {
+	pid := nd.Players[nd.Turn()].ID
+	var safe []core.MoveND
+	for _, move := range moves {
+		res, err := nd.ApplyMove(move)
+		if err != nil {
+			continue
+		}
+		//a move that ends the match is safe unless somebody else wins it
+		var ok bool
+		if res != nil {
+			w := winnerOf(res, pid)
+			ok = w == "" || w == pid
+		} else {
+			ok = !canWin(nd)
+		}
+		nd.UndoMove()
+		if ok {
+			safe = append(safe, move)
+		}
+	}
+	if safe == nil {
+		return moves
+	}
+	return safe
+}
+
+// canWin tells whether the player to move in nd can win on the spot by completing a line
+func canWin(nd *core.MatchND) bool {
+	pid := nd.Players[nd.Turn()].ID
+	for _, cell := range nd.Threats(nd.Turn()) {
+		res, err := nd.ApplyMove(core.MoveND{Cell: cell})
+		if err != nil {
+			continue
+		}
+		nd.UndoMove()
+		if winnerOf(res, pid) == pid {
+			return true
+		}
+	}
+	return false
+}
@@ -6,4 +6,5 @@ var (
 	ErrNotFound       error = fmt.Errorf("not found")
 	ErrUnjoinable           = fmt.Errorf("match unjoinable")
 	ErrServerInternal       = fmt.Errorf("server internal error")
+	ErrTimeout              = fmt.Errorf("out of time")
 )
@@ -5,18 +5,48 @@ import (
 )
 
 type RegisterMovePL struct {
-	MatchID string    `json:"match_id"`
-	Col     int       `json:"col"`
-	SentAt  time.Time `json:"sent_at"`
+	MatchID string `json:"match_id"`
+	Col     int    `json:"col"`
+	// Row is the row to play at, counted from the top, on boards without gravity
+	Row int `json:"row"`
+	// Kind is 0 to drop a disc in Col, or 1 to pop one from its bottom (PopOut matches only)
+	Kind   int       `json:"kind"`
+	SentAt time.Time `json:"sent_at"`
 }
 
 type JoinMatchPL struct {
 	MatchID string `json:"match_id"`
 }
 
+type AbandonMatchPL struct {
+	MatchID string `json:"match_id"`
+}
+
+type SwapPL struct {
+	MatchID string `json:"match_id"`
+}
+
+type DrawPL struct {
+	MatchID string `json:"match_id"`
+}
+
+type TakebackPL struct {
+	MatchID string `json:"match_id"`
+}
+
+type HintPL struct {
+	MatchID string `json:"match_id"`
+}
+
+type AnalyzePL struct {
+	MatchID string `json:"match_id"`
+}
+
 type RegisterMove3DPL struct {
-	MatchID string    `json:"match_id"`
-	Col     int       `json:"col"`
-	Row     int       `json:"row"`
-	SentAt  time.Time `json:"sent_at"`
+	MatchID string `json:"match_id"`
+	Col     int    `json:"col"`
+	Row     int    `json:"row"`
+	// H is the height to play at. Like Row and Col, it is ignored when gravity pulls along its axis
+	H      int       `json:"h"`
+	SentAt time.Time `json:"sent_at"`
 }